@@ -1,40 +1,154 @@
 package utils
 
 import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var jwtSecret = []byte("your_super_secret_key") // ควรดึงจาก .env จริงๆ
+// ตรวจสอบ access token ที่ backend หลักออกให้ โดยใช้ public key จาก JWKS
+// (บริการนี้ไม่มีกุญแจลงนาม จึงออก token เองไม่ได้)
+//
+//	JWKS_URL      เช่น http://localhost:8080/.well-known/jwks.json
+//	JWT_ISSUER    ต้องตรงกับ backend
+//	JWT_AUDIENCE  ต้องตรงกับ backend
+var (
+	jwksURL     = os.Getenv("JWKS_URL")
+	jwtIssuer   = os.Getenv("JWT_ISSUER")
+	jwtAudience = os.Getenv("JWT_AUDIENCE")
+)
 
 type CustomClaims struct {
-	UserID string `json:"userId"`
-	Role   string `json:"role"`
+	UserID    string `json:"userId"`
+	Role      string `json:"role"`
+	SessionID string `json:"sid,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func GenerateJWT(userID, role string) (string, error) {
-	claims := CustomClaims{
-		UserID: userID,
-		Role:   role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)), // 1 วัน
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
-	}
+// cache ของ public key ตาม kid โหลดใหม่เมื่อครบอายุหรือพบ kid ที่ไม่รู้จัก (หลังหมุนกุญแจ)
+type jwksCache struct {
+	mu        sync.Mutex
+	keys      map[string]jwksKey
+	fetchedAt time.Time
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+type jwksKey struct {
+	alg string
+	key interface{}
 }
 
+const (
+	jwksMaxAge      = 10 * time.Minute
+	jwksMinInterval = 30 * time.Second // ไม่โหลดถี่กว่านี้แม้เจอ kid แปลก
+)
+
+var jwks = &jwksCache{}
+
 func ParseJWT(tokenString string) (*CustomClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &CustomClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return jwtSecret, nil
-	})
-	if claims, ok := token.Claims.(*CustomClaims); ok && token.Valid {
-		return claims, nil
-	} else {
+	claims := &CustomClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, jwks.keyfunc,
+		jwt.WithValidMethods([]string{"RS256", "EdDSA"}),
+		jwt.WithIssuer(jwtIssuer),
+		jwt.WithAudience(jwtAudience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (c *jwksCache) keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, err := c.lookup(kid)
+	if err != nil {
+		return nil, err
+	}
+	if token.Method.Alg() != key.alg {
+		return nil, fmt.Errorf("unexpected signing method %s for kid %q", token.Method.Alg(), kid)
+	}
+	return key.key, nil
+}
+
+func (c *jwksCache) lookup(kid string) (jwksKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key, ok := c.keys[kid]
+	age := time.Since(c.fetchedAt)
+	if (!ok && age > jwksMinInterval) || age > jwksMaxAge {
+		keys, err := fetchJWKS()
+		if err != nil {
+			if ok {
+				return key, nil // ใช้กุญแจเดิมต่อไปถ้าโหลดใหม่ไม่ได้
+			}
+			return jwksKey{}, err
+		}
+		c.keys, c.fetchedAt = keys, time.Now()
+		key, ok = keys[kid]
+	}
+	if !ok {
+		return jwksKey{}, fmt.Errorf("unknown kid %q", kid)
+	}
+	return key, nil
+}
+
+func fetchJWKS() (map[string]jwksKey, error) {
+	if jwksURL == "" {
+		return nil, fmt.Errorf("JWKS_URL is not set")
+	}
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(jwksURL)
+	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("jwks: %s", resp.Status)
+	}
+
+	var body struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Alg string `json:"alg"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+
+	keys := map[string]jwksKey{}
+	for _, k := range body.Keys {
+		switch {
+		case k.Kty == "RSA" && k.Alg == "RS256":
+			n, err1 := base64.RawURLEncoding.DecodeString(k.N)
+			e, err2 := base64.RawURLEncoding.DecodeString(k.E)
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+			keys[k.Kid] = jwksKey{alg: k.Alg, key: pub}
+		case k.Kty == "OKP" && k.Crv == "Ed25519" && k.Alg == "EdDSA":
+			x, err := base64.RawURLEncoding.DecodeString(k.X)
+			if err != nil || len(x) != ed25519.PublicKeySize {
+				continue
+			}
+			keys[k.Kid] = jwksKey{alg: k.Alg, key: ed25519.PublicKey(x)}
+		}
+	}
+	return keys, nil
 }
@@ -1,8 +1,10 @@
 package config
 
 import (
+	"backend/utils"
 	"log"
 	"os"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
@@ -14,7 +16,6 @@ type Config struct {
 	CHANNEL_ID                string
 	REDIRECT_URI              string
 	FRONTEND_URL              string
-	JWT_SECRET                string
 	JWT_ISSUER                string
 	JWT_AUDIENCE              string
 	OLLAMA_URL                string
@@ -25,6 +26,40 @@ type Config struct {
 	SECRET_KEY                string
 	users                     string
 	Port                      string
+	// โฟลเดอร์ที่เฝ้าดูไฟล์นำเข้า (ว่าง = ปิด)
+	ImportWatchDir      string
+	ImportWatchInterval string
+	ImportWatchProfile  string
+	// อายุ access token / refresh token (Go duration, ว่าง = 15m / 720h)
+	JWTAccessTTL  string
+	JWTRefreshTTL string
+	// โฟลเดอร์กุญแจลงนาม JWT (*.pem, RSA หรือ Ed25519) และ kid ที่ใช้ลงนาม (ว่าง = ชื่อไฟล์ล่าสุด)
+	JWTKeysDir    string
+	JWTSigningKid string
+	// จำกัดการเข้าสู่ระบบผิด (ว่าง = ค่าเริ่มต้น 5 ครั้งต่อบัญชี / 30 ครั้งต่อ IP / ล็อก 15m)
+	LoginMaxFailures   string
+	LoginIPMaxFailures string
+	LoginLockDuration  string
+	// การส่งอีเมล: MAIL_DRIVER = smtp | file | log (ว่าง = log)
+	MailDriver   string
+	MailFrom     string
+	MailDir      string
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+	// ฟีเจอร์ที่บัญชียังไม่ยืนยันอีเมลใช้ไม่ได้ คั่นด้วย , (ว่าง = cart, none = ไม่จำกัด)
+	EmailVerifyRequired string
+	// role ที่ต้องเปิดการยืนยันสองขั้นตอน คั่นด้วย , (ว่าง = admin, none = ไม่บังคับ)
+	MFARequiredRoles string
+	// นโยบายรหัสผ่าน: ความยาวขั้นต่ำ, ชนิดตัวอักษรที่บังคับ (upper,lower,digit,symbol), ไฟล์รายการรหัสผ่านต้องห้ามเพิ่มเติม
+	PasswordMinLength string
+	PasswordRequire   string
+	PasswordBlocklist string
+	// ผู้ให้บริการ OIDC เพิ่มเติม (ดู oidc.go)
+	OIDCProviders []OIDCProviderConfig
+	// IP หรือ CIDR ของ reverse proxy ที่เชื่อ X-Forwarded-For ได้ (ว่าง = ไม่มี proxy ใช้ IP ของการเชื่อมต่อ)
+	TrustedProxies []string
 }
 
 func LoadConfig() *Config {
@@ -37,9 +72,27 @@ func LoadConfig() *Config {
 		CHANNEL_ID:                os.Getenv("CHANNEL_ID"),
 		REDIRECT_URI:              os.Getenv("REDIRECT_URI"),
 		FRONTEND_URL:              os.Getenv("FRONTEND_URL"),
-		JWT_SECRET:                os.Getenv("JWT_SECRET"),
 		JWT_ISSUER:                os.Getenv("JWT_ISSUER"),
 		JWT_AUDIENCE:              os.Getenv("JWT_AUDIENCE"),
+		JWTAccessTTL:              os.Getenv("JWT_ACCESS_TTL"),
+		JWTRefreshTTL:             os.Getenv("JWT_REFRESH_TTL"),
+		JWTKeysDir:                os.Getenv("JWT_KEYS_DIR"),
+		JWTSigningKid:             os.Getenv("JWT_SIGNING_KID"),
+		LoginMaxFailures:          os.Getenv("LOGIN_MAX_FAILURES"),
+		LoginIPMaxFailures:        os.Getenv("LOGIN_IP_MAX_FAILURES"),
+		LoginLockDuration:         os.Getenv("LOGIN_LOCK_DURATION"),
+		MailDriver:                os.Getenv("MAIL_DRIVER"),
+		MailFrom:                  os.Getenv("MAIL_FROM"),
+		MailDir:                   os.Getenv("MAIL_DIR"),
+		SMTPHost:                  os.Getenv("SMTP_HOST"),
+		SMTPPort:                  os.Getenv("SMTP_PORT"),
+		SMTPUsername:              os.Getenv("SMTP_USERNAME"),
+		SMTPPassword:              os.Getenv("SMTP_PASSWORD"),
+		EmailVerifyRequired:       os.Getenv("EMAIL_VERIFICATION_REQUIRED_FOR"),
+		MFARequiredRoles:          os.Getenv("MFA_REQUIRED_ROLES"),
+		PasswordMinLength:         os.Getenv("PASSWORD_MIN_LENGTH"),
+		PasswordRequire:           os.Getenv("PASSWORD_REQUIRE"),
+		PasswordBlocklist:         os.Getenv("PASSWORD_BLOCKLIST_FILE"),
 		OLLAMA_URL:                os.Getenv("OLLAMA_URL"),
 		OLLAMA_MODEL:              os.Getenv("OLLAMA_MODEL"),
 		MongoURI:                  os.Getenv("MONGO_URI"),
@@ -48,10 +101,24 @@ func LoadConfig() *Config {
 		SECRET_KEY:                os.Getenv("SECRET_KEY"),
 		users:                     os.Getenv("users"),
 		Port:                      os.Getenv("PORT"),
+		ImportWatchDir:            os.Getenv("IMPORT_WATCH_DIR"),
+		ImportWatchInterval:       os.Getenv("IMPORT_WATCH_INTERVAL"),
+		ImportWatchProfile:        os.Getenv("IMPORT_WATCH_PROFILE"),
+	}
+
+	cfg.OIDCProviders = loadOIDCProviders(os.Getenv("OIDC_PROVIDERS"), cfg.REDIRECT_URI)
+	for _, p := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			cfg.TrustedProxies = append(cfg.TrustedProxies, p)
+		}
 	}
 
 	if cfg.MongoURI == "" || cfg.MongoDBName == "" {
 		log.Fatal("Missing required environment vars")
 	}
+	// ใช้ลงนาม session, mfaToken, ลิงก์ยืนยันอีเมล และเข้ารหัส TOTP secret: ค่าว่างหรือสั้นทำให้ปลอมได้
+	if len(cfg.SECRET_KEY) < utils.MinSecretKeyLength {
+		log.Fatalf("SECRET_KEY must be at least %d characters (e.g. openssl rand -base64 48)", utils.MinSecretKeyLength)
+	}
 	return cfg
 }
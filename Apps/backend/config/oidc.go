@@ -0,0 +1,47 @@
+package config
+
+import (
+	"os"
+	"strings"
+)
+
+// ผู้ให้บริการ OIDC หนึ่งราย อ่านจาก env ตามชื่อใน OIDC_PROVIDERS
+//
+//	OIDC_PROVIDERS=google,keycloak
+//	OIDC_GOOGLE_ISSUER=https://accounts.google.com
+//	OIDC_GOOGLE_CLIENT_ID=...
+//	OIDC_GOOGLE_CLIENT_SECRET=...
+//	OIDC_GOOGLE_SCOPES=openid email profile      (ไม่บังคับ)
+//	OIDC_GOOGLE_REDIRECT_URI=...                 (ไม่บังคับ ค่าเริ่มต้น REDIRECT_URI + "/google")
+type OIDCProviderConfig struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	RedirectURI  string
+}
+
+func loadOIDCProviders(list, redirectURI string) []OIDCProviderConfig {
+	var providers []OIDCProviderConfig
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		p := OIDCProviderConfig{
+			Name:         name,
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			Scopes:       strings.Fields(os.Getenv(prefix + "SCOPES")),
+			RedirectURI:  os.Getenv(prefix + "REDIRECT_URI"),
+		}
+		if p.RedirectURI == "" {
+			p.RedirectURI = strings.TrimRight(redirectURI, "/") + "/" + name
+		}
+		providers = append(providers, p)
+	}
+	return providers
+}
@@ -1,10 +1,8 @@
 package database
 
 import (
-	"backend/models"
 	"context"
 	"net/http"
-	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
@@ -15,6 +13,9 @@ import (
 var Client *mongo.Client
 var UserCollection *mongo.Collection
 var CartCollection *mongo.Collection
+var RefreshTokenCollection *mongo.Collection
+var RevokedTokenCollection *mongo.Collection
+var SecurityEventCollection *mongo.Collection
 
 func ConnectToMongoDB(uri string) (*mongo.Client, error) {
 	clientOptions := options.Client().ApplyURI(uri)
@@ -44,24 +45,3 @@ func GetAllDocuments(collection *mongo.Collection) gin.HandlerFunc {
 		c.JSON(http.StatusOK, results)
 	}
 }
-
-func SaveOrUpdateUserWithTimestamp(user models.User, collection *mongo.Collection) error {
-	now := time.Now()
-
-	filter := bson.M{"lineUserId": user.LineUserID}
-	update := bson.M{
-		"$set": bson.M{
-			"username":  user.Username,
-			"role":      user.Role,
-			"updatedAt": now,
-			"lastLogin": now,
-		},
-		"$setOnInsert": bson.M{
-			"createdAt": now,
-		},
-	}
-
-	opts := options.Update().SetUpsert(true)
-	_, err := collection.UpdateOne(context.TODO(), filter, update, opts)
-	return err
-}
@@ -5,6 +5,8 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
@@ -46,10 +48,104 @@ func CalculateDiscountedPrice(basePrice float64, promotion models.Promotion, pac
 		return 0, fmt.Errorf("โปรโมชั่นเฉพาะ packageId ไม่ตรง")
 	}
 
+	// โปรโมชั่นครอบครัวต้องรู้จำนวนผู้เอาประกัน ให้ใช้ CalculateFamilyDiscount แทน
+	if promotion.Type == "family" {
+		return 0, fmt.Errorf("โปรโมชั่นครอบครัวต้องระบุจำนวนผู้เอาประกัน")
+	}
+
 	// ถ้าไม่ตรงกับเงื่อนไขใดๆ
 	return 0, fmt.Errorf("โปรโมชั่นไม่สามารถใช้งานได้")
 }
 
+// ฟังก์ชันคำนวณส่วนลดโปรโมชั่นครอบครัวจากเบี้ยรวมของทุกคน
+// โปรโมชั่นประเภทอื่นต้องคิดรายคน (ApplyQuotePromotion)
+func CalculateFamilyDiscount(total float64, promotion models.Promotion, insuredCount int) (float64, error) {
+	if promotion.Type != "family" {
+		return 0, fmt.Errorf("โปรโมชั่น %q ไม่ใช่โปรโมชั่นครอบครัว", promotion.Name)
+	}
+	if insuredCount < promotion.MinInsured {
+		return 0, fmt.Errorf("โปรโมชั่นครอบครัวต้องมีผู้เอาประกันอย่างน้อย %d คน", promotion.MinInsured)
+	}
+	discount := (promotion.DiscountPercentage / 100) * total
+	return total - discount, nil
+}
+
+// ใช้โปรโมชั่นกับใบเสนอราคาครอบครัว
+// family คิดจากเบี้ยรวม ประเภทอื่นคิดรายคนตามแพ็กเกจและหมวดของคนนั้น (คนที่ไม่ตรงเงื่อนไขไม่ได้ส่วนลด)
+func ApplyQuotePromotion(quote *models.FamilyQuote, promotion models.Promotion, on time.Time) error {
+	if err := checkPromotionPeriod(promotion, on); err != nil {
+		return err
+	}
+
+	total := quote.Subtotal
+	if promotion.Type == "family" {
+		var err error
+		if total, err = CalculateFamilyDiscount(quote.Subtotal, promotion, quote.Insured); err != nil {
+			return err
+		}
+	} else {
+		total = 0
+		matched := 0
+		for i := range quote.Members {
+			m := &quote.Members[i]
+			if !m.Eligible {
+				continue
+			}
+			price, err := CalculateDiscountedPrice(m.Annual, promotion, m.PackageID, m.CategoryID)
+			if err != nil {
+				total += m.Annual
+				continue
+			}
+			m.Discount = m.Annual - price
+			total += price
+			matched++
+		}
+		if matched == 0 {
+			return fmt.Errorf("โปรโมชั่นนี้ใช้กับแพ็กเกจของผู้เอาประกันในใบเสนอราคาไม่ได้")
+		}
+	}
+
+	quote.Promotion = promotion.Name
+	quote.Total = total
+	quote.Discount = quote.Subtotal - total
+	return nil
+}
+
+// ตรวจช่วงเวลาของโปรโมชั่น (YYYY-MM-DD หรือ RFC 3339 วันสิ้นสุดนับรวมทั้งวัน ค่าว่าง = ไม่จำกัด)
+func checkPromotionPeriod(promotion models.Promotion, on time.Time) error {
+	if promotion.ValidFrom != "" {
+		from, _, err := parsePromotionDate(promotion.ValidFrom)
+		if err != nil {
+			return fmt.Errorf("วันเริ่มต้นของโปรโมชั่นไม่ถูกต้อง: %q", promotion.ValidFrom)
+		}
+		if on.Before(from) {
+			return fmt.Errorf("โปรโมชั่นเริ่มใช้ได้ตั้งแต่ %s", promotion.ValidFrom)
+		}
+	}
+	if promotion.ValidTo != "" {
+		to, dateOnly, err := parsePromotionDate(promotion.ValidTo)
+		if err != nil {
+			return fmt.Errorf("วันสิ้นสุดของโปรโมชั่นไม่ถูกต้อง: %q", promotion.ValidTo)
+		}
+		if dateOnly {
+			to = to.AddDate(0, 0, 1)
+		}
+		if !on.Before(to) {
+			return fmt.Errorf("โปรโมชั่นหมดอายุแล้ว (ถึง %s)", promotion.ValidTo)
+		}
+	}
+	return nil
+}
+
+func parsePromotionDate(s string) (t time.Time, dateOnly bool, err error) {
+	s = strings.TrimSpace(s)
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, true, nil
+	}
+	t, err = time.Parse(time.RFC3339, s)
+	return t, false, err
+}
+
 // ฟังก์ชันคำนวณราคา
 func CalculatePriceHandler(db *mongo.Database) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -58,6 +154,7 @@ func CalculatePriceHandler(db *mongo.Database) gin.HandlerFunc {
 			BasePrice     float64 `json:"basePrice"`
 			PackageId     string  `json:"packageId"`
 			CategoryId    string  `json:"categoryId"`
+			InsuredCount  int     `json:"insuredCount"` // สำหรับโปรโมชั่นครอบครัว
 		}
 
 		// รับข้อมูลจาก client
@@ -74,8 +171,18 @@ func CalculatePriceHandler(db *mongo.Database) gin.HandlerFunc {
 			return
 		}
 
+		if err := checkPromotionPeriod(promotion, time.Now()); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
 		// คำนวณราคาเบี้ยประกันหลังใช้โปรโมชั่น
-		discountedPrice, err := CalculateDiscountedPrice(request.BasePrice, promotion, request.PackageId, request.CategoryId)
+		var discountedPrice float64
+		if promotion.Type == "family" {
+			discountedPrice, err = CalculateFamilyDiscount(request.BasePrice, promotion, request.InsuredCount)
+		} else {
+			discountedPrice, err = CalculateDiscountedPrice(request.BasePrice, promotion, request.PackageId, request.CategoryId)
+		}
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
@@ -0,0 +1,369 @@
+package handlers
+
+import (
+	"backend/database"
+	"backend/models"
+	"backend/services"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// การเชื่อมบัญชี: คนเดียวเข้าสู่ระบบได้ทั้ง LINE และชื่อผู้ใช้/รหัสผ่านด้วยบัญชีเดียวกัน
+//
+//	POST   /api/auth/link/line   (บัญชีที่เข้าสู่ระบบอยู่) → url ของ LINE; callback จะผูก LINE ไว้ใน identities แทนการเข้าสู่ระบบ
+//	DELETE /api/auth/link/line   ยกเลิกการผูก LINE (ต้องมีรหัสผ่านก่อน)
+//	POST   /api/auth/link/local  บัญชี LINE ตั้งชื่อผู้ใช้/อีเมล/รหัสผ่าน
+
+const (
+	userUsernameIndex = "username_local_unique"
+	userEmailIndex    = "email_unique"
+)
+
+// sub ของผู้ให้บริการหนึ่งราย (LINE หรือ OIDC) ผูกได้กับผู้ใช้เดียว อีเมลไม่ซ้ำกัน และชื่อผู้ใช้ไม่ซ้ำในบัญชีที่มีรหัสผ่าน
+// (ใช้เข้าสู่ระบบและตั้งรหัสผ่านใหม่) ชื่อของบัญชี LINE/OIDC มาจากชื่อที่แสดงจึงซ้ำกันได้
+func EnsureUserIndexes(ctx context.Context) error {
+	_, err := database.UserCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "identities.provider", Value: 1}, {Key: "identities.sub", Value: 1}},
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(bson.M{"identities.sub": bson.M{"$exists": true}}),
+		},
+		{
+			Keys: bson.D{{Key: "username", Value: 1}},
+			Options: options.Index().SetName(userUsernameIndex).SetUnique(true).
+				SetPartialFilterExpression(bson.M{"password": bson.M{"$gt": ""}}),
+		},
+		{
+			Keys: bson.D{{Key: "email", Value: 1}},
+			Options: options.Index().SetName(userEmailIndex).SetUnique(true).
+				SetPartialFilterExpression(bson.M{"email": bson.M{"$gt": ""}}),
+		},
+	})
+	return err
+}
+
+// ข้อความเมื่อบันทึกผู้ใช้ไม่ได้เพราะชื่อผู้ใช้หรืออีเมลซ้ำ (คำขอพร้อมกันที่ผ่านการตรวจล่วงหน้ามาแล้ว)
+// ok = false เมื่อไม่ใช่ duplicate key ของสองฟิลด์นี้
+func duplicateUserMessage(err error) (string, bool) {
+	if !mongo.IsDuplicateKeyError(err) {
+		return "", false
+	}
+	switch msg := err.Error(); {
+	case strings.Contains(msg, userEmailIndex):
+		return "อีเมลนี้มีอยู่แล้ว", true
+	case strings.Contains(msg, userUsernameIndex):
+		return "ชื่อผู้ใช้นี้มีอยู่แล้ว", true
+	}
+	return "", false
+}
+
+func isDuplicateEmail(err error) bool {
+	return mongo.IsDuplicateKeyError(err) && strings.Contains(err.Error(), userEmailIndex)
+}
+
+// ผู้ใช้ LINE เดิมเก็บ LINE userId ไว้ใน lineUserId (ก่อนย้ายไป identities)
+type legacyLineUser struct {
+	ID         primitive.ObjectID `bson:"_id"`
+	LineUserID string             `bson:"lineUserId"`
+	CreatedAt  time.Time          `bson:"createdAt"`
+}
+
+// ย้ายข้อมูลของผู้ใช้ LINE รุ่นเก่าที่อ้างอิงด้วย lineUserId (แต่ละขั้นทำครั้งเดียว บันทึกไว้ใน collection migrations)
+//  1. ข้อมูลใน collection อื่นใช้ user ID (ObjectID hex) แบบเดียวกับผู้ใช้ local
+//  2. lineUserId ย้ายไปเป็น identities ของ provider line แล้วลบ index เดิมของ lineUserId
+func MigrateLineUserIDs(ctx context.Context, db *mongo.Database) error {
+	users, err := legacyLineUsers(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	err = migrateOnce(ctx, db, "line-user-id-to-object-id", func() (bson.M, error) {
+		collections := []string{"cart", "insured_persons", "needs_assessments", "refresh_tokens", "security_events"}
+		moved := 0
+		for _, u := range users {
+			for _, col := range collections {
+				res, err := db.Collection(col).UpdateMany(ctx,
+					bson.M{"userId": u.LineUserID},
+					bson.M{"$set": bson.M{"userId": u.ID.Hex()}},
+				)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", col, err)
+				}
+				moved += int(res.ModifiedCount)
+			}
+		}
+		return bson.M{"users": len(users), "documents": moved}, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return migrateOnce(ctx, db, "line-user-id-to-identities", func() (bson.M, error) {
+		col := db.Collection("users")
+		for _, u := range users {
+			// ทำซ้ำได้ถ้าหยุดกลางทาง: เพิ่ม identity เฉพาะเมื่อยังไม่มี แล้วจึงลบ lineUserId
+			_, err := col.UpdateOne(ctx,
+				bson.M{"_id": u.ID, "identities.provider": bson.M{"$ne": models.IdentityLine}},
+				bson.M{"$push": bson.M{"identities": models.Identity{Provider: models.IdentityLine, Subject: u.LineUserID, LinkedAt: u.CreatedAt}}},
+			)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := col.UpdateOne(ctx, bson.M{"_id": u.ID}, bson.M{"$unset": bson.M{"lineUserId": ""}}); err != nil {
+				return nil, err
+			}
+		}
+		var cmdErr mongo.CommandError
+		if _, err := col.Indexes().DropOne(ctx, "lineUserId_1"); err != nil {
+			if !errors.As(err, &cmdErr) || (cmdErr.Name != "IndexNotFound" && cmdErr.Name != "NamespaceNotFound") {
+				return nil, err
+			}
+		}
+		return bson.M{"users": len(users)}, nil
+	})
+}
+
+func legacyLineUsers(ctx context.Context, db *mongo.Database) ([]legacyLineUser, error) {
+	cursor, err := db.Collection("users").Find(ctx,
+		bson.M{"lineUserId": bson.M{"$gt": ""}},
+		options.Find().SetProjection(bson.M{"lineUserId": 1, "createdAt": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	var users []legacyLineUser
+	err = cursor.All(ctx, &users)
+	return users, err
+}
+
+// ทำ fn ครั้งเดียวต่อ name แล้วบันทึกผล (ค่าที่ fn คืน) ไว้ใน collection migrations
+func migrateOnce(ctx context.Context, db *mongo.Database, name string, fn func() (bson.M, error)) error {
+	migrations := db.Collection("migrations")
+	if n, err := migrations.CountDocuments(ctx, bson.M{"_id": name}); err != nil || n > 0 {
+		return err
+	}
+	result, err := fn()
+	if err != nil {
+		return err
+	}
+	doc := bson.M{"_id": name, "appliedAt": time.Now()}
+	for k, v := range result {
+		doc[k] = v
+	}
+	if _, err := migrations.InsertOne(ctx, doc); err != nil {
+		return err
+	}
+	log.Printf("migration %s: %v", name, result)
+	return nil
+}
+
+// filter ของผู้ใช้ที่ผูก sub ของผู้ให้บริการนี้ไว้ (LINE ใช้ provider models.IdentityLine)
+func identityFilter(provider, subject string) bson.M {
+	return bson.M{"identities": bson.M{"$elemMatch": bson.M{"provider": provider, "sub": subject}}}
+}
+
+// ผูก identity กับผู้ใช้ userID ใช้ร่วมกันทั้ง LINE และ OIDC
+// คืนผลสำหรับ redirectLinkResult: linked | in_use | already_linked | error
+func linkIdentity(ctx context.Context, userID string, identity models.Identity) string {
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil || identity.Subject == "" {
+		return "error"
+	}
+
+	// sub นี้เป็นของบัญชีอื่นอยู่แล้ว (เคยเข้าสู่ระบบแยกไว้) → ไม่รวมบัญชีให้อัตโนมัติ
+	filter := identityFilter(identity.Provider, identity.Subject)
+	filter["_id"] = bson.M{"$ne": id}
+	n, err := database.UserCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		return "error"
+	}
+	if n > 0 {
+		return "in_use"
+	}
+
+	res, err := database.UserCollection.UpdateOne(ctx,
+		bson.M{"_id": id, "identities.provider": bson.M{"$ne": identity.Provider}},
+		bson.M{
+			"$push": bson.M{"identities": identity},
+			"$set":  bson.M{"updatedAt": time.Now()},
+		},
+	)
+	switch {
+	case mongo.IsDuplicateKeyError(err):
+		return "in_use"
+	case err != nil:
+		return "error"
+	case res.MatchedCount == 0:
+		return "already_linked"
+	}
+	return "linked"
+}
+
+// ยกเลิกการผูก provider ของผู้ใช้ที่เข้าสู่ระบบอยู่ ใช้ร่วมกันทั้ง LINE และ OIDC (name ใช้ในข้อความตอบกลับ)
+func unlinkIdentity(c *gin.Context, provider, name string) {
+	ctx := c.Request.Context()
+	var user models.User
+	if err := database.UserCollection.FindOne(ctx, userFilter(c.GetString("userId"))).Decode(&user); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	if !user.HasIdentity(provider) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Account is not linked to " + name})
+		return
+	}
+	// ไม่มีวิธีอื่น = ยกเลิกแล้วจะเข้าสู่ระบบไม่ได้อีก
+	if user.LoginMethods() < 2 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Add another sign-in method before unlinking " + name})
+		return
+	}
+	if _, err := database.UserCollection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{
+		"$pull": bson.M{"identities": bson.M{"provider": provider}},
+		"$set":  bson.M{"updatedAt": time.Now()},
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": name + " unlinked"})
+}
+
+// POST /api/auth/link/line (ต้องเข้าสู่ระบบ)
+// frontend เปิด url ที่ได้ (ส่ง cookie ของ session ไปด้วย) แล้ว LINE จะกลับมาที่ /api/auth/callback ตามปกติ
+func (h *AuthHandler) LinkLine(c *gin.Context) {
+	var user models.User
+	if err := database.UserCollection.FindOne(c.Request.Context(), userFilter(c.GetString("userId"))).Decode(&user); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	if user.HasIdentity(models.IdentityLine) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Account is already linked to LINE"})
+		return
+	}
+
+	flow, err := startOAuthFlow(c, "line", user.ID.Hex())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save session"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"url": h.lineAuthorizeURL(flow)})
+}
+
+// ขั้นสุดท้ายของการเชื่อม LINE (เรียกจาก HandleCallback) แล้ว redirect ไปหน้า frontend พร้อมผลลัพธ์
+func (h *AuthHandler) finishLineLink(c *gin.Context, userID string, identity *services.LineIdentity) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	status := linkIdentity(ctx, userID, models.Identity{
+		Provider: models.IdentityLine,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+		LinkedAt: time.Now(),
+	})
+	h.redirectLinkResult(c, "line", status)
+}
+
+// ผลการเชื่อมบัญชี: linked | in_use | already_linked | error
+func (h *AuthHandler) redirectLinkResult(c *gin.Context, provider, status string) {
+	c.Redirect(http.StatusFound, fmt.Sprintf("%s/account/linked?provider=%s&status=%s",
+		h.Config.FRONTEND_URL, url.QueryEscape(provider), url.QueryEscape(status)))
+}
+
+// DELETE /api/auth/link/line (ต้องเข้าสู่ระบบ)
+func (h *AuthHandler) UnlinkLine(c *gin.Context) {
+	unlinkIdentity(c, models.IdentityLine, "LINE")
+}
+
+// POST /api/auth/link/local (ต้องเข้าสู่ระบบ)
+// บัญชีที่สร้างจาก LINE ตั้งชื่อผู้ใช้/รหัสผ่านเพื่อเข้าสู่ระบบได้อีกทาง อีเมลต้องยืนยันเหมือนการสมัคร
+func LinkLocalHandler(db *mongo.Database, verifier *EmailVerifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input RegisterInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "ข้อมูลไม่ถูกต้อง"})
+			return
+		}
+		username := strings.TrimSpace(input.Username)
+		email := strings.TrimSpace(input.Email)
+		input.Password = services.NormalizePassword(input.Password)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		userCol := db.Collection("users")
+		var user models.User
+		if err := userCol.FindOne(ctx, userFilter(c.GetString("userId"))).Decode(&user); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "ไม่พบผู้ใช้"})
+			return
+		}
+		if user.HasPassword() {
+			c.JSON(http.StatusConflict, gin.H{"error": "บัญชีนี้ตั้งรหัสผ่านไว้แล้ว"})
+			return
+		}
+
+		// ชื่อผู้ใช้/อีเมลซ้ำกับบัญชีอื่น
+		for _, check := range []struct{ field, value, msg string }{
+			{"username", username, "ชื่อผู้ใช้นี้มีอยู่แล้ว"},
+			{"email", email, "อีเมลนี้มีอยู่แล้ว"},
+		} {
+			n, err := userCol.CountDocuments(ctx, bson.M{check.field: check.value, "_id": bson.M{"$ne": user.ID}})
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+				return
+			}
+			if n > 0 {
+				c.JSON(http.StatusConflict, gin.H{"error": check.msg})
+				return
+			}
+		}
+		if rejectWeakPassword(c, input.Password, username, email) {
+			return
+		}
+
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), 12)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "ไม่สามารถเข้ารหัสรหัสผ่านได้"})
+			return
+		}
+		now := time.Now()
+		// ตั้งได้ครั้งเดียว: เงื่อนไขยังไม่มีรหัสผ่านกันคำขอพร้อมกัน
+		res, err := userCol.UpdateOne(ctx,
+			bson.M{"_id": user.ID, "password": bson.M{"$in": bson.A{nil, ""}}},
+			bson.M{"$set": bson.M{
+				"username":          username,
+				"email":             email,
+				"password":          string(hashedPassword),
+				"emailVerified":     false,
+				"passwordChangedAt": now,
+				"updatedAt":         now,
+			}},
+		)
+		if msg, dup := duplicateUserMessage(err); dup {
+			c.JSON(http.StatusConflict, gin.H{"error": msg})
+			return
+		}
+		if err != nil || res.MatchedCount == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "บัญชีนี้ตั้งรหัสผ่านไว้แล้ว"})
+			return
+		}
+
+		if err := verifier.send(ctx, user.ID, username, email); err != nil {
+			log.Println("Link local verification mail:", err)
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"message":       "ตั้งชื่อผู้ใช้และรหัสผ่านแล้ว กรุณายืนยันอีเมลจากลิงก์ที่ส่งไป",
+			"username":      username,
+			"emailVerified": false,
+		})
+	}
+}
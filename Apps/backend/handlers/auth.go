@@ -4,6 +4,7 @@ import (
 	"backend/config"
 	"backend/database"
 	"backend/models"
+	"backend/services"
 	"backend/utils"
 	"bytes"
 	"context"
@@ -16,40 +17,47 @@ import (
 	"strings"
 	"time"
 
-	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type AuthHandler struct {
-	Config *config.Config
+	Config      *config.Config
+	LineIDToken *services.LineIDTokenVerifier
 }
 
 func NewAuthHandler(cfg *config.Config) *AuthHandler {
-	return &AuthHandler{Config: cfg}
+	return &AuthHandler{
+		Config:      cfg,
+		LineIDToken: services.NewLineIDTokenVerifier(cfg.CHANNEL_ID, cfg.LINE_LOGIN_CHANNEL_SECRET),
+	}
 }
 
 // GET /api/auth/login/line
 func (h *AuthHandler) LineLoginHandler(c *gin.Context) {
-	state := utils.GenerateSecureState()
-
-	// ✅ Step 2: เก็บ state ลง session
-	session := sessions.Default(c)
-	session.Set("oauthState", state)
-	if err := session.Save(); err != nil {
+	// ✅ Step 2: เก็บ state/nonce/PKCE ลง session (เข้าสู่ระบบปกติ ไม่ใช่การเชื่อมบัญชี)
+	flow, err := startOAuthFlow(c, "line", "")
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save session"})
 		return
 	}
 
-	authURL := fmt.Sprintf(
-		"https://access.line.me/oauth2/v2.1/authorize?response_type=code&client_id=%s&redirect_uri=%s&state=%s&scope=%s",
-		h.Config.CHANNEL_ID,
-		h.Config.REDIRECT_URI,
-		state,
-		"profile openid email",
-	)
-	c.Redirect(http.StatusFound, authURL)
+	c.Redirect(http.StatusFound, h.lineAuthorizeURL(flow))
+}
+
+func (h *AuthHandler) lineAuthorizeURL(flow *oauthFlow) string {
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", h.Config.CHANNEL_ID)
+	q.Set("redirect_uri", h.Config.REDIRECT_URI)
+	q.Set("state", flow.State)
+	q.Set("scope", "profile openid email")
+	q.Set("nonce", flow.Nonce)
+	q.Set("code_challenge", flow.Challenge())
+	q.Set("code_challenge_method", "S256")
+	return "https://access.line.me/oauth2/v2.1/authorize?" + q.Encode()
 }
 
 // GET /api/me
@@ -66,29 +74,25 @@ func (h *AuthHandler) GetMe(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
 		return
 	}
+	if revoked, err := isRevoked(c.Request.Context(), claims); err != nil || revoked {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+		return
+	}
 
 	var user models.User
-	err = database.UserCollection.FindOne(context.TODO(), bson.M{"lineUserId": claims.UserID}).Decode(&user)
+	err = database.UserCollection.FindOne(c.Request.Context(), userFilter(claims.UserID)).Decode(&user)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"userId":   user.LineUserID,
-		"username": user.Username,
-		"role":     user.Role,
-	})
-	log.Printf(">>> GetMe - claims.UserID = %s", claims.UserID)
-	log.Printf(">>> GetMe - user: %+v", user)
+	c.JSON(http.StatusOK, user.Profile())
 }
 
 func (h *AuthHandler) HandleCallback(c *gin.Context) {
-	session := sessions.Default(c)
-	storedState := session.Get("oauthState")
-	queryState := c.Query("state")
-
-	if storedState == nil || queryState != storedState {
+	// state ใช้ได้ครั้งเดียว
+	flow, ok := finishOAuthFlow(c, "line")
+	if !ok {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid state (CSRF protection)"})
 		return
 	}
@@ -100,73 +104,173 @@ func (h *AuthHandler) HandleCallback(c *gin.Context) {
 	}
 
 	// ✅ Step 1: ขอ access token จาก LINE
-	token, err := h.getAccessToken(code)
+	token, err := h.getAccessToken(code, flow.Verifier)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get LINE access token"})
 		return
 	}
 
-	// ✅ Step 2: ขอข้อมูลโปรไฟล์ผู้ใช้จาก LINE
-	profile, err := h.getUserProfile(token.AccessToken)
+	// ✅ Step 2: ตรวจ ID token (ลายเซ็น, iss, aud = channel ID, exp, nonce ที่ส่งไปตอน authorize)
+	identity, err := h.LineIDToken.Verify(c.Request.Context(), token.IDToken, flow.Nonce)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch LINE profile"})
+		log.Println("line callback:", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid LINE ID token"})
+		return
+	}
+
+	// เริ่มจาก POST /api/auth/link/line → ผูก LINE กับบัญชีที่เข้าสู่ระบบอยู่แทนการเข้าสู่ระบบ
+	if flow.LinkUserID != "" {
+		h.finishLineLink(c, flow.LinkUserID, identity)
 		return
 	}
 
 	// ✅ Step 3: ตรวจสอบหรือสร้าง user ใน MongoDB
 	ctx := context.TODO()
+	user, err := h.findOrCreateLineUser(ctx, c, identity)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	// ✅ Step 4: สร้าง access token + refresh token จาก user ID + Role (เหมือนการเข้าสู่ระบบด้วยรหัสผ่าน)
+	tokens, _, err := issueSession(ctx, c, user.ID.Hex(), user.Role, "", false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate JWT"})
+		return
+	}
+
+	// ✅ Step 5: Redirect กลับไปยัง frontend พร้อม token, refreshToken, userId, username, role
+	h.redirectLoginSuccess(c, user, tokens)
+}
+
+// POST /api/auth/line/liff
+// แอป LIFF ส่ง liff.getIDToken() มาแลกเป็น JWT ของระบบ (nonce ไม่บังคับ ถ้าส่งมาต้องตรงกับใน token)
+func (h *AuthHandler) LiffLogin(c *gin.Context) {
+	var input struct {
+		IDToken string `json:"idToken" binding:"required"`
+		Nonce   string `json:"nonce"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing idToken"})
+		return
+	}
+
+	identity, err := h.LineIDToken.Verify(c.Request.Context(), input.IDToken, input.Nonce)
+	if err != nil {
+		log.Println("liff login:", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid LINE ID token"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	user, err := h.findOrCreateLineUser(ctx, c, identity)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	tokens, _, err := issueSession(ctx, c, user.ID.Hex(), user.Role, "", false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate JWT"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":        tokens.Token,
+		"refreshToken": tokens.RefreshToken,
+		"expiresIn":    tokens.ExpiresIn,
+		"userId":       user.ID.Hex(),
+		"username":     user.Username,
+		"role":         user.Role,
+	})
+}
+
+// หา user จาก LINE userId (sub ของ ID token) หรือสร้างใหม่ แล้วอัปเดตข้อมูลการเข้าสู่ระบบ
+// อีเมลจาก LINE จะบันทึกเมื่อบัญชียังไม่มีอีเมลและไม่ซ้ำกับบัญชีอื่น (ถ้าซ้ำให้ผู้ใช้เชื่อมบัญชีเอง)
+func (h *AuthHandler) findOrCreateLineUser(ctx context.Context, c *gin.Context, identity *services.LineIdentity) (models.User, error) {
 	now := time.Now()
 	var user models.User
 
-	err = database.UserCollection.FindOne(ctx, bson.M{"lineUserId": profile.UserID}).Decode(&user)
+	email := identity.Email
+	if email != "" {
+		n, err := database.UserCollection.CountDocuments(ctx, bson.M{
+			"email":      email,
+			"identities": bson.M{"$not": bson.M{"$elemMatch": bson.M{"provider": models.IdentityLine, "sub": identity.Subject}}},
+		})
+		if err != nil {
+			return user, err
+		}
+		if n > 0 {
+			email = ""
+		}
+	}
+
+	err := database.UserCollection.FindOne(ctx, identityFilter(models.IdentityLine, identity.Subject)).Decode(&user)
 	if err == mongo.ErrNoDocuments {
-		// ไม่พบ user → สร้างใหม่
-		user = models.User{
-			Username:   profile.DisplayName,
-			LineUserID: profile.UserID,
-			Role:       "user",
-			Provider:   "Line",
-			CreatedAt:  now,
-			UpdatedAt:  now,
-			LastLogin:  now,
+		// ไม่พบ user → สร้างใหม่ (LIFF ที่ไม่ได้ขอ scope profile จะไม่มีชื่อมาใน token)
+		username := identity.Name
+		if username == "" {
+			username = "LINE user"
 		}
-		if _, err := database.UserCollection.InsertOne(ctx, user); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create new user"})
-			return
+		user = models.User{
+			Username:     username,
+			Email:        email,
+			Role:         "user",
+			Provider:     models.ProviderLine,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+			LastLogin:    now,
+			LoginCount:   1,
+			LastIP:       c.ClientIP(),
+			LastDevice:   c.Request.UserAgent(),
+			IsActive:     true,
+			LastActivity: now,
+			Identities:   []models.Identity{{Provider: models.IdentityLine, Subject: identity.Subject, Email: identity.Email, LinkedAt: now}},
 		}
-	} else if err == nil {
-		// ✅ พบ user เดิม → อัปเดต lastLogin
-		update := bson.M{
-			"$set": bson.M{
-				"lastLogin":  now,
-				"updatedAt":  now,
-				"lastIP":     c.ClientIP(),
-				"lastDevice": c.Request.UserAgent(),
-			},
-			"$inc": bson.M{"loginCount": 1},
+		res, err := database.UserCollection.InsertOne(ctx, user)
+		if isDuplicateEmail(err) {
+			// อีเมลถูกใช้โดยบัญชีที่สร้างพร้อมกัน: สร้างโดยไม่มีอีเมล
+			user.Email = ""
+			res, err = database.UserCollection.InsertOne(ctx, user)
 		}
-		if _, err := database.UserCollection.UpdateOne(ctx, bson.M{"_id": user.ID}, update); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user login info"})
-			return
+		if err != nil {
+			return user, err
 		}
-	} else {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
-		return
+		user.ID = res.InsertedID.(primitive.ObjectID)
+		return user, nil
 	}
-
-	// ✅ Step 4: สร้าง JWT จาก LineUserID + Role
-	jwtToken, err := utils.GenerateJWT(user.LineUserID, user.Role)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate JWT"})
-		return
+		return user, err
 	}
 
-	// ✅ Step 5: Redirect กลับไปยัง frontend พร้อม token, userId, username, role
+	// ✅ พบ user เดิม → อัปเดต lastLogin
+	set := bson.M{
+		"lastLogin":    now,
+		"updatedAt":    now,
+		"lastIP":       c.ClientIP(),
+		"lastDevice":   c.Request.UserAgent(),
+		"lastActivity": now,
+	}
+	if user.Email == "" && email != "" {
+		set["email"] = email
+		user.Email = email
+	}
+	update := bson.M{"$set": set, "$inc": bson.M{"loginCount": 1}}
+	_, err = database.UserCollection.UpdateOne(ctx, bson.M{"_id": user.ID}, update)
+	if isDuplicateEmail(err) {
+		delete(set, "email")
+		user.Email = ""
+		_, err = database.UserCollection.UpdateOne(ctx, bson.M{"_id": user.ID}, update)
+	}
+	return user, err
+}
+
+func (h *AuthHandler) redirectLoginSuccess(c *gin.Context, user models.User, tokens *sessionTokens) {
 	redirectURL := fmt.Sprintf(
-		"%s/login/success?token=%s&userId=%s&username=%s&role=%s",
+		"%s/login/success?token=%s&refreshToken=%s&userId=%s&username=%s&role=%s",
 		h.Config.FRONTEND_URL,
-		url.QueryEscape(jwtToken),
-		url.QueryEscape(user.LineUserID),
+		url.QueryEscape(tokens.Token),
+		url.QueryEscape(tokens.RefreshToken),
+		url.QueryEscape(user.ID.Hex()),
 		url.QueryEscape(user.Username),
 		url.QueryEscape(user.Role),
 	)
@@ -179,15 +283,15 @@ type tokenResponse struct {
 	IDToken     string `json:"id_token"`
 }
 
-func (h *AuthHandler) getAccessToken(code string) (*tokenResponse, error) {
-	data := fmt.Sprintf(
-		"grant_type=authorization_code&code=%s&redirect_uri=%s&client_id=%s&client_secret=%s",
-		code,
-		h.Config.REDIRECT_URI,
-		h.Config.CHANNEL_ID,
-		h.Config.LINE_LOGIN_CHANNEL_SECRET,
-	)
-	req, err := http.NewRequest("POST", "https://api.line.me/oauth2/v2.1/token", bytes.NewBufferString(data))
+func (h *AuthHandler) getAccessToken(code, codeVerifier string) (*tokenResponse, error) {
+	data := url.Values{}
+	data.Set("grant_type", "authorization_code")
+	data.Set("code", code)
+	data.Set("redirect_uri", h.Config.REDIRECT_URI)
+	data.Set("client_id", h.Config.CHANNEL_ID)
+	data.Set("client_secret", h.Config.LINE_LOGIN_CHANNEL_SECRET)
+	data.Set("code_verifier", codeVerifier)
+	req, err := http.NewRequest("POST", "https://api.line.me/oauth2/v2.1/token", bytes.NewBufferString(data.Encode()))
 	if err != nil {
 		return nil, err
 	}
@@ -203,26 +307,6 @@ func (h *AuthHandler) getAccessToken(code string) (*tokenResponse, error) {
 	return &token, err
 }
 
-type userProfile struct {
-	UserID      string `json:"userId"`
-	DisplayName string `json:"displayName"`
-	PictureURL  string `json:"pictureUrl"`
-}
-
-func (h *AuthHandler) getUserProfile(accessToken string) (*userProfile, error) {
-	req, _ := http.NewRequest("GET", "https://api.line.me/v2/profile", nil)
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	body, _ := io.ReadAll(resp.Body)
-	var profile userProfile
-	err = json.Unmarshal(body, &profile)
-	return &profile, err
-}
-
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
@@ -238,9 +322,65 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// token ที่ออกจากระบบแล้วหรือถูกเพิกถอนทั้ง family
+		revoked, err := isRevoked(c.Request.Context(), claims)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "Unable to verify token"})
+			return
+		}
+		if revoked {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token revoked"})
+			return
+		}
+
 		// ใส่ข้อมูลลง context
 		c.Set("userId", claims.UserID)
 		c.Set("role", claims.Role)
+		c.Set("mfa", claims.MFA)
+		c.Set("sid", claims.SessionID)
+		c.Next()
+	}
+}
+
+// เหมือน AuthMiddleware แต่ไม่บังคับ: ถ้ามี token ที่ถูกต้องจะใส่ userId/role ลง context
+func OptionalAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authHeader := c.GetHeader("Authorization")
+		if authHeader != "" {
+			if claims, err := utils.ParseJWT(strings.TrimPrefix(authHeader, "Bearer ")); err == nil {
+				if revoked, err := isRevoked(c.Request.Context(), claims); err == nil && !revoked {
+					c.Set("userId", claims.UserID)
+					c.Set("role", claims.Role)
+					c.Set("mfa", claims.MFA)
+					c.Set("sid", claims.SessionID)
+				}
+			}
+		}
 		c.Next()
 	}
 }
+
+// ใช้ต่อจาก AuthMiddleware เพื่อจำกัดสิทธิ์ตาม role
+// role ใน MFARequiredRoles ต้องเข้าสู่ระบบแบบสองขั้นตอนด้วย
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := c.GetString("role")
+		for _, r := range roles {
+			if role == r {
+				if MFARequiredRoles[role] && !c.GetBool("mfa") {
+					c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication required", "code": "mfa_required"})
+					return
+				}
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+	}
+}
+
+// filter ของ user จาก userId ใน JWT (ObjectID hex) ค่าที่ไม่ใช่ ObjectID ไม่ตรงกับผู้ใช้ใด
+func userFilter(userID string) bson.M {
+	objID, _ := primitive.ObjectIDFromHex(userID)
+	return bson.M{"_id": objID}
+}
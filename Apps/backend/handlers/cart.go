@@ -5,7 +5,9 @@ import (
 	"net/http"
 	"time"
 
+	"backend/database"
 	"backend/models" // เปลี่ยนเป็น module path ของโปรเจกต์คุณ
+	"backend/services"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
@@ -15,35 +17,35 @@ import (
 )
 
 type CartHandler struct {
+	DB         *mongo.Database
 	Collection *mongo.Collection
 }
 
 // สร้าง CartHandler
 func NewCartHandler(db *mongo.Database) *CartHandler {
 	return &CartHandler{
+		DB:         db,
 		Collection: db.Collection("cart"),
 	}
 }
 
+// ผู้ใช้มาจาก access token (AuthMiddleware) เสมอ ไม่รับ userId/username จาก body หรือ query
+// ต้องระบุ insuredId หรือ dateOfBirth อย่างใดอย่างหนึ่ง อายุเริ่มต้นและเบี้ยคำนวณที่เซิร์ฟเวอร์
 type AddToCartInput struct {
-	Username    string             `json:"username"`
-	UserID      string             `json:"userId"`
-	PackageName string             `json:"packageName"`
-	StartAge    int                `json:"startAge"`
-	EndAge      int                `json:"endAge"`
-	Premium     models.PremiumInfo `json:"premium"`
+	PackageName string `json:"packageName" binding:"required"`
+	InsuredID   string `json:"insuredId"`   // ผู้เอาประกันที่บันทึกไว้
+	DateOfBirth string `json:"dateOfBirth"` // ใช้เมื่อไม่ระบุ insuredId, YYYY-MM-DD
+	Gender      string `json:"gender"`      // ใช้คู่กับ dateOfBirth
+	StartDate   string `json:"startDate"`   // วันเริ่มคุ้มครอง (ค่าว่าง = วันนี้)
+	EndAge      int    `json:"endAge"`      // คุ้มครองถึงอายุ (น้อยกว่าอายุเริ่มต้น = ปีเดียว)
 }
 
-// GET /api/cart?userId=xxx
+// GET /api/cart
 func (h *CartHandler) GetCart(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	userId := c.Query("userId")
-	if userId == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "userId is required"})
-		return
-	}
+	userId := c.GetString("userId")
 
 	var cartItem models.CartItem
 	err := h.Collection.FindOne(ctx, bson.M{"userId": userId}).Decode(&cartItem)
@@ -67,32 +69,90 @@ func (h *CartHandler) AddToCart(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if input.InsuredID == "" && input.DateOfBirth == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "กรุณาระบุผู้เอาประกัน (insuredId) หรือวันเกิด (dateOfBirth)"})
+		return
+	}
+	startDate, err := services.ParseDate(input.StartDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	userID := c.GetString("userId")
+	var user models.User
+	if err := database.UserCollection.FindOne(ctx, userFilter(userID)).Decode(&user); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "ไม่พบผู้ใช้"})
+		return
+	}
+
 	// สร้าง ObjectID ใหม่ให้ item ใน cart
 	itemID := primitive.NewObjectID()
 
+	entry := bson.M{
+		"_id":         itemID,
+		"packageName": input.PackageName,
+		"startDate":   startDate,
+		"dateAdded":   time.Now(),
+	}
+
+	// ตรวจสิทธิ์ของผู้เอาประกันกับแพ็กเกจ แล้วคำนวณอายุจากวันเกิดและเบี้ยจากตารางเบี้ยของแพ็กเกจ
+	var person models.InsuredPerson
+	if input.InsuredID != "" {
+		person, err = findInsured(ctx, h.DB.Collection("insured_persons"), userID, input.InsuredID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		entry["insuredId"] = input.InsuredID
+		entry["insuredName"] = person.Name
+	} else {
+		dob, err := services.ParseDate(input.DateOfBirth)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		person = models.InsuredPerson{DateOfBirth: dob, Gender: input.Gender}
+	}
+
+	pkg, err := findPackage(ctx, h.DB, "", input.PackageName)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ไม่พบแพ็กเกจ"})
+		return
+	}
+	member := services.QuoteMember(person, pkg, startDate)
+	if !member.Eligible {
+		c.JSON(http.StatusBadRequest, gin.H{"error": member.Reason})
+		return
+	}
+	endAge := input.EndAge
+	if endAge < member.Age {
+		endAge = member.Age
+	}
+	annual, err := services.AveragePremium(pkg.Pricing, member.Gender, member.Age, endAge)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	entry["startAge"] = member.Age
+	entry["endAge"] = endAge
+	entry["premium"] = models.PremiumInfo{Annual: annual}
+
 	update := bson.M{
 		"$set": bson.M{
-			"userId":   input.UserID,
-			"username": input.Username,
+			"userId":   userID,
+			"username": user.Username,
 		},
 		"$push": bson.M{
-			"cart": bson.M{
-				"_id":         itemID,
-				"packageName": input.PackageName,
-				"startAge":    input.StartAge,
-				"endAge":      input.EndAge,
-				"premium":     input.Premium,
-				"dateAdded":   time.Now(),
-			},
+			"cart": entry,
 		},
 	}
 
 	opts := options.Update().SetUpsert(true)
-	_, err := h.Collection.UpdateOne(ctx, bson.M{"userId": input.UserID}, update, opts)
+	_, err = h.Collection.UpdateOne(ctx, bson.M{"userId": userID}, update, opts)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -101,16 +161,11 @@ func (h *CartHandler) AddToCart(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Added to cart"})
 }
 
-// DELETE /api/cart/:id?userId=xxx
+// DELETE /api/cart/:id
 func (h *CartHandler) DeleteFromCart(c *gin.Context) {
-	userId := c.Query("userId")
+	userId := c.GetString("userId")
 	itemIDStr := c.Param("id") // ตอนนี้ id คือ ObjectID ของแต่ละรายการใน cart
 
-	if userId == "" || itemIDStr == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing userId or item id"})
-		return
-	}
-
 	itemID, err := primitive.ObjectIDFromHex(itemIDStr)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item id"})
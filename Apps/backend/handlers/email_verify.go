@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"backend/database"
+	"backend/services"
+	"backend/utils"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	emailVerifyTTL      = 48 * time.Hour
+	emailVerifyCooldown = time.Minute
+	emailVerifyPurpose  = "email-verify"
+)
+
+// ยืนยันอีเมลของผู้ใช้ local ด้วยลิงก์ที่ลงนามด้วย SECRET_KEY
+// Restricted คือฟีเจอร์ที่บัญชียังไม่ยืนยันใช้ไม่ได้ (ดู Require)
+type EmailVerifier struct {
+	DB          *mongo.Database
+	Mailer      services.MailSender
+	FrontendURL string
+	Secret      []byte
+	Restricted  map[string]bool
+}
+
+func NewEmailVerifier(db *mongo.Database, mailer services.MailSender, frontendURL string, secret []byte) *EmailVerifier {
+	return &EmailVerifier{
+		DB:          db,
+		Mailer:      mailer,
+		FrontendURL: strings.TrimRight(frontendURL, "/"),
+		Secret:      secret,
+		Restricted:  map[string]bool{},
+	}
+}
+
+// "cart,quotes" → จำกัดฟีเจอร์ cart และ quotes ("none" = ไม่จำกัด)
+func (v *EmailVerifier) SetRestricted(list string) {
+	v.Restricted = map[string]bool{}
+	for _, f := range strings.Split(list, ",") {
+		if f = strings.ToLower(strings.TrimSpace(f)); f != "" && f != "none" {
+			v.Restricted[f] = true
+		}
+	}
+}
+
+func (v *EmailVerifier) token(userID primitive.ObjectID, email string) string {
+	payload := strings.Join([]string{emailVerifyPurpose, userID.Hex(), email}, "|")
+	return utils.SignPayload(v.Secret, payload, time.Now().Add(emailVerifyTTL))
+}
+
+// ส่งลิงก์ยืนยันเบื้องหลังและบันทึกเวลาที่ส่ง
+func (v *EmailVerifier) send(ctx context.Context, userID primitive.ObjectID, username, email string) error {
+	if _, err := v.DB.Collection("users").UpdateOne(ctx, bson.M{"_id": userID},
+		bson.M{"$set": bson.M{"verificationSentAt": time.Now()}}); err != nil {
+		return err
+	}
+	link := fmt.Sprintf("%s/verify-email?token=%s", v.FrontendURL, url.QueryEscape(v.token(userID, email)))
+	mail := services.Mail{
+		To:      email,
+		Subject: "ยืนยันอีเมลของคุณ",
+		Body: fmt.Sprintf("สวัสดีคุณ %s\n\nกรุณากดลิงก์ด้านล่างเพื่อยืนยันอีเมล (ใช้ได้ภายใน %d ชั่วโมง):\n\n%s\n\nหากคุณไม่ได้สมัครสมาชิก ไม่ต้องดำเนินการใดๆ\n",
+			username, int(emailVerifyTTL.Hours()), link),
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := v.Mailer.Send(ctx, mail); err != nil {
+			log.Println("verification mail:", err)
+		}
+	}()
+	return nil
+}
+
+// POST /api/auth/email/verify
+func (v *EmailVerifier) Verify(c *gin.Context) {
+	var input struct {
+		Token string `json:"token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ข้อมูลไม่ถูกต้อง"})
+		return
+	}
+
+	payload, err := utils.VerifySignedPayload(v.Secret, strings.TrimSpace(input.Token))
+	parts := strings.Split(payload, "|")
+	if err != nil || len(parts) != 3 || parts[0] != emailVerifyPurpose {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ลิงก์ยืนยันอีเมลไม่ถูกต้องหรือหมดอายุแล้ว"})
+		return
+	}
+	userID, err := primitive.ObjectIDFromHex(parts[1])
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ลิงก์ยืนยันอีเมลไม่ถูกต้องหรือหมดอายุแล้ว"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// อีเมลต้องยังตรงกับในลิงก์ (เปลี่ยนอีเมลแล้วลิงก์เก่าใช้ไม่ได้)
+	filter := bson.M{"_id": userID, "email": parts[2]}
+	var account struct {
+		EmailVerified *bool `bson:"emailVerified"`
+	}
+	if err := v.DB.Collection("users").FindOne(ctx, filter).Decode(&account); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ลิงก์ยืนยันอีเมลไม่ถูกต้องหรือหมดอายุแล้ว"})
+		return
+	}
+	if account.EmailVerified == nil || *account.EmailVerified {
+		c.JSON(http.StatusOK, gin.H{"message": "ยืนยันอีเมลเรียบร้อยแล้ว"})
+		return
+	}
+	if _, err := v.DB.Collection("users").UpdateOne(ctx, filter, bson.M{"$set": bson.M{
+		"emailVerified":   true,
+		"emailVerifiedAt": time.Now(),
+	}}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ไม่สามารถยืนยันอีเมลได้"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "ยืนยันอีเมลเรียบร้อยแล้ว"})
+}
+
+// POST /api/auth/email/resend (ต้องเข้าสู่ระบบ)
+func (v *EmailVerifier) Resend(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "บัญชีนี้ไม่ต้องยืนยันอีเมล"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var account struct {
+		Username           string     `bson:"username"`
+		Email              string     `bson:"email"`
+		EmailVerified      *bool      `bson:"emailVerified"`
+		VerificationSentAt *time.Time `bson:"verificationSentAt"`
+	}
+	if err := v.DB.Collection("users").FindOne(ctx, bson.M{"_id": userID}).Decode(&account); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "ไม่พบผู้ใช้"})
+		return
+	}
+	if account.Email == "" || account.EmailVerified == nil || *account.EmailVerified {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "บัญชีนี้ยืนยันอีเมลแล้ว"})
+		return
+	}
+	if account.VerificationSentAt != nil && time.Since(*account.VerificationSentAt) < emailVerifyCooldown {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "เพิ่งส่งลิงก์ไปแล้ว กรุณารอสักครู่ก่อนขอใหม่"})
+		return
+	}
+	if err := v.send(ctx, userID, account.Username, account.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ไม่สามารถส่งอีเมลยืนยันได้"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "ส่งลิงก์ยืนยันไปที่ " + account.Email + " แล้ว"})
+}
+
+// ใช้ต่อจาก AuthMiddleware/OptionalAuth: ปฏิเสธบัญชีที่ยังไม่ยืนยันอีเมลเมื่อ feature อยู่ใน Restricted
+// บัญชีที่ไม่มีฟิลด์ emailVerified (LINE หรือสมัครก่อนมีการยืนยัน) ถือว่ายืนยันแล้ว
+func (v *EmailVerifier) Require(feature string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("userId")
+		if !v.Restricted[feature] {
+			c.Next()
+			return
+		}
+		// ไม่มีผู้ใช้ = ยืนยันอีเมลไม่ได้ (กันการข้ามด้วยการไม่ส่ง Authorization)
+		if userID == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "กรุณาเข้าสู่ระบบ"})
+			return
+		}
+		filter := userFilter(userID)
+		filter["emailVerified"] = false
+		n, err := database.UserCollection.CountDocuments(c.Request.Context(), filter)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if n > 0 {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "กรุณายืนยันอีเมลก่อนใช้งานส่วนนี้",
+				"code":  "email_unverified",
+			})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"backend/models"
+	"backend/services"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xuri/excelize/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GET /api/packages/export?format=json|csv|xlsx&category=...&package=id1,id2
+// ไฟล์ที่ได้อัปโหลดกลับผ่าน POST /api/upload ได้ทันที
+// (xlsx แยกตารางเบี้ยไว้ใน sheet Pricing ซึ่ง importer จะรวมกลับเข้าแพ็กเกจตาม id)
+func ExportPackagesHandler(db *mongo.Database) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		format := strings.ToLower(c.DefaultQuery("format", "json"))
+		if format != "json" && format != "csv" && format != "xlsx" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "format ต้องเป็น json, csv หรือ xlsx"})
+			return
+		}
+
+		filter := bson.M{}
+		if category := c.Query("category"); category != "" {
+			filter["categoryId"] = category
+		}
+		if ids := c.Query("package"); ids != "" {
+			var or []bson.M
+			for _, id := range strings.Split(ids, ",") {
+				if id = strings.TrimSpace(id); id != "" {
+					or = append(or, packageFilter(id))
+				}
+			}
+			filter["$or"] = or
+		}
+
+		ctx := context.Background()
+		cursor, err := db.Collection("packages").Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "id", Value: 1}}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		pkgs := []models.Package{}
+		if err := cursor.All(ctx, &pkgs); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		// แพ็กเกจเก่าที่ไม่มี id แบบข้อความ ใช้ ObjectID แทนเพื่อให้ไฟล์ผ่านการตรวจตอนนำเข้า
+		// (findPackagesByID จับคู่ค่านี้กับ _id จึงอัปเดตแพ็กเกจเดิมแทนการเพิ่มซ้ำ)
+		for i := range pkgs {
+			if pkgs[i].PackageID == "" {
+				pkgs[i].PackageID = pkgs[i].ID.Hex()
+			}
+		}
+
+		filename := fmt.Sprintf("packages-%s.%s", time.Now().Format("20060102-150405"), format)
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+		switch format {
+		case "json":
+			exportJSON(c, pkgs)
+		case "csv":
+			exportCSV(c, pkgs)
+		case "xlsx":
+			exportXLSX(c, pkgs)
+		}
+	}
+}
+
+// รูปแบบเดียวกับ parseJSON: id คือ id แบบข้อความ ไม่มี _id
+func exportJSON(c *gin.Context, pkgs []models.Package) {
+	out := make([]map[string]interface{}, len(pkgs))
+	for i, pkg := range pkgs {
+		m := packageToMap(pkg)
+		delete(m, "packageId")
+		m["id"] = pkg.PackageID
+		out[i] = m
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// เขียนลง buffer ก่อน เพื่อตอบ error ได้ถ้าเขียนไม่สำเร็จ
+func exportCSV(c *gin.Context, pkgs []models.Package) {
+	headers, rows := services.ExportTable(pkgs)
+	var buf bytes.Buffer
+	// BOM ให้ Excel เปิดภาษาไทยได้ถูกต้อง (normalizeHeader ตัดออกตอนนำเข้า)
+	buf.WriteString("\ufeff")
+	w := csv.NewWriter(&buf)
+	if err := w.Write(headers); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := w.WriteAll(rows); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+}
+
+func exportXLSX(c *gin.Context, pkgs []models.Package) {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	const packageSheet, pricingSheet = "Packages", "Pricing"
+	f.SetSheetName(f.GetSheetName(0), packageSheet)
+	if _, err := f.NewSheet(pricingSheet); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// คอลัมน์แรก (id) เป็นข้อความเสมอ คอลัมน์อื่นที่เป็นตัวเลขเขียนเป็น cell ตัวเลข
+	writeRow := func(sheet string, row int, values []string) error {
+		cells := make([]interface{}, len(values))
+		for i, v := range values {
+			cells[i] = v
+			if n, err := strconv.ParseFloat(v, 64); err == nil && i > 0 && row > 1 {
+				cells[i] = n
+			}
+		}
+		cell, _ := excelize.CoordinatesToCellName(1, row)
+		return f.SetSheetRow(sheet, cell, &cells)
+	}
+
+	err := writeRow(packageSheet, 1, services.ExportPackageColumns)
+	if err == nil {
+		err = writeRow(pricingSheet, 1, append([]string{"id"}, services.ExportPricingColumns...))
+	}
+	pricingRow := 2
+	for i, pkg := range pkgs {
+		if err != nil {
+			break
+		}
+		err = writeRow(packageSheet, i+2, services.ExportPackageRow(pkg))
+		for _, t := range pkg.Pricing {
+			if err != nil {
+				break
+			}
+			err = writeRow(pricingSheet, pricingRow, append([]string{pkg.PackageID}, services.ExportPricingRow(t)...))
+			pricingRow++
+		}
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	buf, err := f.WriteToBuffer()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Data(http.StatusOK, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", buf.Bytes())
+}
@@ -0,0 +1,289 @@
+package handlers
+
+import (
+	"backend/models"
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// บันทึก batch ถ้ามีการเปลี่ยนแปลง คืน id ของ batch (ค่าว่างถ้าไม่มีอะไรเปลี่ยน)
+func (h *UploadHandler) recordBatch(ctx context.Context, batch models.ImportBatch) (string, error) {
+	if len(batch.InsertedIDs) == 0 && len(batch.Updates) == 0 {
+		return "", nil
+	}
+	if batch.InsertedIDs == nil {
+		batch.InsertedIDs = []primitive.ObjectID{}
+	}
+	result, err := h.DB.Collection("import_batches").InsertOne(ctx, batch)
+	if err != nil {
+		return "", err
+	}
+	return result.InsertedID.(primitive.ObjectID).Hex(), nil
+}
+
+// GET /api/upload/batches?limit=50
+func (h *UploadHandler) ListBatches(c *gin.Context) {
+	limit, err := strconv.ParseInt(c.DefaultQuery("limit", "50"), 10, 64)
+	if err != nil || limit <= 0 {
+		c.JSON(400, gin.H{"error": "limit ไม่ถูกต้อง"})
+		return
+	}
+
+	ctx := context.Background()
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}}).
+		SetLimit(limit).
+		SetProjection(bson.M{"inserted": 0, "updates.after": 0})
+	cursor, err := h.DB.Collection("import_batches").Find(ctx, bson.M{}, opts)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	batches := []models.ImportBatch{}
+	if err := cursor.All(ctx, &batches); err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, batches)
+}
+
+// ขั้นตอน undo ของแพ็กเกจหนึ่ง: current คือเอกสารปัจจุบัน (ใช้เป็นเงื่อนไขและใช้ย้อนกลับ)
+// restore เป็น nil หมายถึงลบแพ็กเกจที่ batch เพิ่มเข้ามา
+type undoStep struct {
+	id      primitive.ObjectID
+	current bson.D
+	restore *models.BatchUpdate
+}
+
+// POST /api/upload/batches/:id/undo
+// ย้อน batch ได้เฉพาะเมื่อทุกแพ็กเกจยังเหมือนตอนนำเข้า (ไม่ถูกแก้ไขหรือลบไปแล้ว)
+func (h *UploadHandler) UndoBatch(c *gin.Context) {
+	batchID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid batch ID"})
+		return
+	}
+
+	ctx := context.Background()
+	batches := h.DB.Collection("import_batches")
+	var batch models.ImportBatch
+	err = batches.FindOne(ctx, bson.M{"_id": batchID}).Decode(&batch)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(404, gin.H{"error": "ไม่พบ batch"})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	if batch.UndoneAt != nil {
+		c.JSON(409, gin.H{"error": "batch นี้ถูก undo ไปแล้ว"})
+		return
+	}
+
+	collection := h.DB.Collection("packages")
+	var steps []undoStep
+	var modified []string
+	check := func(id primitive.ObjectID, after models.Package, restore *models.BatchUpdate) error {
+		raw, err := collection.FindOne(ctx, bson.M{"_id": id}).Raw()
+		if err == mongo.ErrNoDocuments {
+			modified = append(modified, after.PackageID)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var current bson.D
+		var pkg models.Package
+		if err := bson.Unmarshal(raw, &current); err != nil {
+			return err
+		}
+		if err := bson.Unmarshal(raw, &pkg); err != nil {
+			return err
+		}
+		if !samePackage(pkg, after) {
+			modified = append(modified, after.PackageID)
+			return nil
+		}
+		steps = append(steps, undoStep{id: id, current: current, restore: restore})
+		return nil
+	}
+
+	for _, pkg := range batch.Inserted {
+		if err := check(pkg.ID, pkg, nil); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	for i := range batch.Updates {
+		u := &batch.Updates[i]
+		if len(u.Fields) == 0 {
+			c.JSON(409, gin.H{"error": "batch ไม่มีรายการฟิลด์ที่แก้ของแพ็กเกจ " + u.PackageID.Hex() + " ไม่สามารถ undo ได้"})
+			return
+		}
+		if err := check(u.PackageID, u.After, u); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if len(modified) > 0 {
+		c.JSON(409, gin.H{"error": "มีแพ็กเกจที่ถูกแก้ไขหลังการนำเข้า ไม่สามารถ undo ได้", "modified": modified})
+		return
+	}
+
+	for i, step := range steps {
+		if err := applyUndoStep(ctx, collection, step); err != nil {
+			rollbackUndo(ctx, collection, steps[:i])
+			c.JSON(409, gin.H{"error": "undo ไม่สำเร็จ ยกเลิกการเปลี่ยนแปลงทั้งหมด: " + err.Error()})
+			return
+		}
+	}
+
+	_, err = batches.UpdateOne(ctx, bson.M{"_id": batchID}, bson.M{"$set": bson.M{
+		"undoneAt": time.Now(),
+		"undoneBy": c.GetString("userId"),
+	}})
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message":  "undo สำเร็จ",
+		"deleted":  len(batch.Inserted),
+		"restored": len(batch.Updates),
+	})
+}
+
+func applyUndoStep(ctx context.Context, collection *mongo.Collection, step undoStep) error {
+	if step.restore == nil {
+		result, err := collection.DeleteOne(ctx, step.current)
+		if err == nil && result.DeletedCount == 0 {
+			err = fmt.Errorf("แพ็กเกจ %s ถูกแก้ไขระหว่าง undo", step.id.Hex())
+		}
+		return err
+	}
+	result, err := collection.UpdateOne(ctx, step.current, restoreUpdate(step.restore.Before, step.restore.Fields))
+	if err == nil && result.MatchedCount == 0 {
+		err = fmt.Errorf("แพ็กเกจ %s ถูกแก้ไขระหว่าง undo", step.id.Hex())
+	}
+	return err
+}
+
+func rollbackUndo(ctx context.Context, collection *mongo.Collection, applied []undoStep) {
+	for _, step := range applied {
+		if step.restore == nil {
+			_, _ = collection.InsertOne(ctx, step.current)
+			continue
+		}
+		_, _ = collection.ReplaceOne(ctx, bson.M{"_id": step.id}, step.current)
+	}
+}
+
+// ชื่อฟิลด์ใน bson จากชื่อใน json ของ models.Package (ต่างกันเฉพาะ id แบบข้อความ)
+func packageBSONField(jsonField string) string {
+	if jsonField == "packageId" {
+		return "id"
+	}
+	return jsonField
+}
+
+// ฟิลด์ (ชื่อใน json) ที่ต่างกันระหว่างเอกสารเดิมกับใหม่ ฟิลด์ที่ใหม่ไม่มี (omitempty) นับว่าเปลี่ยนด้วย
+func changedPackageFields(oldDoc, newDoc map[string]interface{}) []string {
+	var fields []string
+	for _, d := range CompareDocuments(oldDoc, newDoc) {
+		fields = append(fields, d.Field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// update ที่ $set / $unset เฉพาะ fields (ชื่อใน json) ให้เป็นค่าของ pkg ฟิลด์อื่นของเอกสาร
+// (รวมฟิลด์ที่ models.Package ไม่รู้จัก) คงเดิม คืนชื่อฟิลด์ใน bson ที่แก้ไว้ใช้ตอน undo
+func packageUpdate(pkg models.Package, fields []string) (bson.M, []string, error) {
+	raw, err := bson.Marshal(pkg)
+	if err != nil {
+		return nil, nil, err
+	}
+	var doc bson.M
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return nil, nil, err
+	}
+	set, unset := bson.M{}, bson.M{}
+	var changed []string
+	for _, f := range fields {
+		key := packageBSONField(f)
+		if key == "_id" {
+			continue
+		}
+		changed = append(changed, key)
+		if v, ok := doc[key]; ok {
+			set[key] = v
+		} else {
+			unset[key] = ""
+		}
+	}
+	return updateDoc(set, unset), changed, nil
+}
+
+// update ที่คืนค่า fields ตาม before (ฟิลด์ที่ before ไม่มีจะถูกลบ)
+func restoreUpdate(before bson.M, fields []string) bson.M {
+	set, unset := bson.M{}, bson.M{}
+	for _, key := range fields {
+		if v, ok := before[key]; ok {
+			set[key] = v
+		} else {
+			unset[key] = ""
+		}
+	}
+	return updateDoc(set, unset)
+}
+
+func updateDoc(set, unset bson.M) bson.M {
+	update := bson.M{}
+	if len(set) > 0 {
+		update["$set"] = set
+	}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	return update
+}
+
+// ผลลัพธ์ที่คาดไว้ของเอกสารหลังใช้ update (ใช้ตรวจตอน undo ว่ายังไม่ถูกแก้)
+func packageAfterUpdate(before bson.M, update bson.M) (models.Package, error) {
+	doc := make(bson.M, len(before))
+	for k, v := range before {
+		doc[k] = v
+	}
+	if set, ok := update["$set"].(bson.M); ok {
+		for k, v := range set {
+			doc[k] = v
+		}
+	}
+	if unset, ok := update["$unset"].(bson.M); ok {
+		for k := range unset {
+			delete(doc, k)
+		}
+	}
+	var pkg models.Package
+	raw, err := bson.Marshal(doc)
+	if err == nil {
+		err = bson.Unmarshal(raw, &pkg)
+	}
+	return pkg, err
+}
+
+func samePackage(a, b models.Package) bool {
+	am, bm := packageToMap(a), packageToMap(b)
+	return len(CompareDocuments(am, bm)) == 0 && len(CompareDocuments(bm, am)) == 0
+}
@@ -0,0 +1,511 @@
+package handlers
+
+import (
+	"backend/models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ประมวลผลไฟล์นำเข้าขนาดใหญ่ในเบื้องหลัง: บันทึกไฟล์ลงดิสก์ สร้าง job แล้วให้ worker ทำงานต่อ
+// สถานะและความคืบหน้าเก็บใน collection import_jobs เพื่อ polling / SSE
+type ImportJobRunner struct {
+	Uploads *UploadHandler
+	Dir     string // โฟลเดอร์เก็บไฟล์ที่รอประมวลผล
+	Workers int
+	queue   chan primitive.ObjectID
+}
+
+func NewImportJobRunner(uploads *UploadHandler, workers int) *ImportJobRunner {
+	return &ImportJobRunner{
+		Uploads: uploads,
+		Dir:     filepath.Join(os.TempDir(), "insurance-imports"),
+		Workers: workers,
+		queue:   make(chan primitive.ObjectID, 100),
+	}
+}
+
+func (r *ImportJobRunner) jobs() *mongo.Collection {
+	return r.Uploads.DB.Collection("import_jobs")
+}
+
+// เริ่ม worker และนำ job ที่ค้างอยู่ (จากการรีสตาร์ต) กลับเข้าคิว
+func (r *ImportJobRunner) Start() {
+	for i := 0; i < r.Workers; i++ {
+		go func() {
+			for id := range r.queue {
+				func() {
+					defer logPanic("import job " + id.Hex())
+					r.run(id)
+				}()
+			}
+		}()
+	}
+
+	ctx := context.Background()
+	now := time.Now()
+	_, err := r.jobs().UpdateMany(ctx, bson.M{"status": models.JobRunning}, bson.M{"$set": bson.M{
+		"status":     models.JobFailed,
+		"error":      "ถูกยกเลิกเนื่องจากเซิร์ฟเวอร์รีสตาร์ต",
+		"finishedAt": now,
+	}})
+	if err != nil {
+		log.Println("import jobs: recover failed:", err)
+		return
+	}
+	cursor, err := r.jobs().Find(ctx, bson.M{"status": models.JobQueued}, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		log.Println("import jobs: recover failed:", err)
+		return
+	}
+	var queued []models.ImportJob
+	if err := cursor.All(ctx, &queued); err != nil {
+		log.Println("import jobs: recover failed:", err)
+		return
+	}
+	for _, job := range queued {
+		r.enqueue(job.ID)
+	}
+}
+
+// กัน panic ใน worker เบื้องหลังไม่ให้ทำให้ทั้งโปรแกรมล่ม (ใช้กับ defer โดยตรง)
+func logPanic(where string) {
+	if p := recover(); p != nil {
+		log.Printf("%s: panic: %v\n%s", where, p, debug.Stack())
+	}
+}
+
+func (r *ImportJobRunner) enqueue(id primitive.ObjectID) {
+	go func() { r.queue <- id }()
+}
+
+// POST /api/upload/jobs — รับไฟล์แล้วคืน jobId ทันที (202) ตัวเลือกเหมือน POST /api/upload
+func (r *ImportJobRunner) Enqueue(c *gin.Context) {
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(400, gin.H{"error": "ไม่พบไฟล์"})
+		return
+	}
+	if !supportedImportFile(file.Filename) {
+		c.JSON(400, gin.H{"error": "รองรับเฉพาะไฟล์ .json, .csv, .xlsx, .pdf เท่านั้น"})
+		return
+	}
+	opts, err := importOptionsFromQuery(c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := os.MkdirAll(r.Dir, 0o700); err != nil {
+		c.JSON(500, gin.H{"error": "ไม่สามารถบันทึกไฟล์ได้"})
+		return
+	}
+	job := models.ImportJob{
+		ID:         primitive.NewObjectID(),
+		Status:     models.JobQueued,
+		FileName:   file.Filename,
+		UploadedBy: c.GetString("userId"),
+		Options:    opts,
+		CreatedAt:  time.Now(),
+	}
+	job.FilePath = filepath.Join(r.Dir, job.ID.Hex()+strings.ToLower(filepath.Ext(file.Filename)))
+	if err := c.SaveUploadedFile(file, job.FilePath); err != nil {
+		c.JSON(500, gin.H{"error": "ไม่สามารถบันทึกไฟล์ได้"})
+		return
+	}
+
+	f, err := os.Open(job.FilePath)
+	if err == nil {
+		job.FileHash, err = hashFile(f)
+		f.Close()
+	}
+	if err != nil {
+		os.Remove(job.FilePath)
+		c.JSON(500, gin.H{"error": "ไม่สามารถอ่านไฟล์ได้"})
+		return
+	}
+
+	if _, err := r.jobs().InsertOne(context.Background(), job); err != nil {
+		os.Remove(job.FilePath)
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	r.enqueue(job.ID)
+
+	c.JSON(202, gin.H{
+		"jobId":  job.ID.Hex(),
+		"status": job.Status,
+		"events": "/api/upload/jobs/" + job.ID.Hex() + "/events",
+		"report": "/api/upload/jobs/" + job.ID.Hex() + "/report",
+	})
+}
+
+// บันทึกความคืบหน้าของ job ลงฐานข้อมูล ไม่เกินทุก 500ms ยกเว้นเมื่อเปลี่ยนขั้นตอน
+// ไฟล์ถูกตรวจและบันทึกทีละ chunk ระหว่างอ่าน progress จึงวัดจากส่วนของไฟล์ที่อ่านแล้ว (สูงสุด 99 จนกว่า job จะจบ)
+// phase และ processed บอกขั้นตอนของ chunk ปัจจุบันและจำนวนแถวที่ตรวจแล้ว
+type jobTracker struct {
+	runner    *ImportJobRunner
+	id        primitive.ObjectID
+	mu        sync.Mutex
+	phase     string
+	processed int
+	progress  int
+	last      time.Time
+}
+
+// จำนวน byte ที่อ่านแล้วจาก countingReader
+func (t *jobTracker) read(done, size int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.phase == "" {
+		t.phase = models.PhaseParse
+	}
+	if size > 0 {
+		t.progress = int(min(99, 99*done/size))
+	}
+	t.save(false)
+}
+
+func (t *jobTracker) set(phase string, processed int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	changed := phase != t.phase
+	t.phase, t.processed = phase, processed
+	t.save(changed)
+}
+
+func (t *jobTracker) save(force bool) {
+	if !force && time.Since(t.last) < 500*time.Millisecond {
+		return
+	}
+	t.last = time.Now()
+	_, err := t.runner.jobs().UpdateOne(context.Background(), bson.M{"_id": t.id}, bson.M{"$set": bson.M{
+		"phase":     t.phase,
+		"processed": t.processed,
+		"progress":  t.progress,
+	}})
+	if err != nil {
+		log.Println("import job", t.id.Hex(), "progress:", err)
+	}
+}
+
+// นับจำนวน byte ที่อ่านแล้วเพื่อรายงานความคืบหน้า
+type countingReader struct {
+	r       io.Reader
+	read    int64
+	size    int64
+	tracker *jobTracker
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.read += int64(n)
+	c.tracker.read(c.read, c.size)
+	return n, err
+}
+
+func (r *ImportJobRunner) run(id primitive.ObjectID) {
+	ctx := context.Background()
+	now := time.Now()
+	var job models.ImportJob
+	// จอง job (เฉพาะที่ยังอยู่ในคิว) กันไม่ให้ worker สองตัวทำงานซ้ำ
+	err := r.jobs().FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "status": models.JobQueued},
+		bson.M{"$set": bson.M{"status": models.JobRunning, "startedAt": now}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&job)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Println("import job", id.Hex(), err)
+		}
+		return
+	}
+	defer os.Remove(job.FilePath)
+
+	report, batchID, err := r.process(ctx, job)
+	update := bson.M{
+		"status":     models.JobDone,
+		"finishedAt": time.Now(),
+		"batchId":    batchID,
+	}
+	if report != nil {
+		update["processed"], update["total"] = len(report.Rows), len(report.Rows)
+		if saveErr := r.saveReport(id, report); saveErr != nil {
+			log.Println("import job", id.Hex(), "report:", saveErr)
+			if err == nil {
+				err = fmt.Errorf("บันทึกรายงานผลไม่สำเร็จ: %w", saveErr)
+			}
+		} else {
+			update["hasReport"] = true
+		}
+	}
+	if err != nil {
+		update["status"] = models.JobFailed
+		update["error"] = err.Error()
+	} else {
+		update["progress"] = 100
+	}
+	if _, err := r.jobs().UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": update}); err != nil {
+		log.Println("import job", id.Hex(), "finish:", err)
+		r.markFailed(id, "บันทึกผลการนำเข้าไม่สำเร็จ: "+err.Error())
+	}
+}
+
+// ปิด job ที่บันทึกผลไม่สำเร็จเป็น failed (ลองซ้ำ) เพื่อไม่ให้ค้าง running และ SSE จบได้
+// ถ้ายังไม่สำเร็จ Start จะปิดให้ตอนรีสตาร์ต
+func (r *ImportJobRunner) markFailed(id primitive.ObjectID, reason string) {
+	for attempt := 0; attempt < 3; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * 2 * time.Second)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		_, err := r.jobs().UpdateOne(ctx, bson.M{"_id": id, "status": models.JobRunning}, bson.M{"$set": bson.M{
+			"status":     models.JobFailed,
+			"error":      reason,
+			"finishedAt": time.Now(),
+		}})
+		cancel()
+		if err == nil {
+			return
+		}
+		log.Println("import job", id.Hex(), "mark failed:", err)
+	}
+}
+
+// รายงานผลเก็บใน GridFS แยกจากเอกสาร job เพราะรายงานของไฟล์ใหญ่อาจเกินขนาดเอกสาร 16MB
+func (r *ImportJobRunner) reports() (*gridfs.Bucket, error) {
+	return gridfs.NewBucket(r.Uploads.DB, options.GridFSBucket().SetName("import_reports"))
+}
+
+func (r *ImportJobRunner) saveReport(id primitive.ObjectID, report *models.ImportReport) error {
+	bucket, err := r.reports()
+	if err != nil {
+		return err
+	}
+	stream, err := bucket.OpenUploadStreamWithID(id, id.Hex()+".json")
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(stream).Encode(report); err != nil {
+		stream.Abort()
+		return err
+	}
+	return stream.Close()
+}
+
+func (r *ImportJobRunner) process(ctx context.Context, job models.ImportJob) (report *models.ImportReport, batchID string, err error) {
+	// ไฟล์เสียหายที่ทำให้ตัวอ่าน panic → job ล้มเหลว แทนที่จะค้างสถานะ running
+	defer func() {
+		if p := recover(); p != nil {
+			log.Printf("import job %s: panic: %v\n%s", job.ID.Hex(), p, debug.Stack())
+			report, batchID, err = nil, "", fmt.Errorf("เกิดข้อผิดพลาดภายในระหว่างนำเข้า: %v", p)
+		}
+	}()
+	tracker := &jobTracker{runner: r, id: job.ID}
+
+	f, err := os.Open(job.FilePath)
+	if err != nil {
+		return nil, "", fmt.Errorf("ไม่พบไฟล์ที่อัปโหลด: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, "", err
+	}
+
+	reader := &countingReader{r: f, size: info.Size(), tracker: tracker}
+	source := importSource{FileName: job.FileName, FileHash: job.FileHash, UploadedBy: job.UploadedBy, Batch: models.BatchSourceUpload}
+	return r.Uploads.importFile(ctx, reader, source, job.Options, tracker.set)
+}
+
+// ที่มาของไฟล์ที่นำเข้าในเบื้องหลัง (บันทึกลง batch)
+type importSource struct {
+	FileName   string
+	FileHash   string
+	UploadedBy string
+	Batch      string // models.BatchSource*
+}
+
+// ไฟล์อ่านไม่ได้หรือรูปแบบไม่ถูกต้อง (HandleUpload ตอบ 400)
+type importParseError struct{ err error }
+
+func (e importParseError) Error() string {
+	return "อ่านไฟล์ไม่สำเร็จ: " + e.err.Error()
+}
+
+func (e importParseError) Unwrap() error {
+	return e.err
+}
+
+// แปลง → ตรวจ → บันทึกทีละ chunk → batch ใช้ร่วมกันทั้ง HandleUpload, import job และ watch folder
+// error ระหว่างทางยังคืน report และ batchId ของ chunk ที่บันทึกไปแล้วเพื่อ undo
+// (report เป็น nil เมื่อยังไม่มีแถวใดผ่านการตรวจ) progress = nil คือไม่รายงานความคืบหน้า
+func (h *UploadHandler) importFile(ctx context.Context, r io.Reader, source importSource, opts models.ImportOptions, progress phaseFunc) (*models.ImportReport, string, error) {
+	run := h.newImportRun(ctx, source, opts, progress)
+	sheets, err := h.parseUpload(ctx, r, source.FileName, opts, run.add)
+	if err == nil {
+		err = run.flush()
+	}
+	if err != nil && run.err == nil {
+		err = importParseError{err}
+	}
+
+	report := run.report
+	summarizeSheets(report, sheets)
+	if err != nil && len(report.Rows) == 0 {
+		report = nil
+	}
+	if opts.DryRun {
+		return report, "", err
+	}
+	batchID, batchErr := h.recordBatch(ctx, run.batch)
+	if err != nil {
+		return report, batchID, err
+	}
+	if batchErr != nil {
+		return report, "", fmt.Errorf("บันทึกประวัติการนำเข้าล้มเหลว: %w", batchErr)
+	}
+	return report, batchID, nil
+}
+
+// job และรายงานดูได้เฉพาะผู้อัปโหลดหรือ admin (admin ต้องผ่านสองขั้นตอนถ้ากำหนดไว้ เหมือน RequireRole)
+func canViewJob(c *gin.Context, job *models.ImportJob) bool {
+	if job.UploadedBy != "" && job.UploadedBy == c.GetString("userId") {
+		return true
+	}
+	role := c.GetString("role")
+	return role == "admin" && (!MFARequiredRoles[role] || c.GetBool("mfa"))
+}
+
+func (r *ImportJobRunner) findJob(ctx context.Context, c *gin.Context) (*models.ImportJob, bool) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid job ID"})
+		return nil, false
+	}
+	var job models.ImportJob
+	err = r.jobs().FindOne(ctx, bson.M{"_id": id}).Decode(&job)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(404, gin.H{"error": "ไม่พบ job"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if !canViewJob(c, &job) {
+		c.JSON(403, gin.H{"error": "ไม่มีสิทธิ์ดู job นี้"})
+		return nil, false
+	}
+	return &job, true
+}
+
+// GET /api/upload/jobs/:id — สถานะและความคืบหน้า (polling)
+func (r *ImportJobRunner) GetJob(c *gin.Context) {
+	job, ok := r.findJob(context.Background(), c)
+	if !ok {
+		return
+	}
+	c.JSON(200, job)
+}
+
+// GET /api/upload/jobs/:id/events — ส่งความคืบหน้าแบบ Server-Sent Events จนกว่า job จะจบ
+func (r *ImportJobRunner) Events(c *gin.Context) {
+	ctx := c.Request.Context()
+	job, ok := r.findJob(ctx, c)
+	if !ok {
+		return
+	}
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	last := ""
+	c.Stream(func(w io.Writer) bool {
+		key := fmt.Sprintf("%s/%s/%d", job.Status, job.Phase, job.Progress)
+		if key != last {
+			last = key
+			event := "progress"
+			if job.Status == models.JobDone || job.Status == models.JobFailed {
+				event = job.Status
+			}
+			c.SSEvent(event, job)
+		}
+		if job.Status == models.JobDone || job.Status == models.JobFailed {
+			return false
+		}
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+		var next models.ImportJob
+		err := r.jobs().FindOne(ctx, bson.M{"_id": job.ID}).Decode(&next)
+		if err != nil {
+			c.SSEvent("error", gin.H{"error": err.Error()})
+			return false
+		}
+		job = &next
+		return true
+	})
+}
+
+// GET /api/upload/jobs/:id/report — ดาวน์โหลดรายงานผล (ImportReport) ของ job ที่จบแล้ว
+// สถานะและ error ของ job ดูจาก GET /api/upload/jobs/:id
+func (r *ImportJobRunner) DownloadReport(c *gin.Context) {
+	job, ok := r.findJob(context.Background(), c)
+	if !ok {
+		return
+	}
+	if !job.HasReport {
+		c.JSON(409, gin.H{"error": "job ยังไม่มีรายงาน", "status": job.Status})
+		return
+	}
+
+	bucket, err := r.reports()
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	stream, err := bucket.OpenDownloadStream(job.ID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "อ่านรายงานไม่สำเร็จ: " + err.Error()})
+		return
+	}
+	defer stream.Close()
+
+	// ส่งต่อจาก GridFS โดยไม่โหลดทั้งก้อน
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="import-%s.json"`, job.ID.Hex()))
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.Header("Content-Length", strconv.FormatInt(stream.GetFile().Length, 10))
+	c.Status(200)
+	if _, err := io.Copy(c.Writer, stream); err != nil {
+		log.Println("import job", job.ID.Hex(), "report:", err)
+		abortConnection(c)
+	}
+}
+
+// ตัดการเชื่อมต่อเมื่อส่ง body ไม่ครบหลังส่ง header ไปแล้ว client จึงเห็นเป็น error แทนไฟล์ที่ขาดกลางทาง
+// (HTTP/2 ซึ่ง hijack ไม่ได้ อาศัย Content-Length ที่ไม่ตรงแทน)
+func abortConnection(c *gin.Context) {
+	c.Abort()
+	if conn, _, err := c.Writer.Hijack(); err == nil {
+		conn.Close()
+	}
+}
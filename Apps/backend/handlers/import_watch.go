@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"backend/models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// นำเข้าไฟล์ที่พาร์ทเนอร์วางไว้ในโฟลเดอร์ที่กำหนด (เปิดใช้เมื่อตั้ง IMPORT_WATCH_DIR)
+//
+//	<dir>/rates.csv                      ไฟล์ใหม่ (รอจนขนาดไม่เปลี่ยนหนึ่งรอบก่อนนำเข้า)
+//	<dir>/processing/<เวลา>_rates.csv     กำลังนำเข้า
+//	<dir>/done/<เวลา>_rates.csv          สำเร็จ พร้อม <เวลา>_rates.csv.report.json
+//	<dir>/failed/<เวลา>_rates.csv        ล้มเหลว พร้อมรายงานที่มีสาเหตุ
+type ImportWatcher struct {
+	Uploads  *UploadHandler
+	Dir      string
+	Interval time.Duration
+	Options  models.ImportOptions // ตัวเลือกเดียวกับ query ของ POST /api/upload (เช่น profile)
+	seen     map[string]watchedFile
+}
+
+const (
+	watchProcessing = "processing"
+	watchDone       = "done"
+	watchFailed     = "failed"
+)
+
+// ขนาดและเวลาแก้ไขจากการสแกนรอบก่อน ใช้ตรวจว่าไฟล์เขียนเสร็จแล้ว
+type watchedFile struct {
+	size    int64
+	modTime time.Time
+}
+
+// รายงานผลที่เขียนคู่กับไฟล์ใน done/ หรือ failed/
+type watchReport struct {
+	File       string               `json:"file"`
+	FileHash   string               `json:"fileHash,omitempty"`
+	Status     string               `json:"status"`
+	Error      string               `json:"error,omitempty"`
+	BatchID    string               `json:"batchId,omitempty"`
+	StartedAt  time.Time            `json:"startedAt"`
+	FinishedAt time.Time            `json:"finishedAt"`
+	Report     *models.ImportReport `json:"report,omitempty"`
+}
+
+func NewImportWatcher(uploads *UploadHandler, dir string, interval time.Duration) *ImportWatcher {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	return &ImportWatcher{
+		Uploads:  uploads,
+		Dir:      dir,
+		Interval: interval,
+		seen:     map[string]watchedFile{},
+	}
+}
+
+// สร้างโฟลเดอร์ย่อย ย้ายไฟล์ที่ค้างใน processing ไป failed แล้วเริ่มสแกนเป็นรอบ
+// ไฟล์ที่ค้างอาจเป็นสาเหตุที่โปรแกรมหยุดไป จึงไม่นำเข้าซ้ำอัตโนมัติ (วางไฟล์ใหม่ในโฟลเดอร์เพื่อลองอีกครั้ง)
+func (w *ImportWatcher) Start() {
+	for _, sub := range []string{watchProcessing, watchDone, watchFailed} {
+		if err := os.MkdirAll(filepath.Join(w.Dir, sub), 0o755); err != nil {
+			log.Println("import watch: disabled:", err)
+			return
+		}
+	}
+
+	entries, err := os.ReadDir(filepath.Join(w.Dir, watchProcessing))
+	if err != nil {
+		log.Println("import watch: disabled:", err)
+		return
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		w.abandon(e.Name())
+	}
+
+	log.Printf("import watch: watching %s every %s", w.Dir, w.Interval)
+	go func() {
+		ticker := time.NewTicker(w.Interval)
+		defer ticker.Stop()
+		for {
+			func() {
+				defer logPanic("import watch")
+				w.scan()
+			}()
+			<-ticker.C
+		}
+	}()
+}
+
+func (w *ImportWatcher) scan() {
+	entries, err := os.ReadDir(w.Dir)
+	if err != nil {
+		log.Println("import watch:", err)
+		return
+	}
+
+	present := map[string]bool{}
+	for _, e := range entries {
+		name := e.Name()
+		// ข้ามโฟลเดอร์ ไฟล์ซ่อน และไฟล์ล็อกของ Excel (~$...)
+		if e.IsDir() || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "~$") || !supportedImportFile(name) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		present[name] = true
+		current := watchedFile{size: info.Size(), modTime: info.ModTime()}
+		if prev, ok := w.seen[name]; !ok || prev != current {
+			// ไฟล์ใหม่หรือยังเขียนไม่เสร็จ รอรอบถัดไป
+			w.seen[name] = current
+			continue
+		}
+		delete(w.seen, name)
+		w.importOne(name)
+	}
+	for name := range w.seen {
+		if !present[name] {
+			delete(w.seen, name)
+		}
+	}
+}
+
+func (w *ImportWatcher) importOne(name string) {
+	started := time.Now()
+	stamped := started.Format("20060102-150405") + "_" + name
+	path := filepath.Join(w.Dir, watchProcessing, stamped)
+	if err := os.Rename(filepath.Join(w.Dir, name), path); err != nil {
+		log.Println("import watch:", name, err)
+		return
+	}
+
+	result := watchReport{File: name, StartedAt: started}
+	err := func() (err error) {
+		// ไฟล์ที่ทำให้ตัวอ่าน panic ไปอยู่ใน failed พร้อมรายงาน
+		defer func() {
+			if p := recover(); p != nil {
+				log.Printf("import watch: %s: panic: %v\n%s", name, p, debug.Stack())
+				result.Report, result.BatchID = nil, ""
+				err = fmt.Errorf("เกิดข้อผิดพลาดภายในระหว่างนำเข้า: %v", p)
+			}
+		}()
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if result.FileHash, err = hashFile(f); err != nil {
+			return err
+		}
+		source := importSource{FileName: name, FileHash: result.FileHash, Batch: models.BatchSourceWatch}
+		result.Report, result.BatchID, err = w.Uploads.importFile(context.Background(), f, source, w.Options, nil)
+		return err
+	}()
+
+	result.FinishedAt = time.Now()
+	result.Status = models.JobDone
+	dest := watchDone
+	if err != nil {
+		result.Status, result.Error, dest = models.JobFailed, err.Error(), watchFailed
+	}
+	target := filepath.Join(w.Dir, dest, stamped)
+	if err := os.Rename(path, target); err != nil {
+		log.Println("import watch:", name, err)
+		target = path
+	}
+	if err := writeWatchReport(target+".report.json", result); err != nil {
+		log.Println("import watch:", name, "report:", err)
+	}
+
+	if result.Report != nil {
+		log.Printf("import watch: %s %s (inserted %d, updated %d, unchanged %d, invalid %d, conflicts %d)",
+			name, result.Status, result.Report.Inserted, result.Report.Updated, result.Report.Unchanged,
+			result.Report.Invalid, len(result.Report.Conflicts))
+	} else {
+		log.Printf("import watch: %s %s: %s", name, result.Status, result.Error)
+	}
+}
+
+// ไฟล์ที่ค้างใน processing ตอนเริ่มโปรแกรม: ย้ายไป failed พร้อมรายงาน
+func (w *ImportWatcher) abandon(stamped string) {
+	_, original, _ := strings.Cut(stamped, "_")
+	if original == "" {
+		original = stamped
+	}
+	result := watchReport{
+		File:       original,
+		Status:     models.JobFailed,
+		Error:      "การนำเข้าไม่เสร็จเนื่องจากเซิร์ฟเวอร์หยุดทำงาน (ไฟล์นี้อาจเป็นสาเหตุ) วางไฟล์ในโฟลเดอร์อีกครั้งเพื่อนำเข้าใหม่",
+		FinishedAt: time.Now(),
+	}
+	if info, err := os.Stat(filepath.Join(w.Dir, watchProcessing, stamped)); err == nil {
+		result.StartedAt = info.ModTime()
+	}
+	target := filepath.Join(w.Dir, watchFailed, stamped)
+	if err := os.Rename(filepath.Join(w.Dir, watchProcessing, stamped), target); err != nil {
+		log.Println("import watch: recover", stamped, err)
+		return
+	}
+	if err := writeWatchReport(target+".report.json", result); err != nil {
+		log.Println("import watch:", stamped, "report:", err)
+	}
+	log.Printf("import watch: %s was still processing at startup, moved to %s", original, watchFailed)
+}
+
+func writeWatchReport(path string, report watchReport) error {
+	b, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o644)
+}
@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"backend/models"
+	"backend/services"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type InsuredHandler struct {
+	Collection *mongo.Collection
+}
+
+func NewInsuredHandler(db *mongo.Database) *InsuredHandler {
+	return &InsuredHandler{
+		Collection: db.Collection("insured_persons"),
+	}
+}
+
+type InsuredInput struct {
+	Name         string `json:"name" binding:"required"`
+	DateOfBirth  string `json:"dateOfBirth" binding:"required"` // YYYY-MM-DD
+	Gender       string `json:"gender" binding:"required"`
+	Relationship string `json:"relationship" binding:"required"`
+}
+
+// ตรวจและแปลงข้อมูลผู้เอาประกันจาก input
+func (in InsuredInput) toPerson() (models.InsuredPerson, error) {
+	dob, err := time.Parse("2006-01-02", strings.TrimSpace(in.DateOfBirth))
+	if err != nil {
+		return models.InsuredPerson{}, errors.New("วันเกิดต้องอยู่ในรูปแบบ YYYY-MM-DD")
+	}
+	if dob.After(time.Now()) {
+		return models.InsuredPerson{}, errors.New("วันเกิดต้องไม่เป็นวันในอนาคต")
+	}
+	gender, err := services.NormalizeGender(in.Gender)
+	if err != nil {
+		return models.InsuredPerson{}, err
+	}
+	relationship := strings.ToLower(strings.TrimSpace(in.Relationship))
+	valid := false
+	for _, r := range models.Relationships {
+		if r == relationship {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return models.InsuredPerson{}, errors.New("ความสัมพันธ์ต้องเป็น self, spouse, child หรือ parent")
+	}
+
+	return models.InsuredPerson{
+		Name:         strings.TrimSpace(in.Name),
+		DateOfBirth:  dob,
+		Gender:       gender,
+		Relationship: relationship,
+	}, nil
+}
+
+// ค้นหาผู้เอาประกันที่เป็นของ userId เท่านั้น
+func findInsured(ctx context.Context, collection *mongo.Collection, userID, insuredID string) (models.InsuredPerson, error) {
+	var person models.InsuredPerson
+	objID, err := primitive.ObjectIDFromHex(insuredID)
+	if err != nil {
+		return person, errors.New("invalid insured ID")
+	}
+	err = collection.FindOne(ctx, bson.M{"_id": objID, "userId": userID}).Decode(&person)
+	if err == mongo.ErrNoDocuments {
+		return person, errors.New("ไม่พบผู้เอาประกัน")
+	}
+	return person, err
+}
+
+// GET /api/insured
+func (h *InsuredHandler) List(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := h.Collection.Find(ctx, bson.M{"userId": c.GetString("userId")})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	persons := []models.InsuredPerson{}
+	if err := cursor.All(ctx, &persons); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, persons)
+}
+
+// POST /api/insured
+func (h *InsuredHandler) Create(c *gin.Context) {
+	var input InsuredInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	person, err := input.toPerson()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	userID := c.GetString("userId")
+	if person.Relationship == "self" {
+		count, err := h.Collection.CountDocuments(ctx, bson.M{"userId": userID, "relationship": "self"})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if count > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "มีข้อมูลผู้เอาประกันที่เป็นตัวเองอยู่แล้ว"})
+			return
+		}
+	}
+
+	now := time.Now()
+	person.UserID = userID
+	person.CreatedAt = now
+	person.UpdatedAt = now
+
+	result, err := h.Collection.InsertOne(ctx, person)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	person.ID = result.InsertedID.(primitive.ObjectID)
+
+	c.JSON(http.StatusCreated, person)
+}
+
+// PATCH /api/insured/:id
+func (h *InsuredHandler) Update(c *gin.Context) {
+	var input InsuredInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	person, err := input.toPerson()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	existing, err := findInsured(ctx, h.Collection, c.GetString("userId"), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, err = h.Collection.UpdateByID(ctx, existing.ID, bson.M{"$set": bson.M{
+		"name":         person.Name,
+		"dateOfBirth":  person.DateOfBirth,
+		"gender":       person.Gender,
+		"relationship": person.Relationship,
+		"updatedAt":    time.Now(),
+	}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Insured person updated"})
+}
+
+// DELETE /api/insured/:id
+func (h *InsuredHandler) Delete(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	existing, err := findInsured(ctx, h.Collection, c.GetString("userId"), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := h.Collection.DeleteOne(ctx, bson.M{"_id": existing.ID}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Insured person deleted"})
+}
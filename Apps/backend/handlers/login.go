@@ -2,8 +2,9 @@ package handlers
 
 import (
 	"backend/models"
-	"backend/utils"
+	"backend/services"
 	"context"
+	"log"
 	"net/http"
 	"strings"
 	"time"
@@ -28,7 +29,24 @@ func updateUserLoginStats(db *mongo.Database, userID primitive.ObjectID, c *gin.
 	)
 	return err
 }
-func LoginHandler(db *mongo.Database) gin.HandlerFunc {
+
+// บัญชีที่ตั้งรหัสผ่านไว้: สมัครด้วยชื่อผู้ใช้ หรือบัญชี LINE ที่เชื่อมรหัสผ่านแล้ว (ใช้เป็นค่าของ "password" ใน filter)
+var hasPassword = bson.M{"$exists": true, "$ne": ""}
+
+// hash ที่ใช้เทียบเมื่อไม่พบผู้ใช้ เพื่อให้เวลาตอบสนองใกล้เคียงกับกรณีรหัสผ่านผิด
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy-password"), 12)
+
+// เทียบรหัสผ่านหลัง NormalizePassword ถ้าไม่ตรงและค่าที่ส่งมามีช่องว่างหน้าหรือหลัง
+// เทียบค่าเดิมอีกครั้ง (บัญชีที่แฮชรหัสผ่านรวมช่องว่างไว้ก่อนมีการตัด)
+func passwordMatches(hash []byte, password string) bool {
+	normalized := services.NormalizePassword(password)
+	if bcrypt.CompareHashAndPassword(hash, []byte(normalized)) == nil {
+		return true
+	}
+	return normalized != password && bcrypt.CompareHashAndPassword(hash, []byte(password)) == nil
+}
+
+func LoginHandler(db *mongo.Database, guard *LoginGuard, mfa *TwoFactorHandler) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var input struct {
 			Username string `json:"username"`
@@ -40,7 +58,7 @@ func LoginHandler(db *mongo.Database) gin.HandlerFunc {
 		}
 
 		username := strings.TrimSpace(input.Username)
-		password := strings.TrimSpace(input.Password)
+		password := services.NormalizePassword(input.Password)
 
 		if username == "" || password == "" {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "ชื่อผู้ใช้และรหัสผ่านห้ามเว้นว่าง"})
@@ -50,40 +68,67 @@ func LoginHandler(db *mongo.Database) gin.HandlerFunc {
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
+		// จองการลองก่อนเทียบรหัสผ่าน: ถูกล็อก/ยังไม่พ้นช่วงรอ/โควตาถูกคำขอพร้อมกันจองหมด → ไม่ตรวจรหัสผ่านเลย
+		block, ok, err := guard.reserve(ctx, username, c.ClientIP())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "เกิดข้อผิดพลาดในการเข้าสู่ระบบ"})
+			return
+		}
+		if !ok {
+			respondLoginBlocked(c, block)
+			return
+		}
+
 		var user models.User
-		err := db.Collection("users").FindOne(ctx, bson.M{
+		err = db.Collection("users").FindOne(ctx, bson.M{
 			"username": username,
-			"provider": "local",
+			"password": hasPassword,
 		}).Decode(&user)
+		hash := []byte(user.Password)
 		if err != nil {
+			hash = dummyPasswordHash // ป้องกัน timing attack
+		}
+		if !passwordMatches(hash, input.Password) || err != nil {
 			// ไม่ระบุว่า username หรือ password ผิด เพื่อความปลอดภัย
-			time.Sleep(500 * time.Millisecond) // ป้องกัน timing attack
+			block, ferr := guard.recordFailure(ctx, c, username)
+			if ferr != nil {
+				log.Println("login guard:", ferr)
+			}
+			if block.locked {
+				respondLoginBlocked(c, block)
+				return
+			}
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "ชื่อผู้ใช้หรือรหัสผ่านไม่ถูกต้อง"})
 			return
 		}
+		guard.release(ctx, username, c.ClientIP())
 
-		err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
-		if err != nil {
-			time.Sleep(500 * time.Millisecond) // ลดความเร็ว brute-force
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "ชื่อผู้ใช้หรือรหัสผ่านไม่ถูกต้อง"})
+		// เปิด 2FA หรือ role บังคับ → ยังไม่ออก session จนกว่าจะผ่าน /api/login/2fa
+		// ตัวนับของบัญชียังไม่ล้าง (ล้างใน completeLogin) เพื่อให้รหัส 2FA ที่ผิดสะสมต่อจากรหัสผ่าน
+		if mfa.beginLogin(c, user) {
 			return
 		}
+		if err := guard.recordSuccess(ctx, username); err != nil {
+			log.Println("login guard:", err)
+		}
 
 		// อัปเดตข้อมูลการเข้าใช้งาน
 		_ = updateUserLoginStats(db, user.ID, c)
 
-		// สร้าง JWT Token
-		token, err := utils.GenerateJWT(user.ID.Hex(), user.Role)
+		// สร้าง access token + refresh token
+		tokens, _, err := issueSession(ctx, c, user.ID.Hex(), user.Role, "", false)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "ไม่สามารถสร้างโทเค็นได้"})
 			return
 		}
 
 		c.JSON(http.StatusOK, gin.H{
-			"token":    token,
-			"userId":   user.ID.Hex(),
-			"username": user.Username,
-			"role":     user.Role,
+			"token":        tokens.Token,
+			"refreshToken": tokens.RefreshToken,
+			"expiresIn":    tokens.ExpiresIn,
+			"userId":       user.ID.Hex(),
+			"username":     user.Username,
+			"role":         user.Role,
 		})
 	}
 }
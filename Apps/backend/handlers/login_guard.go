@@ -0,0 +1,381 @@
+package handlers
+
+import (
+	"backend/database"
+	"backend/models"
+	"backend/services"
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// จำกัดการเข้าสู่ระบบที่ผิดพลาดต่อบัญชีและต่อ IP
+// ตัวนับเก็บใน login_attempts เพื่อให้ทุก instance เห็นค่าเดียวกัน
+type LoginGuard struct {
+	DB      *mongo.Database
+	Account services.LoginThrottle
+	IP      services.LoginThrottle
+}
+
+func NewLoginGuard(db *mongo.Database) *LoginGuard {
+	return &LoginGuard{
+		DB:      db,
+		Account: services.DefaultAccountThrottle(),
+		IP:      services.DefaultIPThrottle(),
+	}
+}
+
+func (g *LoginGuard) attempts() *mongo.Collection {
+	return g.DB.Collection("login_attempts")
+}
+
+func (g *LoginGuard) EnsureIndexes(ctx context.Context) error {
+	_, err := g.attempts().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+func accountKey(username string) string {
+	return "user:" + strings.ToLower(strings.TrimSpace(username))
+}
+func ipKey(ip string) string { return "ip:" + ip }
+
+// ผลการตรวจก่อนเข้าสู่ระบบ
+type loginBlock struct {
+	locked bool
+	wait   time.Duration
+}
+
+// ระยะที่ถือว่าการจองค้าง (เทียบรหัสผ่านไม่เกินไม่กี่วินาที)
+const loginPendingTTL = time.Minute
+
+// จองการลองหนึ่งครั้งทั้งของบัญชีและ IP ก่อนเทียบรหัสผ่าน
+// ครั้งที่กำลังเทียบ (pending) นับรวมกับความผิดพลาด คำขอพร้อมกันจึงผ่านได้ไม่เกินโควตาที่เหลือ
+// ok = false → ถูกล็อก ยังไม่พ้นช่วงรอ หรือโควตาถูกจองหมด (ตอบด้วย block)
+// จองสำเร็จแล้วต้องปิดด้วย recordFailure หรือ release เสมอ
+func (g *LoginGuard) reserve(ctx context.Context, username, ip string) (loginBlock, bool, error) {
+	account, err := g.reserveKey(ctx, accountKey(username), g.Account)
+	if err != nil || !account {
+		return g.rejected(ctx, username, ip, err)
+	}
+	byIP, err := g.reserveKey(ctx, ipKey(ip), g.IP)
+	if err != nil || !byIP {
+		g.releaseKey(ctx, accountKey(username))
+		return g.rejected(ctx, username, ip, err)
+	}
+	return loginBlock{}, true, nil
+}
+
+func (g *LoginGuard) rejected(ctx context.Context, username, ip string, err error) (loginBlock, bool, error) {
+	if err != nil {
+		return loginBlock{}, false, err
+	}
+	block, err := g.check(ctx, username, ip)
+	if block.wait <= 0 {
+		block.wait = time.Second // มีการลองอื่นกำลังเทียบรหัสผ่านอยู่
+	}
+	return block, false, err
+}
+
+func (g *LoginGuard) reserveKey(ctx context.Context, key string, t services.LoginThrottle) (bool, error) {
+	now := time.Now()
+	if err := g.resetExpired(ctx, key, t, now); err != nil {
+		return false, err
+	}
+	if _, err := g.attempts().UpdateOne(ctx,
+		bson.M{"_id": key},
+		bson.M{"$setOnInsert": bson.M{"failures": 0, "pending": 0, "lockCount": 0, "expiresAt": now.Add(t.Window)}},
+		options.Update().SetUpsert(true),
+	); err != nil {
+		return false, err
+	}
+
+	inFlight := bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$failures", 0}}, bson.M{"$ifNull": bson.A{"$pending", 0}}}}
+	// ลองพร้อมกันได้เฉพาะครั้งที่ยังไม่ต้องรอ หลังจากนั้นทีละครั้ง (ครั้งถัดไปรอ nextAttemptAt)
+	conds := bson.A{bson.M{"$or": bson.A{
+		bson.M{"$lte": bson.A{inFlight, t.FreeAttempts}},
+		bson.M{"$eq": bson.A{bson.M{"$ifNull": bson.A{"$pending", 0}}, 0}},
+	}}}
+	if t.MaxFailures > 0 {
+		conds = append(conds, bson.M{"$lt": bson.A{inFlight, t.MaxFailures}})
+	}
+	res, err := g.attempts().UpdateOne(ctx,
+		bson.M{
+			"_id":           key,
+			"lockedUntil":   bson.M{"$not": bson.M{"$gt": now}},
+			"nextAttemptAt": bson.M{"$not": bson.M{"$gt": now}},
+			"$expr":         bson.M{"$and": conds},
+		},
+		bson.M{"$inc": bson.M{"pending": 1}, "$set": bson.M{"pendingAt": now}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount == 1, nil
+}
+
+// คืนการจองเมื่อรหัสผ่านถูก
+func (g *LoginGuard) release(ctx context.Context, username, ip string) {
+	g.releaseKey(ctx, accountKey(username))
+	g.releaseKey(ctx, ipKey(ip))
+}
+
+func (g *LoginGuard) releaseKey(ctx context.Context, key string) {
+	if _, err := g.attempts().UpdateOne(ctx,
+		bson.M{"_id": key, "pending": bson.M{"$gt": 0}},
+		bson.M{"$inc": bson.M{"pending": -1}},
+	); err != nil {
+		log.Println("login guard: release", key, err)
+	}
+}
+
+// เริ่มนับใหม่เมื่อผิดครั้งล่าสุดเก่ากว่า Window หรือพ้นช่วงล็อกแล้ว (lockCount ยังคงไว้)
+// และล้างการจองที่ค้างเกิน loginPendingTTL
+func (g *LoginGuard) resetExpired(ctx context.Context, key string, t services.LoginThrottle, now time.Time) error {
+	if _, err := g.attempts().UpdateOne(ctx,
+		bson.M{"_id": key, "$or": bson.A{
+			bson.M{"lastFailureAt": bson.M{"$lt": now.Add(-t.Window)}},
+			bson.M{"lockedUntil": bson.M{"$lte": now}},
+		}},
+		bson.M{"$set": bson.M{"failures": 0}, "$unset": bson.M{"lockedUntil": "", "nextAttemptAt": ""}},
+	); err != nil {
+		return err
+	}
+	_, err := g.attempts().UpdateOne(ctx,
+		bson.M{"_id": key, "pending": bson.M{"$gt": 0}, "pendingAt": bson.M{"$lt": now.Add(-loginPendingTTL)}},
+		bson.M{"$set": bson.M{"pending": 0}},
+	)
+	return err
+}
+
+// ถูกล็อกหรือยังไม่พ้นช่วงรอ (ใช้อธิบายเหตุที่จองไม่สำเร็จ)
+func (g *LoginGuard) check(ctx context.Context, username, ip string) (loginBlock, error) {
+	cursor, err := g.attempts().Find(ctx, bson.M{"_id": bson.M{"$in": []string{accountKey(username), ipKey(ip)}}})
+	if err != nil {
+		return loginBlock{}, err
+	}
+	var docs []models.LoginAttempt
+	if err := cursor.All(ctx, &docs); err != nil {
+		return loginBlock{}, err
+	}
+
+	now := time.Now()
+	var block loginBlock
+	for _, a := range docs {
+		if a.LockedUntil != nil && a.LockedUntil.After(now) {
+			block.locked = true
+			block.wait = max(block.wait, a.LockedUntil.Sub(now))
+		} else if a.NextAttemptAt != nil && a.NextAttemptAt.After(now) {
+			block.wait = max(block.wait, a.NextAttemptAt.Sub(now))
+		}
+	}
+	return block, nil
+}
+
+// บันทึกความผิดพลาดทั้งต่อบัญชีและต่อ IP แทนการจองของครั้งนี้ คืนค่าการบล็อกที่เกิดจากครั้งนี้ (ถ้ามี)
+func (g *LoginGuard) recordFailure(ctx context.Context, c *gin.Context, username string) (loginBlock, error) {
+	var block loginBlock
+	for _, target := range []struct {
+		key    string
+		policy services.LoginThrottle
+		event  string
+	}{
+		{accountKey(username), g.Account, models.EventAccountLocked},
+		{ipKey(c.ClientIP()), g.IP, models.EventIPLocked},
+	} {
+		a, locked, err := g.fail(ctx, target.key, target.policy, c.ClientIP())
+		if err != nil {
+			return block, err
+		}
+		if locked {
+			block.locked = true
+			block.wait = max(block.wait, a.LockedUntil.Sub(time.Now()))
+			log.Printf("auth: %s %s after %d failures (until %s)", target.event, target.key, a.Failures, a.LockedUntil.Format(time.RFC3339))
+			recordSecurityEvent(ctx, models.SecurityEvent{
+				Type:        target.event,
+				Username:    username,
+				IP:          c.ClientIP(),
+				UserAgent:   c.Request.UserAgent(),
+				Failures:    a.Failures,
+				LockedUntil: a.LockedUntil,
+			})
+		}
+	}
+	return block, nil
+}
+
+func (g *LoginGuard) fail(ctx context.Context, key string, t services.LoginThrottle, ip string) (*models.LoginAttempt, bool, error) {
+	now := time.Now()
+	if err := g.resetExpired(ctx, key, t, now); err != nil {
+		return nil, false, err
+	}
+
+	// การจองกลายเป็นความผิดพลาดในคำสั่งเดียว (ไม่มีช่วงที่โควตาว่างให้คำขออื่นแทรก)
+	var a models.LoginAttempt
+	err := g.attempts().FindOneAndUpdate(ctx,
+		bson.M{"_id": key},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{
+			"failures":      bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$failures", 0}}, 1}},
+			"pending":       bson.M{"$max": bson.A{0, bson.M{"$subtract": bson.A{bson.M{"$ifNull": bson.A{"$pending", 0}}, 1}}}},
+			"lastFailureAt": now,
+			"lastIp":        ip,
+		}}}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&a)
+	if err != nil {
+		return nil, false, err
+	}
+
+	set := bson.M{}
+	expires := now.Add(t.Window)
+	locked := false
+	if t.ShouldLock(a.Failures) && (a.LockedUntil == nil || !a.LockedUntil.After(now)) {
+		a.LockCount++
+		until := now.Add(t.LockFor(a.LockCount))
+		a.LockedUntil, locked = &until, true
+		set["lockCount"], set["lockedUntil"] = a.LockCount, until
+		expires = until
+	} else if d := t.Delay(a.Failures); d > 0 {
+		set["nextAttemptAt"] = now.Add(d)
+	}
+	// เก็บไว้นานพอให้การล็อกครั้งถัดไปนานขึ้น
+	set["expiresAt"] = expires.Add(t.MaxLockDuration)
+	if _, err := g.attempts().UpdateOne(ctx, bson.M{"_id": key}, bson.M{"$set": set}); err != nil {
+		return nil, false, err
+	}
+	return &a, locked, nil
+}
+
+// เข้าสู่ระบบสำเร็จ: ล้างตัวนับของบัญชี (ตัวนับของ IP ไม่ล้าง เพื่อไม่ให้บัญชีเดียวใช้รีเซ็ตการเดารหัสของบัญชีอื่น)
+func (g *LoginGuard) recordSuccess(ctx context.Context, username string) error {
+	_, err := g.attempts().DeleteOne(ctx, bson.M{"_id": accountKey(username)})
+	return err
+}
+
+// ตอบ 429 พร้อม Retry-After
+func respondLoginBlocked(c *gin.Context, block loginBlock) {
+	seconds := int(math.Ceil(block.wait.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	if block.locked {
+		minutes := int(math.Ceil(block.wait.Minutes()))
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":      fmt.Sprintf("เข้าสู่ระบบผิดหลายครั้ง ระงับการเข้าสู่ระบบชั่วคราว กรุณาลองใหม่ในอีก %d นาที", minutes),
+			"retryAfter": seconds,
+		})
+		return
+	}
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":      fmt.Sprintf("กรุณารอ %d วินาทีก่อนลองเข้าสู่ระบบอีกครั้ง", seconds),
+		"retryAfter": seconds,
+	})
+}
+
+// บันทึก security event (ล้มเหลวได้โดยไม่กระทบคำขอหลัก)
+func recordSecurityEvent(ctx context.Context, event models.SecurityEvent) {
+	if database.SecurityEventCollection == nil {
+		return
+	}
+	event.CreatedAt = time.Now()
+	if _, err := database.SecurityEventCollection.InsertOne(ctx, event); err != nil {
+		log.Println("security event:", err)
+	}
+}
+
+// GET /api/security/lockouts
+// บัญชีและ IP ที่กำลังถูกล็อก
+func (g *LoginGuard) ListLockouts(c *gin.Context) {
+	ctx := context.Background()
+	opts := options.Find().SetSort(bson.D{{Key: "lockedUntil", Value: -1}})
+	cursor, err := g.attempts().Find(ctx, bson.M{"lockedUntil": bson.M{"$gt": time.Now()}}, opts)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	lockouts := []models.LoginAttempt{}
+	if err := cursor.All(ctx, &lockouts); err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, lockouts)
+}
+
+// POST /api/security/lockouts/unlock
+// ปลดล็อกบัญชี (username) และ/หรือ IP และล้างตัวนับ
+func (g *LoginGuard) Unlock(c *gin.Context) {
+	var input struct {
+		Username string `json:"username"`
+		IP       string `json:"ip"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(400, gin.H{"error": "ข้อมูลไม่ถูกต้อง"})
+		return
+	}
+	input.Username, input.IP = strings.TrimSpace(input.Username), strings.TrimSpace(input.IP)
+	var keys []string
+	if input.Username != "" {
+		keys = append(keys, accountKey(input.Username))
+	}
+	if input.IP != "" {
+		keys = append(keys, ipKey(input.IP))
+	}
+	if len(keys) == 0 {
+		c.JSON(400, gin.H{"error": "ต้องระบุ username หรือ ip"})
+		return
+	}
+
+	ctx := context.Background()
+	res, err := g.attempts().DeleteMany(ctx, bson.M{"_id": bson.M{"$in": keys}})
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	if res.DeletedCount == 0 {
+		c.JSON(404, gin.H{"error": "ไม่พบการล็อกของบัญชีหรือ IP นี้"})
+		return
+	}
+	recordSecurityEvent(ctx, models.SecurityEvent{
+		Type:     models.EventUnlocked,
+		Username: input.Username,
+		IP:       input.IP,
+		Actor:    c.GetString("userId"),
+	})
+	c.JSON(200, gin.H{"message": "ปลดล็อกแล้ว", "cleared": res.DeletedCount})
+}
+
+// GET /api/security/events?type=account_locked&limit=100
+func (g *LoginGuard) ListEvents(c *gin.Context) {
+	limit, err := strconv.ParseInt(c.DefaultQuery("limit", "100"), 10, 64)
+	if err != nil || limit <= 0 {
+		c.JSON(400, gin.H{"error": "limit ไม่ถูกต้อง"})
+		return
+	}
+	filter := bson.M{}
+	if t := c.Query("type"); t != "" {
+		filter["type"] = t
+	}
+
+	ctx := context.Background()
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}).SetLimit(limit)
+	cursor, err := database.SecurityEventCollection.Find(ctx, filter, opts)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	events := []models.SecurityEvent{}
+	if err := cursor.All(ctx, &events); err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, events)
+}
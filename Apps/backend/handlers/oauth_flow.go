@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"backend/services"
+	"backend/utils"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+// ค่าที่เก็บใน session ระหว่าง redirect ไปยังผู้ให้บริการ (LINE หรือ OIDC) จนกลับมาที่ callback
+type oauthFlow struct {
+	Provider   string
+	State      string
+	Nonce      string
+	Verifier   string // PKCE code_verifier
+	LinkUserID string // ไม่ว่าง = ผูกกับบัญชีนี้แทนการเข้าสู่ระบบ
+}
+
+// code_challenge (S256) ที่ส่งไปกับ authorize URL
+func (f *oauthFlow) Challenge() string {
+	return services.PKCEChallenge(f.Verifier)
+}
+
+// สร้าง state/nonce/PKCE ใหม่และเก็บลง session (แทนที่ flow เดิมที่ยังไม่จบ)
+func startOAuthFlow(c *gin.Context, provider, linkUserID string) (*oauthFlow, error) {
+	verifier, _ := services.NewPKCE()
+	flow := &oauthFlow{
+		Provider:   provider,
+		State:      utils.GenerateSecureState(),
+		Nonce:      utils.GenerateSecureState(),
+		Verifier:   verifier,
+		LinkUserID: linkUserID,
+	}
+	session := sessions.Default(c)
+	session.Set("oauthProvider", flow.Provider)
+	session.Set("oauthState", flow.State)
+	session.Set("oauthNonce", flow.Nonce)
+	session.Set("oauthVerifier", flow.Verifier)
+	if linkUserID != "" {
+		session.Set("linkUserId", linkUserID)
+	} else {
+		session.Delete("linkUserId")
+	}
+	return flow, session.Save()
+}
+
+// ตรวจ state ใน query กับ session (CSRF) แล้วลบทิ้ง ใช้ได้ครั้งเดียว
+func finishOAuthFlow(c *gin.Context, provider string) (*oauthFlow, bool) {
+	session := sessions.Default(c)
+	get := func(key string) string {
+		v, _ := session.Get(key).(string)
+		return v
+	}
+	flow := &oauthFlow{
+		Provider:   get("oauthProvider"),
+		State:      get("oauthState"),
+		Nonce:      get("oauthNonce"),
+		Verifier:   get("oauthVerifier"),
+		LinkUserID: get("linkUserId"),
+	}
+	for _, key := range []string{"oauthProvider", "oauthState", "oauthNonce", "oauthVerifier", "linkUserId"} {
+		session.Delete(key)
+	}
+	_ = session.Save()
+
+	if flow.State == "" || c.Query("state") != flow.State || flow.Provider != provider {
+		return nil, false
+	}
+	return flow, true
+}
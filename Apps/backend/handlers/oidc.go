@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"backend/config"
+	"backend/database"
+	"backend/models"
+	"backend/services"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// เข้าสู่ระบบด้วยผู้ให้บริการ OIDC ที่ตั้งค่าใน OIDC_PROVIDERS (Google, Microsoft, Keycloak ฯลฯ)
+//
+//	GET    /api/auth/providers             รายชื่อผู้ให้บริการที่เปิดใช้ (สำหรับปุ่มในหน้า login)
+//	GET    /api/auth/login/:provider       redirect ไปยังผู้ให้บริการ (state + nonce + PKCE ใน session)
+//	GET    /api/auth/callback/:provider    ตรวจ ID token แล้ว redirect ไป FRONTEND_URL/login/success เหมือน LINE
+//	POST   /api/auth/link/:provider        (ต้องเข้าสู่ระบบ) ผูกผู้ให้บริการกับบัญชีปัจจุบัน
+//	DELETE /api/auth/link/:provider        (ต้องเข้าสู่ระบบ) ยกเลิกการผูก
+type OIDCHandler struct {
+	DB        *mongo.Database
+	Auth      *AuthHandler
+	Providers map[string]*services.OIDCProvider
+}
+
+func NewOIDCHandler(db *mongo.Database, auth *AuthHandler, providers []config.OIDCProviderConfig) *OIDCHandler {
+	h := &OIDCHandler{DB: db, Auth: auth, Providers: map[string]*services.OIDCProvider{}}
+	for _, p := range providers {
+		// line และ local เป็นชื่อของ route ที่มีอยู่แล้ว
+		if p.Name == "line" || p.Name == "local" || p.Issuer == "" || p.ClientID == "" {
+			log.Printf("oidc: provider %q skipped (reserved name or missing ISSUER/CLIENT_ID)", p.Name)
+			continue
+		}
+		h.Providers[p.Name] = &services.OIDCProvider{
+			Name:         p.Name,
+			Issuer:       p.Issuer,
+			ClientID:     p.ClientID,
+			ClientSecret: p.ClientSecret,
+			RedirectURL:  p.RedirectURI,
+			Scopes:       p.Scopes,
+		}
+	}
+	return h
+}
+
+var errOIDCAccountExists = errors.New("oidc: email belongs to another account")
+
+func (h *OIDCHandler) provider(c *gin.Context) (*services.OIDCProvider, bool) {
+	p, ok := h.Providers[c.Param("provider")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown login provider"})
+	}
+	return p, ok
+}
+
+// GET /api/auth/providers
+func (h *OIDCHandler) List(c *gin.Context) {
+	names := make([]string, 0, len(h.Providers))
+	for name := range h.Providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if h.Auth.Config.CHANNEL_ID != "" {
+		names = append([]string{"line"}, names...)
+	}
+	c.JSON(http.StatusOK, gin.H{"providers": names})
+}
+
+// GET /api/auth/login/:provider
+func (h *OIDCHandler) Login(c *gin.Context) {
+	h.redirectToProvider(c, "")
+}
+
+// POST /api/auth/link/:provider (ต้องเข้าสู่ระบบ) → url ที่ frontend ต้องเปิด (พร้อม cookie ของ session)
+func (h *OIDCHandler) Link(c *gin.Context) {
+	var user models.User
+	if err := database.UserCollection.FindOne(c.Request.Context(), userFilter(c.GetString("userId"))).Decode(&user); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	if provider := c.Param("provider"); user.HasIdentity(provider) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Account is already linked to " + provider})
+		return
+	}
+	h.redirectToProvider(c, user.ID.Hex())
+}
+
+func (h *OIDCHandler) redirectToProvider(c *gin.Context, linkUserID string) {
+	p, ok := h.provider(c)
+	if !ok {
+		return
+	}
+	flow, err := startOAuthFlow(c, p.Name, linkUserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save session"})
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+	authURL, err := p.AuthCodeURL(ctx, flow.State, flow.Nonce, flow.Challenge())
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Login provider is unavailable"})
+		return
+	}
+	if linkUserID != "" {
+		c.JSON(http.StatusOK, gin.H{"url": authURL})
+		return
+	}
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// GET /api/auth/callback/:provider
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	p, ok := h.provider(c)
+	if !ok {
+		return
+	}
+	flow, ok := finishOAuthFlow(c, p.Name)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid state (CSRF protection)"})
+		return
+	}
+	// ผู้ใช้กดยกเลิกหรือผู้ให้บริการปฏิเสธ
+	if e := c.Query("error"); e != "" {
+		if flow.LinkUserID != "" {
+			h.Auth.redirectLinkResult(c, p.Name, "error")
+			return
+		}
+		c.Redirect(http.StatusFound, fmt.Sprintf("%s/login?error=%s&provider=%s",
+			h.Auth.Config.FRONTEND_URL, url.QueryEscape(e), url.QueryEscape(p.Name)))
+		return
+	}
+	code := c.Query("code")
+	if code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing code from " + p.Name})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+	defer cancel()
+
+	tokens, err := p.Exchange(ctx, code, flow.Verifier)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to get token from " + p.Name})
+		return
+	}
+	identity, err := p.VerifyIDToken(ctx, tokens.IDToken, flow.Nonce)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid ID token"})
+		return
+	}
+
+	if flow.LinkUserID != "" {
+		h.finishLink(ctx, c, p.Name, flow.LinkUserID, identity)
+		return
+	}
+
+	user, err := h.findOrCreateUser(ctx, c, p.Name, identity)
+	if errors.Is(err, errOIDCAccountExists) {
+		// มีบัญชีที่ใช้อีเมลนี้อยู่แล้ว: ให้เข้าสู่ระบบบัญชีนั้นแล้วเชื่อมจากหน้าบัญชี (ไม่รวมบัญชีอัตโนมัติ)
+		c.Redirect(http.StatusFound, fmt.Sprintf("%s/login?error=account_exists&provider=%s",
+			h.Auth.Config.FRONTEND_URL, url.QueryEscape(p.Name)))
+		return
+	}
+	if err != nil {
+		log.Println("oidc login:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	session, _, err := issueSession(ctx, c, user.ID.Hex(), user.Role, "", false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate JWT"})
+		return
+	}
+	h.Auth.redirectLoginSuccess(c, user, session)
+}
+
+func (h *OIDCHandler) findOrCreateUser(ctx context.Context, c *gin.Context, provider string, id *services.OIDCIdentity) (models.User, error) {
+	users := h.DB.Collection("users")
+	var user models.User
+	err := users.FindOne(ctx, identityFilter(provider, id.Subject)).Decode(&user)
+	if err == nil {
+		if err := updateUserLoginStats(h.DB, user.ID, c); err != nil {
+			log.Println("login stats:", err)
+		}
+		return user, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return user, err
+	}
+
+	if id.Email != "" {
+		n, err := users.CountDocuments(ctx, bson.M{"email": id.Email})
+		if err != nil {
+			return user, err
+		}
+		if n > 0 {
+			return user, errOIDCAccountExists
+		}
+	}
+
+	now := time.Now()
+	user = models.User{
+		Username:     displayName(id),
+		Email:        id.Email,
+		Provider:     provider,
+		Role:         "user",
+		CreatedAt:    now,
+		UpdatedAt:    now,
+		LastLogin:    now,
+		LoginCount:   1,
+		LastIP:       c.ClientIP(),
+		LastDevice:   c.Request.UserAgent(),
+		IsActive:     true,
+		LastActivity: now,
+		Identities:   []models.Identity{{Provider: provider, Subject: id.Subject, Email: id.Email, LinkedAt: now}},
+	}
+	if id.Email != "" {
+		verified := id.EmailVerified
+		user.EmailVerified = &verified
+	}
+	res, err := users.InsertOne(ctx, user)
+	if isDuplicateEmail(err) {
+		return user, errOIDCAccountExists
+	}
+	if err != nil {
+		return user, err
+	}
+	user.ID = res.InsertedID.(primitive.ObjectID)
+	return user, nil
+}
+
+func displayName(id *services.OIDCIdentity) string {
+	for _, name := range []string{id.Name, id.Username, strings.Split(id.Email, "@")[0]} {
+		if name = strings.TrimSpace(name); name != "" {
+			return name
+		}
+	}
+	return id.Subject
+}
+
+func (h *OIDCHandler) finishLink(ctx context.Context, c *gin.Context, provider, userID string, id *services.OIDCIdentity) {
+	status := linkIdentity(ctx, userID, models.Identity{Provider: provider, Subject: id.Subject, Email: id.Email, LinkedAt: time.Now()})
+	h.Auth.redirectLinkResult(c, provider, status)
+}
+
+// DELETE /api/auth/link/:provider (ต้องเข้าสู่ระบบ)
+func (h *OIDCHandler) Unlink(c *gin.Context) {
+	provider := c.Param("provider")
+	unlinkIdentity(c, provider, provider)
+}
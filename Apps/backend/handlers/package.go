@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"backend/models"
+	"backend/services"
 	"context"
 	"fmt"
 	"net/http"
@@ -14,6 +15,25 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
+// filter สำหรับค้นหาแพ็กเกจ รองรับทั้ง ObjectID และ id แบบข้อความ (เช่น health-happy-kids-15m)
+func packageFilter(id string) bson.M {
+	if objID, err := primitive.ObjectIDFromHex(id); err == nil {
+		return bson.M{"_id": objID}
+	}
+	return bson.M{"id": id}
+}
+
+// ค้นหาแพ็กเกจจาก id (ObjectID หรือ id แบบข้อความ) หรือจากชื่อถ้าไม่ระบุ id
+func findPackage(ctx context.Context, db *mongo.Database, id, name string) (models.Package, error) {
+	var pkg models.Package
+	filter := bson.M{"name": name}
+	if id != "" {
+		filter = packageFilter(id)
+	}
+	err := db.Collection("packages").FindOne(ctx, filter).Decode(&pkg)
+	return pkg, err
+}
+
 func GetPackagesHandler(db *mongo.Database) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var results []models.Package
@@ -187,6 +207,12 @@ func CreatePackageHandler(db *mongo.Database) gin.HandlerFunc {
 			return
 		}
 
+		// ตรวจกฎการนับอายุ (last / nearest)
+		if !services.ValidAgeRule(newPackage.AgeRule) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "ageRule must be \"last\" or \"nearest\""})
+			return
+		}
+
 		// เรียงลำดับ pricing ตาม ageFrom (จากน้อยไปหามาก)
 		sort.SliceStable(newPackage.Pricing, func(i, j int) bool {
 			return newPackage.Pricing[i].AgeFrom < newPackage.Pricing[j].AgeFrom
@@ -432,11 +458,17 @@ func AddPromotionHandler(db *mongo.Database) gin.HandlerFunc {
 		}
 
 		// ตรวจสอบประเภทของโปรโมชั่น
-		if promotion.Type != "general" && promotion.Type != "package" && promotion.Type != "category" {
+		if promotion.Type != "general" && promotion.Type != "package" && promotion.Type != "category" && promotion.Type != "family" {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid promotion type"})
 			return
 		}
 
+		// โปรโมชั่นครอบครัวต้องมีผู้เอาประกันอย่างน้อย 2 คน
+		if promotion.Type == "family" && promotion.MinInsured < 2 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Family promotion requires minInsured of at least 2"})
+			return
+		}
+
 		// ตรวจสอบข้อมูลโปรโมชั่นเพิ่มเติม เช่น วันเริ่มต้นและสิ้นสุด
 		if promotion.ValidFrom == "" || promotion.ValidTo == "" {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Please provide valid dates"})
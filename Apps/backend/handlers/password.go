@@ -0,0 +1,311 @@
+package handlers
+
+import (
+	"backend/models"
+	"backend/services"
+	"backend/utils"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// อายุของลิงก์ตั้งรหัสผ่านใหม่ และระยะห่างขั้นต่ำระหว่างการขอซ้ำของบัญชีเดียวกัน
+const (
+	passwordResetTTL      = 30 * time.Minute
+	passwordResetCooldown = time.Minute
+)
+
+// ลืมรหัสผ่าน / ตั้งรหัสผ่านใหม่สำหรับผู้ใช้ local
+type PasswordHandler struct {
+	DB          *mongo.Database
+	Mailer      services.MailSender
+	FrontendURL string
+}
+
+func NewPasswordHandler(db *mongo.Database, mailer services.MailSender, frontendURL string) *PasswordHandler {
+	return &PasswordHandler{DB: db, Mailer: mailer, FrontendURL: strings.TrimRight(frontendURL, "/")}
+}
+
+func (h *PasswordHandler) resets() *mongo.Collection {
+	return h.DB.Collection("password_resets")
+}
+
+func (h *PasswordHandler) EnsureIndexes(ctx context.Context) error {
+	_, err := h.resets().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "tokenHash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "userId", Value: 1}}},
+		{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	return err
+}
+
+// POST /api/auth/password/forgot
+// ตอบเหมือนกันเสมอไม่ว่าจะพบบัญชีหรือไม่ เพื่อไม่ให้ใช้ตรวจว่ามีอีเมลนี้ในระบบ
+func (h *PasswordHandler) Forgot(c *gin.Context) {
+	var input struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "กรุณาระบุอีเมลให้ถูกต้อง"})
+		return
+	}
+
+	// ค้นหาบัญชี ออกโทเค็น และส่งอีเมลในเบื้องหลัง เวลาตอบกลับจึงไม่ต่างกันระหว่างอีเมลที่มี/ไม่มีบัญชี
+	email, ip := strings.TrimSpace(input.Email), c.ClientIP()
+	go func() {
+		defer logPanic("password reset")
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := h.issueReset(ctx, email, ip); err != nil {
+			log.Println("password reset:", err)
+		}
+	}()
+
+	c.JSON(http.StatusOK, gin.H{"message": "หากอีเมลนี้มีบัญชีอยู่ ระบบได้ส่งลิงก์ตั้งรหัสผ่านใหม่ไปแล้ว"})
+}
+
+// ออกโทเค็นและส่งอีเมลให้บัญชี local ของ email (ไม่พบบัญชีไม่ถือเป็น error)
+func (h *PasswordHandler) issueReset(ctx context.Context, email, ip string) error {
+	var account models.User
+	err := h.DB.Collection("users").FindOne(ctx, bson.M{"email": email, "password": hasPassword}).Decode(&account)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+
+	// ขอซ้ำถี่เกินไป: ไม่ส่งอีเมลใหม่
+	recent, err := h.resets().CountDocuments(ctx, bson.M{
+		"userId":    account.ID,
+		"createdAt": bson.M{"$gt": now.Add(-passwordResetCooldown)},
+	})
+	if err != nil || recent > 0 {
+		return err
+	}
+
+	token, err := utils.GenerateOneTimeToken()
+	if err != nil {
+		return err
+	}
+	// ลิงก์ก่อนหน้าที่ยังไม่ได้ใช้ถือเป็นโมฆะ
+	if _, err := h.resets().DeleteMany(ctx, bson.M{"userId": account.ID, "usedAt": bson.M{"$exists": false}}); err != nil {
+		return err
+	}
+	if _, err := h.resets().InsertOne(ctx, models.PasswordReset{
+		TokenHash: utils.HashToken(token),
+		UserID:    account.ID,
+		Email:     account.Email,
+		CreatedAt: now,
+		ExpiresAt: now.Add(passwordResetTTL),
+		IP:        ip,
+	}); err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/reset-password?token=%s", h.FrontendURL, url.QueryEscape(token))
+	mail := services.Mail{
+		To:      account.Email,
+		Subject: "ตั้งรหัสผ่านใหม่",
+		Body: fmt.Sprintf("สวัสดีคุณ %s\n\nมีคำขอตั้งรหัสผ่านใหม่สำหรับบัญชีของคุณ กดลิงก์ด้านล่างภายใน %d นาที:\n\n%s\n\nหากคุณไม่ได้ขอ ไม่ต้องดำเนินการใดๆ รหัสผ่านเดิมยังใช้ได้ตามปกติ\n",
+			account.Username, int(passwordResetTTL.Minutes()), link),
+	}
+	if err := h.Mailer.Send(ctx, mail); err != nil {
+		return fmt.Errorf("mail: %w", err)
+	}
+	return nil
+}
+
+// โทเค็นถูกใช้ไปแล้วระหว่างตรวจกับบันทึก (คำขอซ้ำพร้อมกัน)
+var errResetTokenUsed = errors.New("password reset token already used")
+
+// POST /api/auth/password/reset
+// ตั้งรหัสผ่านใหม่ด้วยโทเค็นจากอีเมล แล้วเพิกถอนทุก session ของบัญชี
+func (h *PasswordHandler) Reset(c *gin.Context) {
+	var input struct {
+		Token    string `json:"token" binding:"required"`
+		Password string `json:"password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ข้อมูลไม่ถูกต้อง"})
+		return
+	}
+	input.Password = services.NormalizePassword(input.Password)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tokenHash := utils.HashToken(strings.TrimSpace(input.Token))
+	var reset models.PasswordReset
+	err := h.resets().FindOne(ctx, bson.M{
+		"tokenHash": tokenHash,
+		"usedAt":    bson.M{"$exists": false},
+		"expiresAt": bson.M{"$gt": time.Now()},
+	}).Decode(&reset)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ลิงก์ตั้งรหัสผ่านไม่ถูกต้องหรือหมดอายุแล้ว"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "เกิดข้อผิดพลาดในการตั้งรหัสผ่าน"})
+		return
+	}
+
+	var account models.User
+	if err := h.DB.Collection("users").FindOne(ctx, bson.M{"_id": reset.UserID}).Decode(&account); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ลิงก์ตั้งรหัสผ่านไม่ถูกต้องหรือหมดอายุแล้ว"})
+		return
+	}
+	if rejectWeakPassword(c, input.Password, account.Username, account.Email) {
+		return
+	}
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(input.Password), 12)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ไม่สามารถตั้งรหัสผ่านใหม่ได้"})
+		return
+	}
+
+	// ใช้โทเค็นได้ครั้งเดียว: จองโทเค็นและบันทึกรหัสผ่านใน transaction เดียวกัน
+	// ถ้าบันทึกรหัสผ่านไม่สำเร็จโทเค็นยังไม่ถูกใช้ กดลิงก์เดิมซ้ำได้
+	session, err := h.DB.Client().StartSession()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ไม่สามารถตั้งรหัสผ่านใหม่ได้"})
+		return
+	}
+	defer session.EndSession(ctx)
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		res, err := h.resets().UpdateOne(sc,
+			bson.M{"_id": reset.ID, "usedAt": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"usedAt": time.Now()}},
+		)
+		if err != nil {
+			return nil, err
+		}
+		if res.ModifiedCount == 0 {
+			return nil, errResetTokenUsed
+		}
+		return nil, h.savePasswordHash(sc, account.ID, hashed)
+	})
+	if errors.Is(err, errResetTokenUsed) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ลิงก์ตั้งรหัสผ่านไม่ถูกต้องหรือหมดอายุแล้ว"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ไม่สามารถตั้งรหัสผ่านใหม่ได้"})
+		return
+	}
+	if err := revokeUserSessions(ctx, account.ID.Hex(), models.RevokeReset, ""); err != nil {
+		log.Println("password reset: revoke sessions:", err)
+	}
+	recordSecurityEvent(ctx, models.SecurityEvent{
+		Type:      models.EventPasswordReset,
+		Username:  account.Username,
+		UserID:    account.ID.Hex(),
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "ตั้งรหัสผ่านใหม่แล้ว กรุณาเข้าสู่ระบบอีกครั้ง"})
+}
+
+// POST /api/auth/password/change (ต้องเข้าสู่ระบบ)
+// เปลี่ยนรหัสผ่านด้วยรหัสผ่านเดิม แล้วเพิกถอน session อื่นทั้งหมด (session ปัจจุบันยังใช้ต่อได้)
+func (h *PasswordHandler) Change(c *gin.Context) {
+	var input struct {
+		CurrentPassword string `json:"currentPassword" binding:"required"`
+		NewPassword     string `json:"newPassword" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ข้อมูลไม่ถูกต้อง"})
+		return
+	}
+	input.NewPassword = services.NormalizePassword(input.NewPassword)
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "บัญชีนี้ไม่มีรหัสผ่าน"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var account models.User
+	if err := h.DB.Collection("users").FindOne(ctx, bson.M{"_id": userID, "password": hasPassword}).Decode(&account); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "ไม่พบผู้ใช้"})
+		return
+	}
+	if !passwordMatches([]byte(account.Password), input.CurrentPassword) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "รหัสผ่านเดิมไม่ถูกต้อง"})
+		return
+	}
+	if input.NewPassword == services.NormalizePassword(input.CurrentPassword) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "รหัสผ่านใหม่ต้องไม่ซ้ำกับรหัสผ่านเดิม"})
+		return
+	}
+	if rejectWeakPassword(c, input.NewPassword, account.Username, account.Email) {
+		return
+	}
+
+	if err := h.setPassword(ctx, account.ID, input.NewPassword); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ไม่สามารถเปลี่ยนรหัสผ่านได้"})
+		return
+	}
+	if err := revokeUserSessions(ctx, account.ID.Hex(), models.RevokePasswordChange, c.GetString("sid")); err != nil {
+		log.Println("password change: revoke sessions:", err)
+	}
+	recordSecurityEvent(ctx, models.SecurityEvent{
+		Type:      models.EventPasswordChanged,
+		Username:  account.Username,
+		UserID:    account.ID.Hex(),
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "เปลี่ยนรหัสผ่านแล้ว อุปกรณ์อื่นจะต้องเข้าสู่ระบบใหม่"})
+}
+
+// ตอบ 400 พร้อมรายการกฎที่ไม่ผ่าน (ข้อความตาม Accept-Language) คืน true เมื่อรหัสผ่านไม่ผ่านนโยบาย
+func rejectWeakPassword(c *gin.Context, password, username, email string) bool {
+	failed := services.ValidatePassword(password, username, email)
+	if len(failed) == 0 {
+		return false
+	}
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error": "รหัสผ่านไม่ตรงตามนโยบาย",
+		"code":  "weak_password",
+		"rules": services.DescribePasswordRules(failed, c.GetHeader("Accept-Language")),
+	})
+	return true
+}
+
+func (h *PasswordHandler) setPassword(ctx context.Context, userID primitive.ObjectID, password string) error {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	if err != nil {
+		return err
+	}
+	return h.savePasswordHash(ctx, userID, hashed)
+}
+
+func (h *PasswordHandler) savePasswordHash(ctx context.Context, userID primitive.ObjectID, hashed []byte) error {
+	now := time.Now()
+	_, err := h.DB.Collection("users").UpdateOne(ctx, bson.M{"_id": userID}, bson.M{"$set": bson.M{
+		"password":          string(hashed),
+		"passwordChangedAt": now,
+		"updatedAt":         now,
+	}})
+	return err
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"backend/models"
+	"backend/services"
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// GET /api/packages/:id/projection?dateOfBirth=1995-04-01&gender=male&targetAge=60&inflation=0.03&medicalTrend=0.05
+// อายุคำนวณจาก dateOfBirth ณ startDate (ค่าว่าง = วันนี้) ตามกฎของแพ็กเกจ
+// หรือส่ง age (อายุทางประกันภัยที่คำนวณไว้แล้ว) แทน dateOfBirth ได้ ถ้าส่งทั้งคู่ใช้ dateOfBirth
+func PremiumProjectionHandler(db *mongo.Database) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var dob, startDate time.Time
+		var age int
+		var err error
+		switch {
+		case c.Query("dateOfBirth") != "":
+			if dob, err = services.ParseDate(c.Query("dateOfBirth")); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if startDate, err = services.ParseDate(c.Query("startDate")); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		case c.Query("age") != "":
+			if age, err = strconv.Atoi(c.Query("age")); err != nil || age < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid age"})
+				return
+			}
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "dateOfBirth or age is required"})
+			return
+		}
+
+		opt := services.ProjectionOptions{}
+		if v := c.Query("targetAge"); v != "" {
+			if opt.TargetAge, err = strconv.Atoi(v); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid targetAge"})
+				return
+			}
+		}
+		if v := c.Query("inflation"); v != "" {
+			if opt.InflationRate, err = strconv.ParseFloat(v, 64); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid inflation"})
+				return
+			}
+		}
+		if v := c.Query("medicalTrend"); v != "" {
+			if opt.MedicalTrend, err = strconv.ParseFloat(v, 64); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid medicalTrend"})
+				return
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		var pkg models.Package
+		err = db.Collection("packages").FindOne(ctx, packageFilter(c.Param("id"))).Decode(&pkg)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "package not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if !dob.IsZero() {
+			if age, err = services.InsuranceAge(dob, startDate, pkg.AgeRule); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		projection, err := services.ProjectPremium(pkg, c.Query("gender"), age, opt)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, projection)
+	}
+}
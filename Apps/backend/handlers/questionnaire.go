@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"backend/models"
+	"backend/services"
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type QuestionnaireHandler struct {
+	DB *mongo.Database
+}
+
+func NewQuestionnaireHandler(db *mongo.Database) *QuestionnaireHandler {
+	return &QuestionnaireHandler{DB: db}
+}
+
+// GET /api/questionnaires/active
+func (h *QuestionnaireHandler) GetActive(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var q models.Questionnaire
+	opts := options.FindOne().SetSort(bson.M{"updatedAt": -1})
+	err := h.DB.Collection("questionnaires").FindOne(ctx, bson.M{"active": true}, opts).Decode(&q)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "ยังไม่มีแบบสอบถามที่เปิดใช้งาน"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, q)
+}
+
+// POST /api/questionnaires (admin)
+func (h *QuestionnaireHandler) Create(c *gin.Context) {
+	var q models.Questionnaire
+	if err := c.ShouldBindJSON(&q); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if q.Name == "" || len(q.Questions) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ต้องระบุชื่อและคำถามอย่างน้อย 1 ข้อ"})
+		return
+	}
+
+	keys := map[string]bool{}
+	for _, question := range q.Questions {
+		if question.Key == "" || keys[question.Key] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "key ของคำถามต้องไม่ว่างและไม่ซ้ำกัน"})
+			return
+		}
+		keys[question.Key] = true
+	}
+	for _, rule := range q.Rules {
+		if !keys[rule.Question] || rule.Category == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "กฎต้องอ้างถึงคำถามที่มีอยู่และระบุ category"})
+			return
+		}
+		if !services.ValidRuleOperator(rule.Operator) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "operator ของกฎต้องเป็น eq, ne, gt, gte, lt, lte หรือ contains"})
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	q.ID = primitive.NilObjectID
+	q.CreatedAt = now
+	q.UpdatedAt = now
+
+	collection := h.DB.Collection("questionnaires")
+	if q.Active {
+		// เปิดใช้งานได้ทีละชุด
+		if _, err := collection.UpdateMany(ctx, bson.M{"active": true}, bson.M{"$set": bson.M{"active": false}}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	result, err := collection.InsertOne(ctx, q)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ไม่สามารถบันทึกแบบสอบถามได้"})
+		return
+	}
+	q.ID = result.InsertedID.(primitive.ObjectID)
+
+	c.JSON(http.StatusCreated, q)
+}
+
+// POST /api/questionnaires/:id/answers
+func (h *QuestionnaireHandler) SubmitAnswers(c *gin.Context) {
+	qID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid questionnaire ID"})
+		return
+	}
+
+	var input struct {
+		Answers map[string]interface{} `json:"answers" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var q models.Questionnaire
+	if err := h.DB.Collection("questionnaires").FindOne(ctx, bson.M{"_id": qID}).Decode(&q); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "ไม่พบแบบสอบถาม"})
+		return
+	}
+
+	answers, err := services.ValidateAnswers(q, input.Answers)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cursor, err := h.DB.Collection("packages").Find(ctx, bson.M{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	var catalog []models.Package
+	if err := cursor.All(ctx, &catalog); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	assessment := models.NeedsAssessment{
+		UserID:          c.GetString("userId"),
+		QuestionnaireID: q.ID,
+		Answers:         answers,
+		Recommendations: services.ScoreNeeds(q, answers, catalog),
+		CreatedAt:       time.Now(),
+	}
+
+	result, err := h.DB.Collection("needs_assessments").InsertOne(ctx, assessment)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ไม่สามารถบันทึกผลการประเมินได้"})
+		return
+	}
+	assessment.ID = result.InsertedID.(primitive.ObjectID)
+
+	// เก็บผลล่าสุดไว้กับ user เพื่อให้ตัวแทนติดตามต่อได้
+	_, err = h.DB.Collection("users").UpdateOne(ctx, userFilter(assessment.UserID), bson.M{
+		"$set": bson.M{"needsAnalysis": assessment},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, assessment)
+}
+
+// GET /api/needs-analysis — ผลล่าสุดของผู้ใช้ที่ล็อกอิน
+func (h *QuestionnaireHandler) GetMyAssessment(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var assessment models.NeedsAssessment
+	opts := options.FindOne().SetSort(bson.M{"createdAt": -1})
+	err := h.DB.Collection("needs_assessments").FindOne(ctx, bson.M{"userId": c.GetString("userId")}, opts).Decode(&assessment)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "ยังไม่มีผลการประเมิน"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, assessment)
+}
+
+// GET /api/needs-analyses?userId=xxx (admin) — รายการผลประเมินสำหรับตัวแทนติดตาม
+func (h *QuestionnaireHandler) ListAssessments(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if userID := c.Query("userId"); userID != "" {
+		filter["userId"] = userID
+	}
+
+	opts := options.Find().SetSort(bson.M{"createdAt": -1}).SetLimit(200)
+	cursor, err := h.DB.Collection("needs_assessments").Find(ctx, filter, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	assessments := []models.NeedsAssessment{}
+	if err := cursor.All(ctx, &assessments); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, assessments)
+}
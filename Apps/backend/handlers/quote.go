@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"backend/models"
+	"backend/services"
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type FamilyQuoteItem struct {
+	InsuredID   string `json:"insuredId" binding:"required"`
+	PackageID   string `json:"packageId"`
+	PackageName string `json:"packageName"`
+}
+
+type FamilyQuoteInput struct {
+	Items         []FamilyQuoteItem `json:"items" binding:"required"`
+	PromotionName string            `json:"promotionName"`
+	StartDate     string            `json:"startDate"` // วันเริ่มคุ้มครอง (ค่าว่าง = วันนี้)
+}
+
+// POST /api/quotes/family
+func FamilyQuoteHandler(db *mongo.Database) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input FamilyQuoteInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if len(input.Items) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "ต้องมีผู้เอาประกันอย่างน้อย 1 คน"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		startDate, err := services.ParseDate(input.StartDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		userID := c.GetString("userId")
+		insured := db.Collection("insured_persons")
+
+		var members []models.FamilyQuoteMember
+		for _, item := range input.Items {
+			person, err := findInsured(ctx, insured, userID, item.InsuredID)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "insuredId": item.InsuredID})
+				return
+			}
+			pkg, err := findPackage(ctx, db, item.PackageID, item.PackageName)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "ไม่พบแพ็กเกจ", "insuredId": item.InsuredID})
+				return
+			}
+			members = append(members, services.QuoteMember(person, pkg, startDate))
+		}
+
+		quote := services.SummarizeFamily(members)
+
+		if input.PromotionName != "" {
+			var promotion models.Promotion
+			err := db.Collection("promotions").FindOne(ctx, bson.M{"name": input.PromotionName}).Decode(&promotion)
+			if err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Promotion not found"})
+				return
+			}
+			if err := ApplyQuotePromotion(&quote, promotion, time.Now()); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		c.JSON(http.StatusOK, quote)
+	}
+}
+
+type EligibilityInput struct {
+	PackageID   string `json:"packageId"`
+	PackageName string `json:"packageName"`
+	DateOfBirth string `json:"dateOfBirth" binding:"required"` // YYYY-MM-DD
+	Gender      string `json:"gender" binding:"required"`
+	StartDate   string `json:"startDate"` // วันเริ่มคุ้มครอง (ค่าว่าง = วันนี้)
+}
+
+// POST /api/eligibility — ตรวจสิทธิ์และคำนวณอายุทางประกันภัยจากวันเกิดตามกฎของแพ็กเกจ
+func EligibilityHandler(db *mongo.Database) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input EligibilityInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		dob, err := services.ParseDate(input.DateOfBirth)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		startDate, err := services.ParseDate(input.StartDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		pkg, err := findPackage(ctx, db, input.PackageID, input.PackageName)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "package not found"})
+			return
+		}
+
+		member := services.QuoteMember(models.InsuredPerson{DateOfBirth: dob, Gender: input.Gender}, pkg, startDate)
+		ageRule := pkg.AgeRule
+		if ageRule == "" {
+			ageRule = services.AgeRuleLastBirthday
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"packageName": pkg.Name,
+			"ageRule":     ageRule,
+			"startDate":   startDate.Format("2006-01-02"),
+			"age":         member.Age,
+			"eligible":    member.Eligible,
+			"annual":      member.Annual,
+			"reason":      member.Reason,
+		})
+	}
+}
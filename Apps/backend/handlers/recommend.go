@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"backend/models"
+	"backend/services"
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type RecommendInput struct {
+	Age         int      `json:"age"`
+	DateOfBirth string   `json:"dateOfBirth"` // YYYY-MM-DD ถ้าระบุจะใช้แทน age
+	StartDate   string   `json:"startDate"`
+	Gender      string   `json:"gender" binding:"required"`
+	Budget      float64  `json:"budget" binding:"required"`
+	Categories  []string `json:"categories"` // เรียงตามความสำคัญ
+	Limit       int      `json:"limit"`
+}
+
+// POST /api/recommendations
+func RecommendHandler(db *mongo.Database) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input RecommendInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		req := services.RecommendRequest{
+			Age:        input.Age,
+			Gender:     input.Gender,
+			Budget:     input.Budget,
+			Categories: input.Categories,
+			Limit:      input.Limit,
+		}
+		if input.DateOfBirth != "" {
+			var err error
+			if req.DateOfBirth, err = services.ParseDate(input.DateOfBirth); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if req.StartDate, err = services.ParseDate(input.StartDate); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		cursor, err := db.Collection("packages").Find(ctx, bson.M{})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		var pkgs []models.Package
+		if err := cursor.All(ctx, &pkgs); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		bundles, err := services.RecommendBundles(pkgs, req)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if bundles == nil {
+			bundles = []models.Bundle{}
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"budget":  input.Budget,
+			"bundles": bundles,
+		})
+	}
+}
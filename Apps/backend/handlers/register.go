@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"backend/models"
+	"backend/services"
 	"context"
 	"log"
 	"net/http"
@@ -9,6 +11,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -19,30 +22,14 @@ type RegisterInput struct {
 	Password string `json:"password" binding:"required"`
 }
 
-type User struct {
-	Username  string    `bson:"username"`
-	Email     string    `bson:"email"`
-	Password  string    `bson:"password"`
-	Role      string    `bson:"role"`
-	Provider  string    `bson:"provider"`
-	CreatedAt time.Time `bson:"createdAt"`
-
-	// ข้อมูลพฤติกรรม/การใช้งาน
-	LastLogin    time.Time `bson:"lastLogin"`
-	LoginCount   int       `bson:"loginCount"`
-	LastIP       string    `bson:"lastIP"`
-	LastDevice   string    `bson:"lastDevice"`
-	IsActive     bool      `bson:"isActive"`
-	LastActivity time.Time `bson:"lastActivity"`
-}
-
-func RegisterHandler(db *mongo.Database) gin.HandlerFunc {
+func RegisterHandler(db *mongo.Database, verifier *EmailVerifier) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var input RegisterInput
 		if err := c.ShouldBindJSON(&input); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "ข้อมูลไม่ถูกต้อง"})
 			return
 		}
+		input.Password = services.NormalizePassword(input.Password)
 
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
@@ -50,7 +37,7 @@ func RegisterHandler(db *mongo.Database) gin.HandlerFunc {
 		userCol := db.Collection("users")
 
 		// ตรวจสอบ username ซ้ำ
-		var existingUser User
+		var existingUser models.User
 		if err := userCol.FindOne(ctx, bson.M{"username": strings.TrimSpace(input.Username)}).Decode(&existingUser); err == nil {
 			c.JSON(http.StatusConflict, gin.H{"error": "ชื่อผู้ใช้นี้มีอยู่แล้ว"})
 			return
@@ -62,6 +49,11 @@ func RegisterHandler(db *mongo.Database) gin.HandlerFunc {
 			return
 		}
 
+		// ตรวจนโยบายรหัสผ่าน
+		if rejectWeakPassword(c, input.Password, input.Username, input.Email) {
+			return
+		}
+
 		// แฮชรหัสผ่าน
 		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), 12)
 		if err != nil {
@@ -70,26 +62,43 @@ func RegisterHandler(db *mongo.Database) gin.HandlerFunc {
 		}
 
 		now := time.Now()
-		newUser := User{
-			Username:     input.Username,
-			Email:        input.Email,
-			Password:     string(hashedPassword),
-			Provider:     "local",
-			Role:         "user",
-			CreatedAt:    now,
-			LastLogin:    now,
-			LastActivity: now,
-			LoginCount:   0,
-			IsActive:     true,
+		verified := false
+		newUser := models.User{
+			Username:      strings.TrimSpace(input.Username),
+			Email:         strings.TrimSpace(input.Email),
+			Password:      string(hashedPassword),
+			Provider:      models.ProviderLocal,
+			Role:          "user",
+			CreatedAt:     now,
+			UpdatedAt:     now,
+			LastLogin:     now,
+			LastActivity:  now,
+			LoginCount:    0,
+			IsActive:      true,
+			EmailVerified: &verified, // false จนกว่าจะกดลิงก์ยืนยันในอีเมล
 		}
 
-		_, err = userCol.InsertOne(ctx, newUser)
+		res, err := userCol.InsertOne(ctx, newUser)
+		if msg, dup := duplicateUserMessage(err); dup {
+			c.JSON(http.StatusConflict, gin.H{"error": msg})
+			return
+		}
 		if err != nil {
 			log.Println("Register error:", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "เกิดข้อผิดพลาดในการสมัคร"})
 			return
 		}
 
-		c.JSON(http.StatusCreated, gin.H{"message": "สมัครสมาชิกสำเร็จ"})
+		// ส่งลิงก์ยืนยันอีเมล (ส่งไม่สำเร็จยังขอใหม่ได้ที่ /api/auth/email/resend)
+		if id, ok := res.InsertedID.(primitive.ObjectID); ok {
+			if err := verifier.send(ctx, id, newUser.Username, newUser.Email); err != nil {
+				log.Println("Register verification mail:", err)
+			}
+		}
+
+		c.JSON(http.StatusCreated, gin.H{
+			"message":       "สมัครสมาชิกสำเร็จ กรุณายืนยันอีเมลจากลิงก์ที่ส่งไป",
+			"emailVerified": false,
+		})
 	}
 }
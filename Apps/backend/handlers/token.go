@@ -0,0 +1,286 @@
+package handlers
+
+import (
+	"backend/database"
+	"backend/models"
+	"backend/utils"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// โทเค็นที่ส่งกลับเมื่อเข้าสู่ระบบหรือ refresh
+type sessionTokens struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+	ExpiresIn    int    `json:"expiresIn"` // วินาที (อายุ access token)
+}
+
+var errRefreshInvalid = errors.New("refresh token ไม่ถูกต้องหรือหมดอายุ")
+
+// สร้าง index ของ refresh_tokens และ revoked_tokens (TTL ลบรายการที่หมดอายุเอง)
+func EnsureTokenIndexes(ctx context.Context) error {
+	if _, err := database.RefreshTokenCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "tokenHash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "familyId", Value: 1}}},
+		{Keys: bson.D{{Key: "userId", Value: 1}}},
+		{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	}); err != nil {
+		return err
+	}
+	_, err := database.RevokedTokenCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+// ออก access token และ refresh token ใหม่ familyID ว่าง = เริ่ม family ใหม่ (เข้าสู่ระบบ)
+// mfa ส่งต่อไปทุก token ใน family
+func issueSession(ctx context.Context, c *gin.Context, userID, role, familyID string, mfa bool) (*sessionTokens, primitive.ObjectID, error) {
+	if familyID == "" {
+		familyID = primitive.NewObjectID().Hex()
+	}
+	refresh, err := utils.GenerateRefreshToken()
+	if err != nil {
+		return nil, primitive.NilObjectID, err
+	}
+	now := time.Now()
+	doc := models.RefreshToken{
+		ID:        primitive.NewObjectID(),
+		TokenHash: utils.HashToken(refresh),
+		FamilyID:  familyID,
+		UserID:    userID,
+		MFA:       mfa,
+		CreatedAt: now,
+		ExpiresAt: now.Add(utils.RefreshTokenTTL),
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+	if _, err := database.RefreshTokenCollection.InsertOne(ctx, doc); err != nil {
+		return nil, primitive.NilObjectID, err
+	}
+	access, err := utils.GenerateJWT(userID, role, familyID, mfa)
+	if err != nil {
+		return nil, primitive.NilObjectID, err
+	}
+	return &sessionTokens{
+		Token:        access,
+		RefreshToken: refresh,
+		ExpiresIn:    int(utils.AccessTokenTTL.Seconds()),
+	}, doc.ID, nil
+}
+
+// เพิกถอน refresh token ทั้ง family และ access token ที่ออกจาก family นี้ (ผ่าน denylist "sid:")
+func revokeFamily(ctx context.Context, familyID, reason string) error {
+	now := time.Now()
+	if _, err := database.RefreshTokenCollection.UpdateMany(ctx,
+		bson.M{"familyId": familyID, "revokedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revokedAt": now, "revokeReason": reason}},
+	); err != nil {
+		return err
+	}
+	return denyToken(ctx, "sid:"+familyID, reason, now.Add(utils.AccessTokenTTL))
+}
+
+// เพิกถอนทุก session ของผู้ใช้ (ออกจากระบบทุกอุปกรณ์) ยกเว้น family keepFamily ถ้าระบุ
+func revokeUserSessions(ctx context.Context, userID, reason, keepFamily string) error {
+	families, err := database.RefreshTokenCollection.Distinct(ctx, "familyId", bson.M{
+		"userId":    userID,
+		"revokedAt": bson.M{"$exists": false},
+		"expiresAt": bson.M{"$gt": time.Now()},
+	})
+	if err != nil {
+		return err
+	}
+	for _, f := range families {
+		if id, ok := f.(string); ok && id != keepFamily {
+			if err := revokeFamily(ctx, id, reason); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func denyToken(ctx context.Context, key, reason string, expiresAt time.Time) error {
+	_, err := database.RevokedTokenCollection.UpdateOne(ctx,
+		bson.M{"_id": key},
+		bson.M{"$set": bson.M{"reason": reason, "expiresAt": expiresAt}, "$setOnInsert": bson.M{"createdAt": time.Now()}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// ตรวจว่า access token ถูกเพิกถอน (รายโทเค็นหรือทั้ง family) แล้วหรือไม่
+func isRevoked(ctx context.Context, claims *utils.CustomClaims) (bool, error) {
+	if database.RevokedTokenCollection == nil {
+		return false, nil
+	}
+	keys := []string{"jti:" + claims.ID}
+	if claims.SessionID != "" {
+		keys = append(keys, "sid:"+claims.SessionID)
+	}
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	n, err := database.RevokedTokenCollection.CountDocuments(ctx, bson.M{"_id": bson.M{"$in": keys}}, options.Count().SetLimit(1))
+	return n > 0, err
+}
+
+// POST /api/auth/refresh
+// แลก refresh token เป็นคู่ใหม่ (rotation) token เดิมใช้ได้ครั้งเดียว
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var input struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil || strings.TrimSpace(input.RefreshToken) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ต้องระบุ refreshToken"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tokens, err := rotateRefreshToken(ctx, c, strings.TrimSpace(input.RefreshToken))
+	if errors.Is(err, errRefreshInvalid) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ไม่สามารถสร้างโทเค็นได้"})
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+func rotateRefreshToken(ctx context.Context, c *gin.Context, refresh string) (*sessionTokens, error) {
+	hash := utils.HashToken(refresh)
+	now := time.Now()
+
+	// จอง token นี้แบบ atomic: สำเร็จได้เพียงคำขอเดียว
+	var current models.RefreshToken
+	err := database.RefreshTokenCollection.FindOneAndUpdate(ctx,
+		bson.M{
+			"tokenHash": hash,
+			"usedAt":    bson.M{"$exists": false},
+			"revokedAt": bson.M{"$exists": false},
+			"expiresAt": bson.M{"$gt": now},
+		},
+		bson.M{"$set": bson.M{"usedAt": now}},
+	).Decode(&current)
+	if err == mongo.ErrNoDocuments {
+		var old models.RefreshToken
+		if err := database.RefreshTokenCollection.FindOne(ctx, bson.M{"tokenHash": hash}).Decode(&old); err == nil && old.UsedAt != nil {
+			// token ที่ rotate ไปแล้วถูกนำมาใช้ซ้ำ → อาจถูกขโมย ตัดทั้ง family
+			log.Printf("auth: refresh token reuse detected (user %s, family %s, ip %s)", old.UserID, old.FamilyID, c.ClientIP())
+			recordSecurityEvent(ctx, models.SecurityEvent{
+				Type:      models.EventRefreshReuse,
+				UserID:    old.UserID,
+				IP:        c.ClientIP(),
+				UserAgent: c.Request.UserAgent(),
+				Detail:    "family " + old.FamilyID,
+			})
+			if err := revokeFamily(ctx, old.FamilyID, models.RevokeReuse); err != nil {
+				return nil, err
+			}
+		}
+		return nil, errRefreshInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// อ่าน role ปัจจุบันจากฐานข้อมูล (role ที่ถูกลดสิทธิ์มีผลตั้งแต่ refresh ครั้งถัดไป)
+	var user models.User
+	if err := database.UserCollection.FindOne(ctx, userFilter(current.UserID)).Decode(&user); err != nil {
+		if err == mongo.ErrNoDocuments {
+			_ = revokeFamily(ctx, current.FamilyID, models.RevokeUser)
+			return nil, errRefreshInvalid
+		}
+		return nil, err
+	}
+
+	tokens, nextID, err := issueSession(ctx, c, user.ID.Hex(), user.Role, current.FamilyID, current.MFA)
+	if err != nil {
+		return nil, err
+	}
+	_, _ = database.RefreshTokenCollection.UpdateOne(ctx, bson.M{"_id": current.ID}, bson.M{"$set": bson.M{"replacedBy": nextID}})
+	return tokens, nil
+}
+
+// POST /api/auth/logout
+// เพิกถอน session ของ refreshToken ใน body และ/หรือ access token ใน header
+// all=true เพิกถอนทุก session ของผู้ใช้
+func (h *AuthHandler) Logout(c *gin.Context) {
+	var input struct {
+		RefreshToken string `json:"refreshToken"`
+		All          bool   `json:"all"`
+	}
+	_ = c.ShouldBindJSON(&input)
+
+	var claims *utils.CustomClaims
+	if authHeader := c.GetHeader("Authorization"); authHeader != "" {
+		claims, _ = utils.ParseJWT(strings.TrimPrefix(authHeader, "Bearer "))
+	}
+	refresh := strings.TrimSpace(input.RefreshToken)
+	if claims == nil && refresh == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ต้องระบุ refreshToken หรือ access token"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	userID := ""
+	err := func() error {
+		if claims != nil {
+			userID = claims.UserID
+			if err := denyToken(ctx, "jti:"+claims.ID, models.RevokeLogout, claims.ExpiresAt.Time); err != nil {
+				return err
+			}
+			if claims.SessionID != "" {
+				if err := revokeFamily(ctx, claims.SessionID, models.RevokeLogout); err != nil {
+					return err
+				}
+			}
+		}
+		if refresh != "" {
+			var token models.RefreshToken
+			err := database.RefreshTokenCollection.FindOne(ctx, bson.M{"tokenHash": utils.HashToken(refresh)}).Decode(&token)
+			if err == nil {
+				if userID == "" {
+					userID = token.UserID
+				}
+				if err := revokeFamily(ctx, token.FamilyID, models.RevokeLogout); err != nil {
+					return err
+				}
+			} else if err != mongo.ErrNoDocuments {
+				return err
+			}
+		}
+		if input.All && userID != "" {
+			return revokeUserSessions(ctx, userID, models.RevokeLogout, "")
+		}
+		return nil
+	}()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ไม่สามารถออกจากระบบได้"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "ออกจากระบบแล้ว"})
+}
+
+// GET /.well-known/jwks.json
+// public key ที่ใช้ตรวจสอบ access token (รวมกุญแจเก่าที่ยังไม่หมดช่วงหมุนเวียน)
+func JWKSHandler(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, gin.H{"keys": utils.JWKS()})
+}
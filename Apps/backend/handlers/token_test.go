@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"backend/database"
+	"backend/models"
+	"backend/utils"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ทดสอบกับ MongoDB จริง: ตั้ง MONGO_TEST_URI (เช่น mongodb://localhost:27017) ไม่ตั้ง = ข้าม
+// แต่ละ test ใช้ฐานข้อมูลชั่วคราวของตัวเองและลบทิ้งเมื่อจบ
+func setupTokenDB(t *testing.T) context.Context {
+	t.Helper()
+	uri := os.Getenv("MONGO_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGO_TEST_URI not set")
+	}
+	ctx := context.Background()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri).SetServerSelectionTimeout(5*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Ping(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	db := client.Database(fmt.Sprintf("token_test_%d", time.Now().UnixNano()))
+
+	users, refresh, revoked, events := database.UserCollection, database.RefreshTokenCollection, database.RevokedTokenCollection, database.SecurityEventCollection
+	database.UserCollection = db.Collection("users")
+	database.RefreshTokenCollection = db.Collection("refresh_tokens")
+	database.RevokedTokenCollection = db.Collection("revoked_tokens")
+	database.SecurityEventCollection = db.Collection("security_events")
+	t.Cleanup(func() {
+		database.UserCollection, database.RefreshTokenCollection, database.RevokedTokenCollection, database.SecurityEventCollection = users, refresh, revoked, events
+		db.Drop(ctx)
+		client.Disconnect(ctx)
+	})
+
+	gin.SetMode(gin.TestMode)
+	if err := utils.ConfigureJWT("test-issuer", "test-audience", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := EnsureTokenIndexes(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return ctx
+}
+
+func testUser(t *testing.T, ctx context.Context, role string) string {
+	t.Helper()
+	res, err := database.UserCollection.InsertOne(ctx, models.User{Username: "user-" + role, Role: role, Provider: models.ProviderLocal})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res.InsertedID.(primitive.ObjectID).Hex()
+}
+
+func testContext() *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/auth/refresh", nil)
+	return c
+}
+
+func TestRefreshReuseRevokesFamily(t *testing.T) {
+	ctx := setupTokenDB(t)
+	c := testContext()
+	userID := testUser(t, ctx, "user")
+
+	first, _, err := issueSession(ctx, c, userID, "user", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := rotateRefreshToken(ctx, c, first.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// ใช้ token ที่ rotate ไปแล้วซ้ำ → ไม่ได้ token ใหม่ และ family ถูกตัดทั้งหมด
+	if _, err := rotateRefreshToken(ctx, c, first.RefreshToken); !errors.Is(err, errRefreshInvalid) {
+		t.Fatalf("reuse: err = %v, want errRefreshInvalid", err)
+	}
+	if _, err := rotateRefreshToken(ctx, c, second.RefreshToken); !errors.Is(err, errRefreshInvalid) {
+		t.Fatalf("latest token after reuse: err = %v, want errRefreshInvalid", err)
+	}
+	claims, err := utils.ParseJWT(second.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revoked, err := isRevoked(ctx, claims); err != nil || !revoked {
+		t.Fatalf("access token of revoked family: revoked = %v, %v", revoked, err)
+	}
+
+	n, err := database.RefreshTokenCollection.CountDocuments(ctx, bson.M{"familyId": claims.SessionID, "revokedAt": bson.M{"$exists": false}})
+	if err != nil || n != 0 {
+		t.Fatalf("unrevoked tokens in family = %d, %v", n, err)
+	}
+	n, err = database.SecurityEventCollection.CountDocuments(ctx, bson.M{"type": models.EventRefreshReuse, "userId": userID})
+	if err != nil || n != 1 {
+		t.Fatalf("reuse events = %d, %v", n, err)
+	}
+}
+
+func TestLogoutRejectsAccessToken(t *testing.T) {
+	ctx := setupTokenDB(t)
+	userID := testUser(t, ctx, "user")
+
+	router := gin.New()
+	auth := &AuthHandler{}
+	router.POST("/logout", auth.Logout)
+	router.GET("/me", AuthMiddleware(), func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	do := func(method, path, token string) int {
+		req := httptest.NewRequest(method, path, strings.NewReader("{}"))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// token ที่ไม่มี sid: ตรวจการเพิกถอนราย jti เท่านั้น
+	loggedOut, err := utils.GenerateJWT(userID, "user", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := utils.GenerateJWT(userID, "user", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := do(http.MethodGet, "/me", loggedOut); code != http.StatusNoContent {
+		t.Fatalf("before logout: status %d", code)
+	}
+	if code := do(http.MethodPost, "/logout", loggedOut); code != http.StatusOK {
+		t.Fatalf("logout: status %d", code)
+	}
+	if code := do(http.MethodGet, "/me", loggedOut); code != http.StatusUnauthorized {
+		t.Fatalf("after logout: status %d, want 401", code)
+	}
+	if code := do(http.MethodGet, "/me", other); code != http.StatusNoContent {
+		t.Fatalf("other token after logout: status %d", code)
+	}
+
+	// token ที่มี sid: refresh token ของ session เดียวกันใช้ต่อไม่ได้
+	c := testContext()
+	session, _, err := issueSession(ctx, c, userID, "user", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := do(http.MethodPost, "/logout", session.Token); code != http.StatusOK {
+		t.Fatalf("logout session: status %d", code)
+	}
+	if code := do(http.MethodGet, "/me", session.Token); code != http.StatusUnauthorized {
+		t.Fatalf("session token after logout: status %d, want 401", code)
+	}
+	if _, err := rotateRefreshToken(ctx, c, session.RefreshToken); !errors.Is(err, errRefreshInvalid) {
+		t.Fatalf("refresh after logout: err = %v, want errRefreshInvalid", err)
+	}
+}
+
+func TestRefreshPicksUpDemotedRole(t *testing.T) {
+	ctx := setupTokenDB(t)
+	c := testContext()
+	userID := testUser(t, ctx, "admin")
+
+	tokens, _, err := issueSession(ctx, c, userID, "admin", "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	objID, _ := primitive.ObjectIDFromHex(userID)
+	if _, err := database.UserCollection.UpdateOne(ctx, bson.M{"_id": objID}, bson.M{"$set": bson.M{"role": "user"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	next, err := rotateRefreshToken(ctx, c, tokens.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := utils.ParseJWT(next.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Role != "user" || claims.UserID != userID || !claims.MFA {
+		t.Fatalf("claims after refresh = role %q, user %q, mfa %v", claims.Role, claims.UserID, claims.MFA)
+	}
+}
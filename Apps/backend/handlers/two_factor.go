@@ -0,0 +1,421 @@
+package handlers
+
+import (
+	"backend/models"
+	"backend/services"
+	"backend/utils"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	mfaChallengeTTL   = 5 * time.Minute
+	mfaPurpose        = "mfa"
+	recoveryCodeCount = 10
+)
+
+// role ที่ต้องใช้การยืนยันสองขั้นตอน (ตั้งจาก MFA_REQUIRED_ROLES)
+var MFARequiredRoles = map[string]bool{"admin": true}
+
+// "admin,editor" → MFARequiredRoles ("none" = ไม่บังคับ)
+func SetMFARequiredRoles(list string) {
+	MFARequiredRoles = map[string]bool{}
+	for _, r := range strings.Split(list, ",") {
+		if r = strings.TrimSpace(r); r != "" && r != "none" {
+			MFARequiredRoles[r] = true
+		}
+	}
+}
+
+// การยืนยันตัวตนสองขั้นตอนด้วย TOTP สำหรับผู้ใช้ local
+//
+//	POST /api/login                 รหัสผ่านถูก → mfaRequired / mfaSetupRequired + mfaToken (ยังไม่ได้ session)
+//	POST /api/login/2fa             mfaToken + code (หรือ recoveryCode) → token
+//	POST /api/auth/2fa/setup        secret + otpauthUrl (ด้วย access token หรือ mfaToken)
+//	POST /api/auth/2fa/enable       ยืนยันรหัสแรก → recoveryCodes (ถ้ามาจาก mfaToken ได้ token ด้วย)
+//	POST /api/auth/2fa/disable      ปิด (ไม่อนุญาตสำหรับ role ที่บังคับ)
+//	POST /api/auth/2fa/recovery-codes  ออกรหัสกู้คืนชุดใหม่
+type TwoFactorHandler struct {
+	DB            *mongo.Database
+	Guard         *LoginGuard
+	ChallengeKey  []byte // ลงนาม mfaToken
+	EncryptionKey []byte // เข้ารหัส TOTP secret
+	Issuer        string // ชื่อที่แสดงในแอป Authenticator
+}
+
+// challengeKey / encryptionKey แยกจาก SECRET_KEY ด้วย utils.DeriveKey
+func NewTwoFactorHandler(db *mongo.Database, guard *LoginGuard, challengeKey, encryptionKey []byte, issuer string) *TwoFactorHandler {
+	return &TwoFactorHandler{
+		DB:            db,
+		Guard:         guard,
+		ChallengeKey:  challengeKey,
+		EncryptionKey: encryptionKey,
+		Issuer:        issuer,
+	}
+}
+
+func (h *TwoFactorHandler) users() *mongo.Collection {
+	return h.DB.Collection("users")
+}
+
+var errMFAChallenge = errors.New("mfaToken ไม่ถูกต้องหรือหมดอายุ กรุณาเข้าสู่ระบบใหม่")
+
+func (h *TwoFactorHandler) challenge(userID primitive.ObjectID) string {
+	return utils.SignPayload(h.ChallengeKey, mfaPurpose+"|"+userID.Hex(), time.Now().Add(mfaChallengeTTL))
+}
+
+func (h *TwoFactorHandler) parseChallenge(token string) (primitive.ObjectID, error) {
+	payload, err := utils.VerifySignedPayload(h.ChallengeKey, strings.TrimSpace(token))
+	purpose, hexID, ok := strings.Cut(payload, "|")
+	if err != nil || !ok || purpose != mfaPurpose {
+		return primitive.NilObjectID, errMFAChallenge
+	}
+	id, err := primitive.ObjectIDFromHex(hexID)
+	if err != nil {
+		return primitive.NilObjectID, errMFAChallenge
+	}
+	return id, nil
+}
+
+// ถอดรหัส TOTP secret ที่เก็บไว้
+func (h *TwoFactorHandler) decryptSecret(encrypted string) (string, error) {
+	return utils.DecryptString(h.EncryptionKey, encrypted)
+}
+
+// เรียกจาก LoginHandler หลังตรวจรหัสผ่านผ่าน: ถ้าต้องยืนยันขั้นที่สองจะตอบกลับเองแล้วคืน true
+func (h *TwoFactorHandler) beginLogin(c *gin.Context, user models.User) bool {
+	switch {
+	case user.TOTPEnabled:
+		c.JSON(http.StatusOK, gin.H{"mfaRequired": true, "mfaToken": h.challenge(user.ID), "expiresIn": int(mfaChallengeTTL.Seconds())})
+	case MFARequiredRoles[user.Role]:
+		// role ที่บังคับแต่ยังไม่ได้ตั้งค่า: ให้ตั้งค่าก่อนจึงจะได้ session
+		c.JSON(http.StatusOK, gin.H{"mfaSetupRequired": true, "mfaToken": h.challenge(user.ID), "expiresIn": int(mfaChallengeTTL.Seconds())})
+	default:
+		return false
+	}
+	return true
+}
+
+// ออก session หลังผ่านขั้นที่สอง (รูปแบบเดียวกับ POST /api/login)
+// เข้าสู่ระบบครบทุกขั้นแล้วจึงล้างตัวนับความผิดพลาดของบัญชี
+func (h *TwoFactorHandler) completeLogin(ctx context.Context, c *gin.Context, user models.User, extra gin.H) {
+	if err := h.Guard.recordSuccess(ctx, user.Username); err != nil {
+		log.Println("login guard:", err)
+	}
+	if err := updateUserLoginStats(h.DB, user.ID, c); err != nil {
+		log.Println("login stats:", err)
+	}
+	tokens, _, err := issueSession(ctx, c, user.ID.Hex(), user.Role, "", true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ไม่สามารถสร้างโทเค็นได้"})
+		return
+	}
+	resp := gin.H{
+		"token":        tokens.Token,
+		"refreshToken": tokens.RefreshToken,
+		"expiresIn":    tokens.ExpiresIn,
+		"userId":       user.ID.Hex(),
+		"username":     user.Username,
+		"role":         user.Role,
+	}
+	for k, v := range extra {
+		resp[k] = v
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// ตรวจรหัส TOTP หรือรหัสกู้คืน (ใช้แล้วตัดทิ้ง) ของผู้ใช้ที่เปิด 2FA แล้ว
+func (h *TwoFactorHandler) verifySecondFactor(ctx context.Context, user models.User, code, recoveryCode string) (bool, error) {
+	if recoveryCode = strings.TrimSpace(recoveryCode); recoveryCode != "" {
+		res, err := h.users().UpdateOne(ctx,
+			bson.M{"_id": user.ID, "recoveryCodes": services.HashRecoveryCode(recoveryCode)},
+			bson.M{"$pull": bson.M{"recoveryCodes": services.HashRecoveryCode(recoveryCode)}},
+		)
+		if err != nil {
+			return false, err
+		}
+		return res.ModifiedCount == 1, nil
+	}
+
+	secret, err := h.decryptSecret(user.TOTPSecret)
+	if err != nil {
+		return false, err
+	}
+	step, ok := services.VerifyTOTP(secret, code, time.Now(), user.TOTPLastStep)
+	if !ok {
+		return false, nil
+	}
+	// กันการใช้รหัสเดิมซ้ำ (รวมถึงคำขอพร้อมกัน)
+	res, err := h.users().UpdateOne(ctx,
+		bson.M{"_id": user.ID, "$or": bson.A{
+			bson.M{"totpLastStep": bson.M{"$lt": step}},
+			bson.M{"totpLastStep": bson.M{"$exists": false}},
+		}},
+		bson.M{"$set": bson.M{"totpLastStep": step}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount == 1, nil
+}
+
+// ตรวจรหัสขั้นที่สองผ่านตัวนับเดียวกับการใส่รหัสผ่านผิด (จองก่อนตรวจเหมือน LoginHandler)
+// ใช้ทั้งตอนเข้าสู่ระบบและก่อนปิด 2FA / ออกรหัสกู้คืนใหม่ ผู้ถือ access token จึงเดารหัสไม่ได้ไม่จำกัด
+// คืน false เมื่อไม่ผ่าน (ตอบกลับแล้ว)
+func (h *TwoFactorHandler) guardedSecondFactor(ctx context.Context, c *gin.Context, user models.User, code, recoveryCode string) bool {
+	block, reserved, err := h.Guard.reserve(ctx, user.Username, c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "เกิดข้อผิดพลาดในการตรวจรหัสยืนยัน"})
+		return false
+	}
+	if !reserved {
+		respondLoginBlocked(c, block)
+		return false
+	}
+
+	ok, err := h.verifySecondFactor(ctx, user, code, recoveryCode)
+	if err != nil {
+		h.Guard.release(ctx, user.Username, c.ClientIP())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "เกิดข้อผิดพลาดในการตรวจรหัสยืนยัน"})
+		return false
+	}
+	if !ok {
+		block, ferr := h.Guard.recordFailure(ctx, c, user.Username)
+		if ferr != nil {
+			log.Println("login guard:", ferr)
+		}
+		if block.locked {
+			respondLoginBlocked(c, block)
+			return false
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "รหัสยืนยันไม่ถูกต้อง"})
+		return false
+	}
+	h.Guard.release(ctx, user.Username, c.ClientIP())
+	return true
+}
+
+type twoFactorInput struct {
+	MFAToken     string `json:"mfaToken"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recoveryCode"`
+}
+
+// POST /api/login/2fa
+func (h *TwoFactorHandler) Login(c *gin.Context) {
+	var input twoFactorInput
+	if err := c.ShouldBindJSON(&input); err != nil || (input.Code == "" && input.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ต้องระบุ code หรือ recoveryCode"})
+		return
+	}
+	userID, err := h.parseChallenge(input.MFAToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var user models.User
+	if err := h.users().FindOne(ctx, bson.M{"_id": userID, "totpEnabled": true}).Decode(&user); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": errMFAChallenge.Error()})
+		return
+	}
+
+	if !h.guardedSecondFactor(ctx, c, user, input.Code, input.RecoveryCode) {
+		return
+	}
+
+	extra := gin.H{}
+	if input.RecoveryCode != "" {
+		var left struct {
+			RecoveryCodes []string `bson:"recoveryCodes"`
+		}
+		_ = h.users().FindOne(ctx, bson.M{"_id": user.ID}).Decode(&left)
+		extra["recoveryCodesLeft"] = len(left.RecoveryCodes)
+	}
+	h.completeLogin(ctx, c, user, extra)
+}
+
+// ผู้ใช้ที่กำลังตั้งค่า: จาก mfaToken (ระหว่างเข้าสู่ระบบ) หรือจาก access token
+func (h *TwoFactorHandler) subject(c *gin.Context, mfaToken string) (primitive.ObjectID, bool, error) {
+	if mfaToken != "" {
+		id, err := h.parseChallenge(mfaToken)
+		return id, true, err
+	}
+	id, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		return primitive.NilObjectID, false, errors.New("ต้องเข้าสู่ระบบด้วยบัญชีชื่อผู้ใช้/รหัสผ่าน")
+	}
+	return id, false, nil
+}
+
+// POST /api/auth/2fa/setup
+func (h *TwoFactorHandler) Setup(c *gin.Context) {
+	var input twoFactorInput
+	_ = c.ShouldBindJSON(&input)
+	userID, _, err := h.subject(c, input.MFAToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var user models.User
+	if err := h.users().FindOne(ctx, bson.M{"_id": userID, "password": hasPassword}).Decode(&user); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "ไม่พบผู้ใช้"})
+		return
+	}
+	if user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "เปิดใช้การยืนยันสองขั้นตอนอยู่แล้ว"})
+		return
+	}
+
+	secret, err := services.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ไม่สามารถสร้าง secret ได้"})
+		return
+	}
+	encrypted, err := utils.EncryptString(h.EncryptionKey, secret)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ไม่สามารถสร้าง secret ได้"})
+		return
+	}
+	if _, err := h.users().UpdateOne(ctx, bson.M{"_id": userID}, bson.M{"$set": bson.M{"totpPending": encrypted}}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"secret":     secret,
+		"otpauthUrl": services.TOTPProvisioningURI(h.Issuer, user.Username, secret),
+	})
+}
+
+// POST /api/auth/2fa/enable
+func (h *TwoFactorHandler) Enable(c *gin.Context) {
+	var input twoFactorInput
+	if err := c.ShouldBindJSON(&input); err != nil || input.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ต้องระบุ code จากแอป Authenticator"})
+		return
+	}
+	userID, viaLogin, err := h.subject(c, input.MFAToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var user models.User
+	if err := h.users().FindOne(ctx, bson.M{"_id": userID}).Decode(&user); err != nil || user.TOTPPending == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "กรุณาเริ่มตั้งค่าที่ /api/auth/2fa/setup ก่อน"})
+		return
+	}
+	secret, err := h.decryptSecret(user.TOTPPending)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ไม่สามารถอ่าน secret ได้"})
+		return
+	}
+	step, ok := services.VerifyTOTP(secret, input.Code, time.Now(), 0)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "รหัสยืนยันไม่ถูกต้อง ตรวจสอบเวลาของอุปกรณ์แล้วลองใหม่"})
+		return
+	}
+
+	codes, hashes, err := services.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ไม่สามารถสร้างรหัสกู้คืนได้"})
+		return
+	}
+	res, err := h.users().UpdateOne(ctx,
+		bson.M{"_id": userID, "totpPending": user.TOTPPending},
+		bson.M{
+			"$set":   bson.M{"totpEnabled": true, "totpSecret": user.TOTPPending, "totpLastStep": step, "recoveryCodes": hashes},
+			"$unset": bson.M{"totpPending": ""},
+		},
+	)
+	if err != nil || res.ModifiedCount == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "การตั้งค่าถูกเปลี่ยนระหว่างดำเนินการ กรุณาเริ่มใหม่"})
+		return
+	}
+
+	if viaLogin {
+		// ตั้งค่าระหว่างเข้าสู่ระบบ (role ที่บังคับ): รหัสที่เพิ่งยืนยันถือเป็นขั้นที่สอง
+		h.completeLogin(ctx, c, user, gin.H{"recoveryCodes": codes})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "เปิดใช้การยืนยันสองขั้นตอนแล้ว", "recoveryCodes": codes})
+}
+
+// POST /api/auth/2fa/disable (ต้องเข้าสู่ระบบ)
+func (h *TwoFactorHandler) Disable(c *gin.Context) {
+	if MFARequiredRoles[c.GetString("role")] {
+		c.JSON(http.StatusForbidden, gin.H{"error": "บัญชีระดับนี้ต้องใช้การยืนยันสองขั้นตอนเสมอ"})
+		return
+	}
+	h.withSecondFactor(c, func(ctx context.Context, user models.User) {
+		if _, err := h.users().UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{
+			"$unset": bson.M{"totpEnabled": "", "totpSecret": "", "totpPending": "", "totpLastStep": "", "recoveryCodes": ""},
+		}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "ปิดการยืนยันสองขั้นตอนแล้ว"})
+	})
+}
+
+// POST /api/auth/2fa/recovery-codes (ต้องเข้าสู่ระบบ) รหัสชุดเดิมใช้ไม่ได้อีก
+func (h *TwoFactorHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	h.withSecondFactor(c, func(ctx context.Context, user models.User) {
+		codes, hashes, err := services.GenerateRecoveryCodes(recoveryCodeCount)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "ไม่สามารถสร้างรหัสกู้คืนได้"})
+			return
+		}
+		if _, err := h.users().UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": bson.M{"recoveryCodes": hashes}}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"recoveryCodes": codes})
+	})
+}
+
+// ตรวจรหัสปัจจุบัน (นับความผิดพลาดเหมือนการเข้าสู่ระบบ) ก่อนเปลี่ยนการตั้งค่า 2FA
+func (h *TwoFactorHandler) withSecondFactor(c *gin.Context, fn func(ctx context.Context, user models.User)) {
+	var input twoFactorInput
+	if err := c.ShouldBindJSON(&input); err != nil || (input.Code == "" && input.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ต้องระบุ code หรือ recoveryCode"})
+		return
+	}
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ต้องเข้าสู่ระบบด้วยบัญชีชื่อผู้ใช้/รหัสผ่าน"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var user models.User
+	if err := h.users().FindOne(ctx, bson.M{"_id": userID, "totpEnabled": true}).Decode(&user); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ยังไม่ได้เปิดใช้การยืนยันสองขั้นตอน"})
+		return
+	}
+	if !h.guardedSecondFactor(ctx, c, user, input.Code, input.RecoveryCode) {
+		return
+	}
+	fn(ctx, user)
+}
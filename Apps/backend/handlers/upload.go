@@ -2,19 +2,24 @@ package handlers
 
 import (
 	"backend/models"
+	"backend/services"
 	"context"
+	"crypto/sha256"
 	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/xuri/excelize/v2"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type UploadHandler struct {
@@ -26,65 +31,543 @@ func NewUploadHandler(db *mongo.Database) *UploadHandler {
 }
 
 // ===== PARSERS =====
-func parseJSON(r io.Reader) ([]interface{}, error) {
-	var result []map[string]interface{}
-	err := json.NewDecoder(r).Decode(&result)
+// รับ record ที่แปลงเสร็จทีละรายการ error ที่คืนมาหยุดการอ่านไฟล์และส่งต่อออกจากตัวแปลงตามเดิม
+type recordSink func(services.ImportRecord) error
+
+// อ่าน JSON array ทีละ object แล้วส่งให้ emit ทันที (ไม่ถือทั้งไฟล์ไว้ในหน่วยความจำ)
+func parseJSON(r io.Reader, emit recordSink) error {
+	dec := json.NewDecoder(r)
+	tok, err := dec.Token()
 	if err != nil {
-		return nil, err
+		return err
 	}
-	records := make([]interface{}, len(result))
-	for i, v := range result {
-		records[i] = v
+	if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		return errors.New("ไฟล์ JSON ต้องเป็น array ของแพ็กเกจ")
 	}
-	return records, nil
+	for row := 1; dec.More(); row++ {
+		var v map[string]interface{}
+		if err := dec.Decode(&v); err != nil {
+			return err
+		}
+		pkg, reasons := services.DecodePackageMap(v)
+		if err := emit(services.ImportRecord{Row: row, Package: pkg, Reasons: reasons, Fields: services.PackageMapFields(v)}); err != nil {
+			return err
+		}
+	}
+	_, err = dec.Token()
+	return err
 }
 
-func parseCSV(r io.Reader) ([]interface{}, error) {
+// อ่าน CSV ทีละแถวและส่ง record ที่ครบแล้วให้ emit ระหว่างอ่าน
+// ยกเว้น rate sheet (แถวละอายุ) และตารางที่ต้องเติม id ซึ่งต้องใช้ทั้งตาราง
+func parseCSV(r io.Reader, opts services.SheetOptions, emit recordSink) error {
 	reader := csv.NewReader(r)
-	lines, err := reader.ReadAll()
-	if err != nil || len(lines) < 2 {
-		return nil, errors.New("ไฟล์ CSV ไม่ถูกต้อง")
-	}
-
-	headers := lines[0]
-	var records []interface{}
-	for _, line := range lines[1:] {
-		obj := make(map[string]interface{})
-		for i, val := range line {
-			if i < len(headers) {
-				obj[headers[i]] = val
+	reader.FieldsPerRecord = -1
+	headers, err := reader.Read()
+	if err != nil {
+		return errors.New("ไฟล์ CSV ไม่ถูกต้อง")
+	}
+	if services.IsRateSheet(headers) || opts.PackageID != "" {
+		lines, err := reader.ReadAll()
+		if err != nil || len(lines) == 0 {
+			return errors.New("ไฟล์ CSV ไม่ถูกต้อง")
+		}
+		records, err := services.DecodeSheet(headers, lines, opts)
+		if err != nil {
+			return err
+		}
+		return emitAll(records, emit)
+	}
+
+	decoder, err := services.NewTableDecoder(headers, opts.Profile)
+	if err != nil {
+		return err
+	}
+	rows := 0
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.New("ไฟล์ CSV ไม่ถูกต้อง")
+		}
+		decoder.Add(row)
+		rows++
+		if err := emitAll(decoder.Take(), emit); err != nil {
+			return err
+		}
+	}
+	if rows == 0 {
+		return errors.New("ไฟล์ CSV ไม่ถูกต้อง")
+	}
+	return emitAll(decoder.Records(), emit)
+}
+
+func emitAll(records []services.ImportRecord, emit recordSink) error {
+	for _, rec := range records {
+		if err := emit(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// แปลง Package เป็น map สำหรับเปรียบเทียบ (ไม่รวม _id)
+func packageToMap(pkg models.Package) map[string]interface{} {
+	pkg.ID = primitive.NilObjectID
+	b, _ := json.Marshal(pkg)
+	var m map[string]interface{}
+	_ = json.Unmarshal(b, &m)
+	delete(m, "id")
+	return m
+}
+
+// รายการที่ผ่านการตรวจแล้วพร้อมบันทึก (row คือ index ใน report.Rows)
+// update แก้เฉพาะฟิลด์ที่เปลี่ยน ฟิลด์อื่นในเอกสารเดิม (รวมฟิลด์ที่ models.Package ไม่รู้จัก) คงไว้
+type importItem struct {
+	row    int
+	pkg    models.Package // insert: เอกสารใหม่ / update: ผลลัพธ์ที่คาดไว้หลังแก้
+	before bson.M         // เอกสารเดิมทั้งก้อน (เฉพาะ update)
+	update bson.M         // $set / $unset (เฉพาะ update)
+	fields []string       // ฟิลด์ใน bson ที่ update แก้
+}
+
+// แพ็กเกจเดิมในฐานข้อมูล: pkg ใช้ตรวจและเปรียบเทียบ raw คือเอกสารทั้งก้อน
+type storedPackage struct {
+	pkg models.Package
+	raw bson.M
+}
+
+// จำนวน record ต่อ chunk ที่ตรวจและบันทึกพร้อมกัน (ค้นหาด้วย $in และ BulkWrite ครั้งละ chunk)
+const importChunkSize = 500
+
+// รายงานขั้นตอนของ chunk ปัจจุบันและจำนวนแถวที่ตรวจแล้ว ใช้กับ import job; nil = ไม่รายงาน
+type phaseFunc func(phase string, processed int)
+
+func (p phaseFunc) report(phase string, processed int) {
+	if p != nil {
+		p(phase, processed)
+	}
+}
+
+// ค้นหาแพ็กเกจเดิมตาม id ทีละ importChunkSize รายการ
+// id ที่เป็น ObjectID hex ค้นจาก _id ด้วย เพราะ export ใช้ ObjectID แทน id ของแพ็กเกจเก่าที่ไม่มี id แบบข้อความ
+// (id แบบข้อความตรงกันมาก่อนเสมอ)
+func (h *UploadHandler) findPackagesByID(ctx context.Context, ids []string) (map[string]storedPackage, error) {
+	found := make(map[string]storedPackage, len(ids))
+	collection := h.DB.Collection("packages")
+	for start := 0; start < len(ids); start += importChunkSize {
+		end := min(start+importChunkSize, len(ids))
+		filter := bson.M{"id": bson.M{"$in": ids[start:end]}}
+		var objIDs []primitive.ObjectID
+		for _, id := range ids[start:end] {
+			if objID, err := primitive.ObjectIDFromHex(id); err == nil {
+				objIDs = append(objIDs, objID)
+			}
+		}
+		if len(objIDs) > 0 {
+			filter = bson.M{"$or": []bson.M{filter, {"_id": bson.M{"$in": objIDs}}}}
+		}
+		cursor, err := collection.Find(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		var docs []bson.Raw
+		if err := cursor.All(ctx, &docs); err != nil {
+			return nil, err
+		}
+		var legacy []storedPackage
+		for _, doc := range docs {
+			var stored storedPackage
+			if err := bson.Unmarshal(doc, &stored.pkg); err != nil {
+				return nil, err
+			}
+			if err := bson.Unmarshal(doc, &stored.raw); err != nil {
+				return nil, err
+			}
+			if stored.pkg.PackageID == "" {
+				legacy = append(legacy, stored)
+				continue
+			}
+			found[stored.pkg.PackageID] = stored
+		}
+		for _, stored := range legacy {
+			if _, taken := found[stored.pkg.ID.Hex()]; !taken {
+				found[stored.pkg.ID.Hex()] = stored
 			}
 		}
-		records = append(records, obj)
 	}
-	return records, nil
+	return found, nil
 }
 
-func parseExcel(r io.Reader) ([]interface{}, error) {
-	f, err := excelize.OpenReader(r)
+// แพ็กเกจเดิมที่แทนที่เฉพาะฟิลด์ใน fields (ชื่อ json) ด้วยค่าจาก pkg
+func mergePresentFields(existing, pkg models.Package, fields map[string]bool) (models.Package, error) {
+	doc, incoming := packageToMap(existing), packageToMap(pkg)
+	for f := range fields {
+		if f == "packageId" {
+			continue
+		}
+		if v, ok := incoming[f]; ok {
+			doc[f] = v
+		} else {
+			delete(doc, f)
+		}
+	}
+	var merged models.Package
+	b, err := json.Marshal(doc)
+	if err == nil {
+		err = json.Unmarshal(b, &merged)
+	}
+	merged.ID, merged.PackageID = existing.ID, existing.PackageID
+	return merged, err
+}
+
+// ตรวจ record หนึ่ง chunk และจัดสถานะ insert/update/unchanged/conflict/invalid โดยไม่เขียนฐานข้อมูล
+// แถวต่อท้าย report.Rows และนับสถานะสะสม seen (id → แถวแรกที่พบ) ใช้ร่วมกันทุก chunk ของไฟล์
+func (h *UploadHandler) prepareImport(ctx context.Context, report *models.ImportReport, seen map[string]int, records []services.ImportRecord, force bool) ([]importItem, error) {
+	var items []importItem
+	first := len(report.Rows)
+
+	var ids []string
+	listed := map[string]bool{}
+	for _, rec := range records {
+		if id := rec.Package.PackageID; id != "" && !listed[id] {
+			listed[id] = true
+			ids = append(ids, id)
+		}
+	}
+	found, err := h.findPackagesByID(ctx, ids)
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
 
-	sheetName := f.GetSheetName(0)
-	rows, err := f.GetRows(sheetName)
-	if err != nil || len(rows) < 2 {
-		return nil, errors.New("ไม่สามารถอ่านข้อมูลจาก Excel ได้")
+	for _, rec := range records {
+		row := models.ImportRow{Sheet: rec.Sheet, Row: rec.Row, MergedSheets: rec.MergedSheets}
+		pkg := rec.Package
+		stored, exists := found[pkg.PackageID]
+		existingPkg := stored.pkg
+		legacyID := exists && existingPkg.PackageID == ""
+		if legacyID {
+			// แพ็กเกจเก่าที่พบจาก _id: ใช้ ObjectID เป็น id แบบข้อความต่อจากนี้ ไฟล์ที่ export ไปจึงไม่นับว่าแก้ id
+			existingPkg.PackageID = pkg.PackageID
+		}
+		// record จาก rate sheet มีแค่ตารางเบี้ย ถ้ามีแพ็กเกจเดิมให้คงข้อมูลอื่นไว้และแทนที่เฉพาะ pricing
+		if rec.PricingOnly && exists {
+			merged := existingPkg
+			merged.Pricing = pkg.Pricing
+			pkg = merged
+		}
+		// คอลัมน์ที่ไฟล์ไม่มีคงค่าเดิม (ไม่ล้างเป็นค่าว่าง)
+		if rec.Fields != nil && exists && !rec.PricingOnly {
+			merged, err := mergePresentFields(existingPkg, pkg, rec.Fields)
+			if err != nil {
+				return nil, err
+			}
+			pkg = merged
+		}
+		row.ID = pkg.PackageID
+		row.Name = pkg.Name
+		errs, warnings := services.ValidatePackage(pkg)
+		row.Reasons = append(rec.Reasons, errs...)
+		row.Warnings = warnings
+		// id ซ้ำนับจากแถวแรกเสมอ (แม้แถวแรกไม่ผ่าน) แถวหลังจึงไม่ถูกนำเข้าแทน
+		if first, dup := seen[pkg.PackageID]; dup && pkg.PackageID != "" {
+			row.Reasons = append(row.Reasons, fmt.Sprintf("id: ซ้ำกับแถวที่ %d", first))
+		} else if pkg.PackageID != "" {
+			seen[pkg.PackageID] = row.Row
+		}
+		if len(row.Reasons) > 0 {
+			row.Status = models.RowInvalid
+			report.Rows = append(report.Rows, row)
+			continue
+		}
+
+		if !exists {
+			row.Status = models.RowInsert
+		} else {
+			existing := packageToMap(existingPkg)
+			newDoc := packageToMap(pkg)
+			row.Diff = CompareDocuments(existing, newDoc)
+			switch {
+			case len(row.Diff) == 0:
+				row.Status = models.RowUnchanged
+			case force:
+				row.Status = models.RowUpdate
+			default:
+				row.Status = models.RowConflict
+				report.Conflicts = append(report.Conflicts, models.Conflict{
+					ID:   pkg.PackageID,
+					Diff: row.Diff,
+					Old:  existing,
+					New:  newDoc,
+				})
+			}
+			pkg.ID = existingPkg.ID
+		}
+
+		item := importItem{pkg: pkg}
+		if exists && len(row.Diff) > 0 {
+			// เฉพาะฟิลด์ใน diff ที่แสดงในรายงาน
+			var fields []string
+			for _, d := range row.Diff {
+				fields = append(fields, d.Field)
+			}
+			if legacyID {
+				fields = append(fields, "packageId")
+			}
+			if item.update, item.fields, err = packageUpdate(pkg, fields); err != nil {
+				return nil, err
+			}
+			if item.pkg, err = packageAfterUpdate(stored.raw, item.update); err != nil {
+				return nil, err
+			}
+			item.before = stored.raw
+		}
+		report.Rows = append(report.Rows, row)
+		item.row = len(report.Rows) - 1
+		items = append(items, item)
+	}
+
+	// นับสถานะของแถวใน chunk นี้
+	for _, row := range report.Rows[first:] {
+		switch row.Status {
+		case models.RowInsert:
+			report.Inserted++
+		case models.RowUpdate:
+			report.Updated++
+		case models.RowUnchanged:
+			report.Unchanged++
+		case models.RowInvalid:
+			report.Invalid++
+		}
+	}
+	return items, nil
+}
+
+// บันทึกรายการ insert/update ของ chunk ด้วย BulkWrite (ordered) ทีละ importChunkSize รายการ
+// batch สะสมทุกรายการที่บันทึกแล้ว รวมถึงส่วนต้นของ chunk ที่ล้มเหลวกลางทาง จึง undo ได้เสมอ
+// ยอด inserted/updated จาก prepareImport เปลี่ยนเป็นยอดที่บันทึกจริง
+func (h *UploadHandler) applyImport(ctx context.Context, report *models.ImportReport, items []importItem, batch *models.ImportBatch) error {
+	var pending []importItem
+	for _, item := range items {
+		switch report.Rows[item.row].Status {
+		case models.RowInsert:
+			report.Inserted--
+		case models.RowUpdate:
+			report.Updated--
+		default:
+			continue
+		}
+		pending = append(pending, item)
 	}
 
-	headers := rows[0]
-	var records []interface{}
-	for _, row := range rows[1:] {
-		obj := make(map[string]interface{})
-		for i, val := range row {
-			if i < len(headers) {
-				obj[headers[i]] = val
+	collection := h.DB.Collection("packages")
+	for start := 0; start < len(pending); start += importChunkSize {
+		end := min(start+importChunkSize, len(pending))
+		chunk := pending[start:end]
+		writes := make([]mongo.WriteModel, len(chunk))
+		for i := range chunk {
+			item := &chunk[i]
+			if report.Rows[item.row].Status == models.RowInsert {
+				item.pkg.ID = primitive.NewObjectID()
+				writes[i] = mongo.NewInsertOneModel().SetDocument(item.pkg)
+				continue
 			}
+			writes[i] = mongo.NewUpdateOneModel().SetFilter(bson.M{"_id": item.pkg.ID}).SetUpdate(item.update)
+		}
+		_, err := collection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(true))
+		applied := len(chunk)
+		if err != nil {
+			applied = appliedWrites(ctx, collection, err, chunk)
+		}
+
+		for _, item := range chunk[:applied] {
+			if report.Rows[item.row].Status == models.RowInsert {
+				batch.InsertedIDs = append(batch.InsertedIDs, item.pkg.ID)
+				batch.Inserted = append(batch.Inserted, item.pkg)
+				report.Inserted++
+				continue
+			}
+			batch.Updates = append(batch.Updates, models.BatchUpdate{PackageID: item.pkg.ID, Before: item.before, Fields: item.fields, After: item.pkg})
+			report.Updated++
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// นำเข้าไฟล์หนึ่งไฟล์ทีละ importChunkSize record ระหว่างที่ตัวแปลงอ่านไฟล์
+// แต่ละ chunk ตรวจแล้วบันทึก conflict และเขียนทันที (dryRun ตรวจอย่างเดียว)
+// batch สะสมทุก chunk จึง undo ได้ทั้งไฟล์ และ conflict ทั้งไฟล์อยู่ในชุดเดียวกัน
+type importRun struct {
+	h        *UploadHandler
+	ctx      context.Context
+	opts     models.ImportOptions
+	source   importSource
+	progress phaseFunc
+	setID    primitive.ObjectID
+	report   *models.ImportReport
+	batch    models.ImportBatch
+	seen     map[string]int
+	pending  []services.ImportRecord
+	err      error // error จากการตรวจหรือบันทึก (แยกจาก error ของตัวแปลง)
+}
+
+func (h *UploadHandler) newImportRun(ctx context.Context, source importSource, opts models.ImportOptions, progress phaseFunc) *importRun {
+	return &importRun{
+		h:        h,
+		ctx:      ctx,
+		opts:     opts,
+		source:   source,
+		progress: progress,
+		setID:    primitive.NewObjectID(),
+		report:   &models.ImportReport{Conflicts: []models.Conflict{}, Rows: []models.ImportRow{}, DryRun: opts.DryRun},
+		batch: models.ImportBatch{
+			Source:     source.Batch,
+			FileName:   source.FileName,
+			FileHash:   source.FileHash,
+			UploadedBy: source.UploadedBy,
+			CreatedAt:  time.Now(),
+		},
+		seen: map[string]int{},
+	}
+}
+
+// รับ record จากตัวแปลง (recordSink) ครบ importChunkSize รายการจึงตรวจและบันทึก
+func (run *importRun) add(rec services.ImportRecord) error {
+	run.pending = append(run.pending, rec)
+	if len(run.pending) < importChunkSize {
+		return nil
+	}
+	return run.flush()
+}
+
+// ตรวจและบันทึก record ที่รออยู่ (เรียกอีกครั้งเมื่ออ่านไฟล์จบ)
+func (run *importRun) flush() error {
+	if len(run.pending) == 0 {
+		return nil
+	}
+	records := run.pending
+	run.pending = nil
+
+	run.progress.report(models.PhaseValidate, len(run.report.Rows))
+	items, err := run.h.prepareImport(run.ctx, run.report, run.seen, records, run.opts.Force)
+	if err != nil {
+		return run.fail(fmt.Errorf("ตรวจสอบข้อมูลล้มเหลว: %w", err))
+	}
+	if run.opts.DryRun {
+		return nil
+	}
+	if err := run.h.recordConflicts(run.ctx, run.report, items, run.source, run.setID); err != nil {
+		return run.fail(fmt.Errorf("บันทึก conflict ล้มเหลว: %w", err))
+	}
+	run.progress.report(models.PhaseWrite, len(run.report.Rows))
+	if err := run.h.applyImport(run.ctx, run.report, items, &run.batch); err != nil {
+		return run.fail(fmt.Errorf("บันทึกข้อมูลล้มเหลว: %w", err))
+	}
+	return nil
+}
+
+func (run *importRun) fail(err error) error {
+	run.err = err
+	return err
+}
+
+// จำนวนรายการต้น chunk ที่บันทึกแล้วเมื่อ BulkWrite แบบ ordered ล้มเหลว
+func appliedWrites(ctx context.Context, collection *mongo.Collection, err error, chunk []importItem) int {
+	var bulkErr mongo.BulkWriteException
+	if errors.As(err, &bulkErr) {
+		// ordered หยุดที่ write error แรก รายการก่อนหน้าบันทึกแล้ว
+		if len(bulkErr.WriteErrors) > 0 {
+			return bulkErr.WriteErrors[0].Index
+		}
+		// มีแค่ write concern error: ทุกรายการเขียนลง primary แล้ว
+		return len(chunk)
+	}
+	// error อื่น (เช่น การเชื่อมต่อหลุด) ไม่รู้ว่าไปถึงรายการใด ตรวจจากฐานข้อมูลตามลำดับ
+	for i, item := range chunk {
+		var current models.Package
+		if err := collection.FindOne(ctx, bson.M{"_id": item.pkg.ID}).Decode(&current); err != nil || !samePackage(current, item.pkg) {
+			return i
 		}
-		records = append(records, obj)
 	}
-	return records, nil
+	return len(chunk)
+}
+
+// อ่านตัวเลือกการอัปโหลดจาก query string
+func importOptionsFromQuery(c *gin.Context) (models.ImportOptions, error) {
+	sheetMap, err := parseSheetMap(c.Query("sheetMap"))
+	if err != nil {
+		return models.ImportOptions{}, err
+	}
+	opts := models.ImportOptions{
+		Profile:       c.Query("profile"),
+		PackagePrefix: c.Query("packagePrefix"),
+		SheetMap:      sheetMap,
+		Force:         c.Query("force") == "true",
+		DryRun:        c.Query("dryRun") == "true",
+	}
+	if opts.Pages, err = parsePageList(c.Query("pages")); err != nil {
+		return models.ImportOptions{}, err
+	}
+	for _, name := range strings.Split(c.Query("sheets"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			opts.Sheets = append(opts.Sheets, name)
+		}
+	}
+	return opts, nil
+}
+
+func supportedImportFile(fileName string) bool {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".json", ".csv", ".xlsx", ".pdf":
+		return true
+	}
+	return false
+}
+
+// แปลงไฟล์ตามนามสกุลแล้วส่ง record ให้ emit (Excel คืนผลราย sheet ด้วย)
+// JSON และ CSV ส่งระหว่างอ่าน Excel และ PDF ต้องอ่านทั้งไฟล์ก่อนจึงส่งเมื่อแปลงเสร็จ
+func (h *UploadHandler) parseUpload(ctx context.Context, r io.Reader, fileName string, opts models.ImportOptions, emit recordSink) ([]models.SheetReport, error) {
+	profile, err := h.loadProfile(ctx, opts.Profile)
+	if err != nil {
+		return nil, err
+	}
+	sheetOpts := services.SheetOptions{Profile: profile, IDPrefix: opts.PackagePrefix}
+
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".json":
+		return nil, parseJSON(r, emit)
+	case ".csv":
+		return nil, parseCSV(r, sheetOpts, emit)
+	case ".xlsx":
+		records, sheets, err := parseExcel(r, sheetOpts, opts.Sheets, opts.SheetMap)
+		if err != nil {
+			return nil, err
+		}
+		return sheets, emitAll(records, emit)
+	case ".pdf":
+		records, err := parsePDF(r, sheetOpts, opts.Pages)
+		if err != nil {
+			return nil, err
+		}
+		return nil, emitAll(records, emit)
+	}
+	return nil, errors.New("รองรับเฉพาะไฟล์ .json, .csv, .xlsx, .pdf เท่านั้น")
+}
+
+func hashFile(r io.ReadSeeker) (string, error) {
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, r); err != nil {
+		return "", err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
 }
 
 func (h *UploadHandler) HandleUpload(c *gin.Context) {
@@ -93,6 +576,15 @@ func (h *UploadHandler) HandleUpload(c *gin.Context) {
 		c.JSON(400, gin.H{"error": "ไม่พบไฟล์"})
 		return
 	}
+	if !supportedImportFile(file.Filename) {
+		c.JSON(400, gin.H{"error": "รองรับเฉพาะไฟล์ .json, .csv, .xlsx, .pdf เท่านั้น"})
+		return
+	}
+	opts, err := importOptionsFromQuery(c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
 
 	f, err := file.Open()
 	if err != nil {
@@ -101,91 +593,117 @@ func (h *UploadHandler) HandleUpload(c *gin.Context) {
 	}
 	defer f.Close()
 
-	ext := strings.ToLower(filepath.Ext(file.Filename))
-	var records []interface{}
-	var parseErr error
-
-	switch ext {
-	case ".json":
-		records, parseErr = parseJSON(f)
-	case ".csv":
-		records, parseErr = parseCSV(f)
-	case ".xlsx":
-		records, parseErr = parseExcel(f)
-	default:
-		c.JSON(400, gin.H{"error": "รองรับเฉพาะไฟล์ .json, .csv, .xlsx เท่านั้น"})
+	fileHash, err := hashFile(f)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "ไม่สามารถอ่านไฟล์ได้"})
 		return
 	}
 
-	if parseErr != nil {
-		c.JSON(400, gin.H{"error": "อ่านไฟล์ไม่สำเร็จ: " + parseErr.Error()})
+	source := importSource{FileName: file.Filename, FileHash: fileHash, UploadedBy: c.GetString("userId"), Batch: models.BatchSourceUpload}
+	report, batchID, err := h.importFile(context.Background(), f, source, opts, nil)
+	if err != nil {
+		// chunk ที่บันทึกไปแล้วก่อนเกิด error undo ได้จาก batchId
+		status := 500
+		var parseErr importParseError
+		if errors.As(err, &parseErr) {
+			status = 400
+		}
+		resp := gin.H{"error": err.Error()}
+		if batchID != "" {
+			resp["batchId"] = batchID
+		}
+		c.JSON(status, resp)
 		return
 	}
 
-	force := c.Query("force") == "true"
-	collection := h.DB.Collection("packages")
-
-	var newItems []interface{}
-	var conflicts []models.Conflict
-	var updatedCount int
-
-	for _, rec := range records {
-		m, ok := rec.(map[string]interface{})
-		if !ok {
-			continue
-		}
-		delete(m, "_id")
+	// dryRun: คืนผลการตรวจทีละแถวโดยไม่แตะฐานข้อมูล
+	if opts.DryRun {
+		c.JSON(200, report)
+		return
+	}
+	c.JSON(200, gin.H{
+		"message":     "อัปโหลดและบันทึกสำเร็จ",
+		"inserted":    report.Inserted,
+		"updated":     report.Updated,
+		"unchanged":   report.Unchanged,
+		"invalid":     report.Invalid,
+		"conflicts":   report.Conflicts,
+		"conflictSet": report.ConflictSet,
+		"rows":        report.Rows,
+		"sheets":      report.Sheets,
+		"batchId":     batchID,
+	})
+}
 
-		id, ok := m["id"].(string)
-		if !ok || id == "" {
-			continue
-		}
+// profile สำหรับจับคู่หัวคอลัมน์ (ค่าว่างหรือ "default" = DefaultImportProfile)
+func (h *UploadHandler) loadProfile(ctx context.Context, name string) (models.ImportProfile, error) {
+	if name == "" || name == "default" {
+		return services.DefaultImportProfile(), nil
+	}
+	var profile models.ImportProfile
+	err := h.DB.Collection("import_profiles").FindOne(ctx, bson.M{"name": name}).Decode(&profile)
+	if err == mongo.ErrNoDocuments {
+		return profile, fmt.Errorf("ไม่พบ profile %q", name)
+	}
+	return profile, err
+}
 
-		var existing map[string]interface{}
-		err := collection.FindOne(context.Background(), bson.M{"id": id}).Decode(&existing)
-		if err == mongo.ErrNoDocuments {
-			newItems = append(newItems, m)
-		} else if err == nil {
-			diffs := CompareDocuments(existing, m)
-			if len(diffs) > 0 {
-				if force {
-					_, err := collection.UpdateOne(
-						context.Background(),
-						bson.M{"id": id},
-						bson.M{"$set": m},
-					)
-					if err == nil {
-						updatedCount++
-					}
-				} else {
-					conflicts = append(conflicts, models.Conflict{
-						ID:   id,
-						Diff: CompareDocuments(existing, m),
-						Old:  existing,
-						New:  m,
-					})
-				}
-			}
-		} else {
-			// unexpected db error, skip
-			continue
-		}
+// GET /api/upload/profiles
+func (h *UploadHandler) ListProfiles(c *gin.Context) {
+	ctx := context.Background()
+	cursor, err := h.DB.Collection("import_profiles").Find(ctx, bson.M{})
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	profiles := []models.ImportProfile{services.DefaultImportProfile()}
+	var custom []models.ImportProfile
+	if err := cursor.All(ctx, &custom); err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
 	}
+	c.JSON(200, append(profiles, custom...))
+}
 
-	if len(newItems) > 0 {
-		_, err := collection.InsertMany(context.TODO(), newItems)
-		if err != nil {
-			c.JSON(500, gin.H{"error": "บันทึกข้อมูลล้มเหลว: " + err.Error()})
+// POST /api/upload/profiles — สร้างหรือแทนที่ profile ตามชื่อ
+func (h *UploadHandler) SaveProfile(c *gin.Context) {
+	var profile models.ImportProfile
+	if err := c.ShouldBindJSON(&profile); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	profile.Name = strings.TrimSpace(profile.Name)
+	if profile.Name == "" || profile.Name == "default" {
+		c.JSON(400, gin.H{"error": "ต้องระบุชื่อ profile (ห้ามใช้ default)"})
+		return
+	}
+	hasID := false
+	for _, col := range profile.Columns {
+		if col.Field == "" || len(col.Headers) == 0 {
+			c.JSON(400, gin.H{"error": "ทุกคอลัมน์ต้องระบุ field และ headers"})
 			return
 		}
+		hasID = hasID || col.Field == "id"
+	}
+	if !hasID {
+		c.JSON(400, gin.H{"error": "profile ต้องมีคอลัมน์ของ field id"})
+		return
 	}
 
-	c.JSON(200, gin.H{
-		"message":   "อัปโหลดและบันทึกสำเร็จ",
-		"inserted":  len(newItems),
-		"updated":   updatedCount,
-		"conflicts": conflicts,
-	})
+	profile.ID = primitive.NilObjectID
+	now := time.Now()
+	profile.UpdatedBy, profile.UpdatedAt = c.GetString("userId"), &now
+	_, err := h.DB.Collection("import_profiles").ReplaceOne(
+		context.Background(),
+		bson.M{"name": profile.Name},
+		profile,
+		options.Replace().SetUpsert(true),
+	)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, profile)
 }
 
 func CompareDocuments(oldDoc, newDoc map[string]interface{}) []models.FieldDiff {
@@ -203,5 +721,11 @@ func CompareDocuments(oldDoc, newDoc map[string]interface{}) []models.FieldDiff
 			})
 		}
 	}
+	// ฟิลด์ที่เอกสารใหม่ไม่มี (omitempty ที่ถูกล้าง) แสดงเป็นค่าใหม่ว่าง
+	for key, oldVal := range oldDoc {
+		if _, exists := newDoc[key]; !exists && key != "_id" {
+			diffs = append(diffs, models.FieldDiff{Field: key, Old: oldVal})
+		}
+	}
 	return diffs
 }
@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"backend/models"
+	"backend/services"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// อ่านทุก sheet ใน workbook (หรือเฉพาะ sheet ที่เลือก) แล้วแปลงเป็น record
+// sheetMap ผูกชื่อ sheet กับ id แพ็กเกจ; sheet ที่อ่านไม่ได้จะถูกข้ามและบันทึกไว้ใน SheetReport.Error
+func parseExcel(r io.Reader, opts services.SheetOptions, selected []string, sheetMap map[string]string) ([]services.ImportRecord, []models.SheetReport, error) {
+	f, err := excelize.OpenReader(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	names := f.GetSheetList()
+	if len(selected) > 0 {
+		for _, name := range selected {
+			if idx, _ := f.GetSheetIndex(name); idx < 0 {
+				return nil, nil, fmt.Errorf("ไม่พบ sheet %q", name)
+			}
+		}
+		names = selected
+	}
+
+	var records []services.ImportRecord
+	var sheets []models.SheetReport
+	var sheetErrs []string
+	for _, name := range names {
+		sheet := models.SheetReport{Sheet: name, PackageID: sheetMap[name]}
+		recs, err := decodeExcelSheet(f, name, opts, sheet.PackageID)
+		if err != nil {
+			sheet.Error = err.Error()
+			sheetErrs = append(sheetErrs, fmt.Sprintf("%s: %v", name, err))
+		}
+		for i := range recs {
+			recs[i].Sheet = name
+		}
+		records = append(records, recs...)
+		sheets = append(sheets, sheet)
+	}
+
+	if len(records) == 0 {
+		return nil, nil, errors.New("ไม่สามารถอ่านข้อมูลจาก Excel ได้ (" + strings.Join(sheetErrs, "; ") + ")")
+	}
+	return services.MergePricingRecords(records), sheets, nil
+}
+
+func decodeExcelSheet(f *excelize.File, name string, opts services.SheetOptions, packageID string) ([]services.ImportRecord, error) {
+	headers, rows, err := readExcelSheet(f, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("ไม่มีข้อมูล")
+	}
+	opts.PackageID = packageID
+	return services.DecodeSheet(headers, rows, opts)
+}
+
+// อ่าน sheet โดยเติมค่าของ merged cell ให้ทุกช่องที่ถูก merge
+// แถวบนสุดที่มีแต่ข้อความเดียว merge คลุมหลายคอลัมน์ (ชื่อตาราง) จะถูกข้าม
+// ถ้าหัวตารางมี cell ที่ merge หลายคอลัมน์ (เช่น "1M" คลุม M/F) และแถวถัดไปเป็นหัวย่อย จะรวมเป็น "1M_M", "1M_F"
+func readExcelSheet(f *excelize.File, name string) ([]string, [][]string, error) {
+	rows, err := f.GetRows(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	merges, err := f.GetMergeCells(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// ช่วงคอลัมน์ที่ merge แนวนอนในแต่ละแถว (index เริ่มจาก 0)
+	spans := map[int][][2]int{}
+	for _, m := range merges {
+		startCol, startRow, err := excelize.CellNameToCoordinates(m.GetStartAxis())
+		if err != nil {
+			return nil, nil, err
+		}
+		endCol, endRow, err := excelize.CellNameToCoordinates(m.GetEndAxis())
+		if err != nil {
+			return nil, nil, err
+		}
+		if endCol > startCol {
+			spans[startRow-1] = append(spans[startRow-1], [2]int{startCol - 1, endCol - 1})
+		}
+		for r := startRow; r <= endRow; r++ {
+			for len(rows) < r {
+				rows = append(rows, nil)
+			}
+			for len(rows[r-1]) < endCol {
+				rows[r-1] = append(rows[r-1], "")
+			}
+			for c := startCol; c <= endCol; c++ {
+				rows[r-1][c-1] = m.GetCellValue()
+			}
+		}
+	}
+
+	head := 0
+	for head < len(rows)-1 && isBannerRow(rows[head], spans[head]) {
+		head++
+	}
+	rows = rows[head:]
+	if len(rows) == 0 {
+		return nil, nil, nil
+	}
+	if len(rows) < 2 || !isSubHeaderRow(rows[0], rows[1], spans[head]) {
+		return rows[0], rows[1:], nil
+	}
+
+	top, bottom := rows[0], rows[1]
+	width := len(top)
+	if len(bottom) > width {
+		width = len(bottom)
+	}
+	headers := make([]string, width)
+	for c := range headers {
+		t, b := cellAt(top, c), cellAt(bottom, c)
+		switch {
+		case b == "" || b == t:
+			headers[c] = t
+		case t == "":
+			headers[c] = b
+		default:
+			headers[c] = t + "_" + b
+		}
+	}
+	return headers, rows[2:], nil
+}
+
+func cellAt(row []string, c int) string {
+	if c < len(row) {
+		return strings.TrimSpace(row[c])
+	}
+	return ""
+}
+
+// แถวชื่อตาราง: ทุกช่องที่มีค่าอยู่ใน merge แนวนอนเดียวกัน
+func isBannerRow(row []string, spans [][2]int) bool {
+	for _, span := range spans {
+		inside := true
+		for c := range row {
+			if cellAt(row, c) != "" && (c < span[0] || c > span[1]) {
+				inside = false
+				break
+			}
+		}
+		if inside {
+			return true
+		}
+	}
+	return false
+}
+
+// แถวถัดจากหัวตารางเป็นหัวย่อยเมื่อช่องที่มีค่า (และต่างจากหัวบน) อยู่ใต้ merge แนวนอนทั้งหมด
+// และไม่ใช่ตัวเลข แถวข้อมูลแถวแรกจึงไม่ถูกใช้เป็นหัวตาราง
+func isSubHeaderRow(top, next []string, spans [][2]int) bool {
+	if len(spans) == 0 {
+		return false
+	}
+	under := map[int]bool{}
+	for _, span := range spans {
+		for c := span[0]; c <= span[1]; c++ {
+			under[c] = true
+		}
+	}
+	found := false
+	for c := range next {
+		b := cellAt(next, c)
+		if b == "" || b == cellAt(top, c) {
+			continue
+		}
+		if !under[c] {
+			return false
+		}
+		if _, err := strconv.ParseFloat(strings.ReplaceAll(b, ",", ""), 64); err == nil {
+			return false
+		}
+		found = true
+	}
+	return found
+}
+
+// sheetMap จาก query เช่น "Rates 1M:health-happy-1m,Rates 5M:health-happy-5m"
+func parseSheetMap(s string) (map[string]string, error) {
+	m := map[string]string{}
+	if strings.TrimSpace(s) == "" {
+		return m, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		name, id, ok := strings.Cut(pair, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("sheetMap %q ต้องอยู่ในรูปแบบ sheet:packageId", pair)
+		}
+		m[strings.TrimSpace(name)] = strings.TrimSpace(id)
+	}
+	return m, nil
+}
+
+// นับผลราย sheet จากสถานะของแต่ละแถวใน report
+// แถวที่รวมตารางเบี้ยจาก rate sheet อื่นนับให้ทั้ง sheet ของแถวและ sheet ที่ถูกรวมเข้ามา
+func summarizeSheets(report *models.ImportReport, sheets []models.SheetReport) {
+	idx := map[string]int{}
+	for i, s := range sheets {
+		idx[s.Sheet] = i
+	}
+	for _, row := range report.Rows {
+		for _, name := range append([]string{row.Sheet}, row.MergedSheets...) {
+			i, ok := idx[name]
+			if !ok {
+				continue
+			}
+			switch row.Status {
+			case models.RowInsert:
+				sheets[i].Inserted++
+			case models.RowUpdate:
+				sheets[i].Updated++
+			case models.RowUnchanged:
+				sheets[i].Unchanged++
+			case models.RowInvalid:
+				sheets[i].Invalid++
+			case models.RowConflict:
+				sheets[i].Conflicts++
+			}
+		}
+	}
+	report.Sheets = sheets
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"backend/services"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// แปลงตารางเบี้ยใน PDF เป็น record (PricingOnly) ต่อแผน
+// pages เลือกเฉพาะหน้าที่ต้องการ (เล่มโบรชัวร์มักมีหลายผลิตภัณฑ์ในไฟล์เดียว)
+func parsePDF(r io.Reader, opts services.SheetOptions, pages []int) ([]services.ImportRecord, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, errors.New("ไม่สามารถอ่านไฟล์ PDF ได้")
+	}
+	return services.DecodeRatePDF(data, pages, opts)
+}
+
+// ช่วงหน้าที่ระบุได้ต่อครั้ง (กัน "1-999999999" สร้าง slice ขนาดมหึมา)
+const maxPDFPageRange = 5000
+
+// "5,95-98" → [5 95 96 97 98]
+func parsePageList(s string) ([]int, error) {
+	var pages []int
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		from, to, isRange := strings.Cut(part, "-")
+		first, err1 := strconv.Atoi(strings.TrimSpace(from))
+		last, err2 := first, error(nil)
+		if isRange {
+			last, err2 = strconv.Atoi(strings.TrimSpace(to))
+		}
+		if err1 != nil || err2 != nil || first < 1 || last < first || last-first >= maxPDFPageRange {
+			return nil, fmt.Errorf("pages %q ไม่ถูกต้อง (เช่น 5,95-98)", part)
+		}
+		for p := first; p <= last; p++ {
+			pages = append(pages, p)
+		}
+	}
+	return pages, nil
+}
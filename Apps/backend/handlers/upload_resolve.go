@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"backend/models"
+	"backend/services"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type ResolveInput struct {
+	ConflictSet string                      `json:"conflictSet" binding:"required"` // จากผลอัปโหลด
+	Resolutions []models.ConflictResolution `json:"resolutions" binding:"required"`
+}
+
+// conflict ที่รอแก้เก็บไว้ 7 วัน
+const conflictTTL = 7 * 24 * time.Hour
+
+func (h *UploadHandler) conflicts() *mongo.Collection {
+	return h.DB.Collection("import_conflicts")
+}
+
+func (h *UploadHandler) EnsureIndexes(ctx context.Context) error {
+	_, err := h.conflicts().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "setId", Value: 1}, {Key: "packageId", Value: 1}}},
+		{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	return err
+}
+
+// เก็บ conflict ของการอัปโหลดไว้ ResolveConflicts จึงใช้ค่าจากไฟล์จริงแทนค่าที่ client ส่งมา
+// ทุก chunk ของไฟล์เดียวกันใช้ setID เดียวกัน
+func (h *UploadHandler) recordConflicts(ctx context.Context, report *models.ImportReport, items []importItem, source importSource, setID primitive.ObjectID) error {
+	now := time.Now()
+	var docs []interface{}
+	for _, item := range items {
+		if report.Rows[item.row].Status != models.RowConflict {
+			continue
+		}
+		pending := models.PendingConflict{
+			SetID:      setID,
+			PackageID:  report.Rows[item.row].ID,
+			New:        item.pkg,
+			FileName:   source.FileName,
+			UploadedBy: source.UploadedBy,
+			CreatedAt:  now,
+			ExpiresAt:  now.Add(conflictTTL),
+		}
+		raw, err := bson.Marshal(item.before)
+		if err == nil {
+			err = bson.Unmarshal(raw, &pending.Old)
+		}
+		if err != nil {
+			return err
+		}
+		docs = append(docs, pending)
+	}
+	for start := 0; start < len(docs); start += importChunkSize {
+		end := min(start+importChunkSize, len(docs))
+		if _, err := h.conflicts().InsertMany(ctx, docs[start:end]); err != nil {
+			return err
+		}
+	}
+	if len(docs) > 0 {
+		report.ConflictSet = setID.Hex()
+	}
+	return nil
+}
+
+// แพ็กเกจที่จะถูกแก้ พร้อมเอกสารก่อนแก้ (ใช้เป็นเงื่อนไขตอนบันทึกและเก็บไว้ใน batch สำหรับ undo)
+// update แก้เฉพาะฟิลด์ที่เปลี่ยน ฟิลด์ที่ models.Package ไม่รู้จักจึงไม่หาย
+type resolvedPackage struct {
+	before bson.D
+	raw    bson.M
+	update bson.M
+	fields []string
+	pkg    models.Package // ผลลัพธ์หลังแก้
+}
+
+// POST /api/upload/resolve
+// แก้ conflict จากการอัปโหลดทีละฟิลด์ (old / new / custom) ค่า new มาจากชุด conflict ที่เก็บไว้ตอนอัปโหลด
+// ตรวจทุกรายการก่อน แล้วบันทึกทุกแพ็กเกจ ประวัติ batch และลบ conflict ที่แก้แล้วใน transaction เดียว
+// (ต้องใช้ MongoDB แบบ replica set) แต่ละแพ็กเกจมีเงื่อนไขว่าเอกสารต้องไม่เปลี่ยนหลังตรวจ
+// ถ้ารายการใดบันทึกไม่ได้ จะไม่มีการเปลี่ยนแปลงใดถูกบันทึก
+func (h *UploadHandler) ResolveConflicts(c *gin.Context) {
+	var input ResolveInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if len(input.Resolutions) == 0 {
+		c.JSON(400, gin.H{"error": "ต้องระบุ resolutions อย่างน้อย 1 รายการ"})
+		return
+	}
+	setID, err := primitive.ObjectIDFromHex(input.ConflictSet)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "conflictSet ไม่ถูกต้อง"})
+		return
+	}
+
+	ctx := context.Background()
+	collection := h.DB.Collection("packages")
+	problems := map[string][]string{}
+	var stale []string
+	var resolved []resolvedPackage
+	seen := map[string]bool{}
+
+	for _, res := range input.Resolutions {
+		if seen[res.ID] {
+			problems[res.ID] = append(problems[res.ID], "id: ระบุซ้ำ")
+			continue
+		}
+		seen[res.ID] = true
+
+		var pending models.PendingConflict
+		err := h.conflicts().FindOne(ctx, bson.M{"setId": setID, "packageId": res.ID}).Decode(&pending)
+		if err == mongo.ErrNoDocuments {
+			problems[res.ID] = append(problems[res.ID], "ไม่พบ conflict ของแพ็กเกจนี้ (อาจหมดอายุแล้ว กรุณาอัปโหลดใหม่)")
+			continue
+		}
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		raw, err := collection.FindOne(ctx, bson.M{"_id": pending.Old.ID}).Raw()
+		if err == mongo.ErrNoDocuments {
+			problems[res.ID] = append(problems[res.ID], "ไม่พบแพ็กเกจ")
+			continue
+		}
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		var before bson.D
+		var rawDoc bson.M
+		var current models.Package
+		if err := bson.Unmarshal(raw, &before); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		if err := bson.Unmarshal(raw, &rawDoc); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		if err := bson.Unmarshal(raw, &current); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		if !samePackage(current, pending.Old) {
+			stale = append(stale, res.ID)
+			continue
+		}
+
+		existing := packageToMap(current)
+		pkg, errs := services.ApplyResolution(existing, packageToMap(pending.New), res)
+		if len(errs) > 0 {
+			problems[res.ID] = errs
+			continue
+		}
+		pkg.ID = current.ID
+		update, fields, err := packageUpdate(pkg, changedPackageFields(existing, packageToMap(pkg)))
+		if err == nil {
+			pkg, err = packageAfterUpdate(rawDoc, update)
+		}
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		resolved = append(resolved, resolvedPackage{before: before, raw: rawDoc, update: update, fields: fields, pkg: pkg})
+	}
+
+	if len(stale) > 0 {
+		c.JSON(409, gin.H{"error": "แพ็กเกจถูกแก้ไขหลังการอัปโหลด กรุณาอัปโหลดใหม่", "stale": stale})
+		return
+	}
+	if len(problems) > 0 {
+		c.JSON(400, gin.H{"error": "การแก้ conflict ไม่ถูกต้อง", "problems": problems})
+		return
+	}
+
+	batch := models.ImportBatch{
+		Source:     models.BatchSourceResolve,
+		UploadedBy: c.GetString("userId"),
+		CreatedAt:  time.Now(),
+	}
+	packages := make([]models.Package, len(resolved))
+	for i, r := range resolved {
+		packages[i] = r.pkg
+		if len(r.fields) > 0 {
+			batch.Updates = append(batch.Updates, models.BatchUpdate{PackageID: r.pkg.ID, Before: r.raw, Fields: r.fields, After: r.pkg})
+		}
+	}
+	ids := make([]string, 0, len(input.Resolutions))
+	for _, res := range input.Resolutions {
+		ids = append(ids, res.ID)
+	}
+
+	session, err := h.DB.Client().StartSession()
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	defer session.EndSession(ctx)
+
+	var changed errConcurrentUpdate
+	batchID, err := session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		for _, r := range resolved {
+			if len(r.fields) == 0 {
+				continue
+			}
+			result, err := collection.UpdateOne(sc, r.before, r.update)
+			if err != nil {
+				return nil, err
+			}
+			if result.MatchedCount == 0 {
+				return nil, errConcurrentUpdate(r.pkg.PackageID)
+			}
+		}
+		batchID, err := h.recordBatch(sc, batch)
+		if err != nil {
+			return nil, fmt.Errorf("บันทึกประวัติการนำเข้าล้มเหลว: %w", err)
+		}
+		if _, err := h.conflicts().DeleteMany(sc, bson.M{"setId": setID, "packageId": bson.M{"$in": ids}}); err != nil {
+			return nil, err
+		}
+		return batchID, nil
+	})
+	if errors.As(err, &changed) {
+		c.JSON(409, gin.H{"error": "บันทึกไม่สำเร็จ ยกเลิกการเปลี่ยนแปลงทั้งหมด: " + changed.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "บันทึกไม่สำเร็จ ยกเลิกการเปลี่ยนแปลงทั้งหมด: " + err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message":  "แก้ conflict สำเร็จ",
+		"resolved": len(resolved),
+		"packages": packages,
+		"batchId":  batchID,
+	})
+}
+
+// แพ็กเกจถูกแก้ไขระหว่างตรวจกับบันทึก (เงื่อนไขเอกสารเดิมไม่ตรง)
+type errConcurrentUpdate string
+
+func (e errConcurrentUpdate) Error() string {
+	return fmt.Sprintf("แพ็กเกจ %s ถูกแก้ไขระหว่างบันทึก", string(e))
+}
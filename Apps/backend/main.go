@@ -4,8 +4,13 @@ import (
 	"backend/config"
 	"backend/database"
 	"backend/handlers"
+	"backend/services"
+	"backend/utils"
+	"context"
 	"log"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -23,12 +28,37 @@ func main() {
 		log.Fatal("MongoDB connection error", err)
 	}
 	db := client.Database(cfg.MongoDBName)
+	if err := utils.ConfigureJWT(cfg.JWT_ISSUER, cfg.JWT_AUDIENCE, cfg.JWTKeysDir, cfg.JWTSigningKid); err != nil {
+		log.Fatal("JWT keys: ", err)
+	}
 	database.UserCollection = db.Collection("users")
+	database.RefreshTokenCollection = db.Collection("refresh_tokens")
+	database.RevokedTokenCollection = db.Collection("revoked_tokens")
+	database.SecurityEventCollection = db.Collection("security_events")
+	if err := handlers.EnsureTokenIndexes(context.Background()); err != nil {
+		log.Println("token indexes:", err)
+	}
+	if err := handlers.EnsureUserIndexes(context.Background()); err != nil {
+		log.Println("user indexes:", err)
+	}
+	if err := handlers.MigrateLineUserIDs(context.Background(), db); err != nil {
+		log.Println("migrate LINE user ids:", err)
+	}
+	if ttl, err := time.ParseDuration(cfg.JWTAccessTTL); err == nil && ttl > 0 {
+		utils.AccessTokenTTL = ttl
+	}
+	if ttl, err := time.ParseDuration(cfg.JWTRefreshTTL); err == nil && ttl > 0 {
+		utils.RefreshTokenTTL = ttl
+	}
 	// Gin setup
 	r := gin.Default()
+	// ClientIP() (ตัวนับการเข้าสู่ระบบผิดต่อ IP) อ่าน X-Forwarded-For เฉพาะจาก proxy ที่กำหนด
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatal("TRUSTED_PROXIES: ", err)
+	}
 
 	// Middleware สำหรับ session
-	store := cookie.NewStore([]byte(cfg.SECRET_KEY))
+	store := cookie.NewStore(utils.DeriveKey([]byte(cfg.SECRET_KEY), "session"))
 	r.Use(sessions.Sessions("mysession", store))
 
 	// Cross-origin resource sharing (CORS)
@@ -43,14 +73,49 @@ func main() {
 		MaxAge:           12 * time.Hour,
 	}))
 
+	// public key สำหรับบริการอื่นที่ตรวจสอบ JWT
+	r.GET("/.well-known/jwks.json", handlers.JWKSHandler)
+
 	// route
 	api := r.Group("/api")
+	// Mail (ลิงก์ยืนยันอีเมล / ตั้งรหัสผ่านใหม่)
+	mailer, err := services.NewMailSender(services.MailConfig{
+		Driver:   cfg.MailDriver,
+		From:     cfg.MailFrom,
+		Dir:      cfg.MailDir,
+		Host:     cfg.SMTPHost,
+		Port:     cfg.SMTPPort,
+		Username: cfg.SMTPUsername,
+		Password: cfg.SMTPPassword,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	// register
-	api.POST("/register", handlers.RegisterHandler(db))
+	emailVerifier := handlers.NewEmailVerifier(db, mailer, cfg.FRONTEND_URL, utils.DeriveKey([]byte(cfg.SECRET_KEY), "email-verify"))
+	if cfg.EmailVerifyRequired == "" {
+		cfg.EmailVerifyRequired = "cart"
+	}
+	emailVerifier.SetRestricted(cfg.EmailVerifyRequired)
+	api.POST("/register", handlers.RegisterHandler(db, emailVerifier))
+	api.POST("/auth/email/verify", emailVerifier.Verify)
+	api.POST("/auth/email/resend", handlers.AuthMiddleware(), emailVerifier.Resend)
 
 	// Show data
 	api.GET("/categories", handlers.GetCategoriesHandler(db))
 	api.GET("/packages", handlers.GetPackagesHandler(db))
+	api.GET("/packages/export", handlers.ExportPackagesHandler(db))
+	api.GET("/packages/:id/projection", handlers.PremiumProjectionHandler(db))
+	api.POST("/recommendations", handlers.RecommendHandler(db))
+
+	// Needs analysis
+	questionnaireHandler := handlers.NewQuestionnaireHandler(db)
+	api.GET("/questionnaires/active", questionnaireHandler.GetActive)
+	api.POST("/questionnaires", handlers.AuthMiddleware(), handlers.RequireRole("admin"), questionnaireHandler.Create)
+	api.POST("/questionnaires/:id/answers", handlers.AuthMiddleware(), questionnaireHandler.SubmitAnswers)
+	api.GET("/needs-analysis", handlers.AuthMiddleware(), questionnaireHandler.GetMyAssessment)
+	api.GET("/needs-analyses", handlers.AuthMiddleware(), handlers.RequireRole("admin"), questionnaireHandler.ListAssessments)
 
 	// Update
 	api.PATCH("/packages/:id/pricing/:index", handlers.UpdatePricingHandler(db))
@@ -63,7 +128,7 @@ func main() {
 	api.POST("/packages/add-pricing", handlers.AddPricingToPackageHandler(db))
 	api.POST("/packages/delete-pricing", handlers.DeletePricingFromPackageHandler(db))
 	api.DELETE("/packages/:id", handlers.DeleteOnePackage(db))
-	api.DELETE("/packages", handlers.DeleteAllPackagesHandler(db))
+	api.DELETE("/packages", handlers.AuthMiddleware(), handlers.RequireRole("admin"), handlers.DeleteAllPackagesHandler(db))
 
 	// Promotion
 	r.GET("/api/promotions", handlers.GetPromotionsHandler(db))
@@ -73,20 +138,126 @@ func main() {
 
 	//  เพิ่ม cart handler
 	cartHandler := handlers.NewCartHandler(db)
-	api.GET("/cart", cartHandler.GetCart)
-	api.POST("/cart", cartHandler.AddToCart)
-	api.DELETE("/cart/:id", cartHandler.DeleteFromCart)
+	api.GET("/cart", handlers.AuthMiddleware(), cartHandler.GetCart)
+	api.POST("/cart", handlers.AuthMiddleware(), emailVerifier.Require("cart"), cartHandler.AddToCart)
+	api.DELETE("/cart/:id", handlers.AuthMiddleware(), cartHandler.DeleteFromCart)
+
+	// Insured persons & family quotes
+	insuredHandler := handlers.NewInsuredHandler(db)
+	api.GET("/insured", handlers.AuthMiddleware(), insuredHandler.List)
+	api.POST("/insured", handlers.AuthMiddleware(), emailVerifier.Require("insured"), insuredHandler.Create)
+	api.PATCH("/insured/:id", handlers.AuthMiddleware(), insuredHandler.Update)
+	api.DELETE("/insured/:id", handlers.AuthMiddleware(), insuredHandler.Delete)
+	api.POST("/quotes/family", handlers.AuthMiddleware(), emailVerifier.Require("quotes"), handlers.FamilyQuoteHandler(db))
+	api.POST("/eligibility", handlers.EligibilityHandler(db))
 
 	// Upload
 	uploadHandler := handlers.NewUploadHandler(db)
-	api.POST("/upload", uploadHandler.HandleUpload)
+	if err := uploadHandler.EnsureIndexes(context.Background()); err != nil {
+		log.Println("import conflict indexes:", err)
+	}
+	api.POST("/upload", handlers.AuthMiddleware(), handlers.RequireRole("admin"), uploadHandler.HandleUpload)
+	api.GET("/upload/profiles", handlers.AuthMiddleware(), handlers.RequireRole("admin"), uploadHandler.ListProfiles)
+	api.POST("/upload/profiles", handlers.AuthMiddleware(), handlers.RequireRole("admin"), uploadHandler.SaveProfile)
+	api.POST("/upload/resolve", handlers.AuthMiddleware(), handlers.RequireRole("admin"), uploadHandler.ResolveConflicts)
+	importJobs := handlers.NewImportJobRunner(uploadHandler, 2)
+	importJobs.Start()
+	api.POST("/upload/jobs", handlers.AuthMiddleware(), handlers.RequireRole("admin"), importJobs.Enqueue)
+	api.GET("/upload/jobs/:id", handlers.AuthMiddleware(), importJobs.GetJob)
+	api.GET("/upload/jobs/:id/events", handlers.AuthMiddleware(), importJobs.Events)
+	api.GET("/upload/jobs/:id/report", handlers.AuthMiddleware(), importJobs.DownloadReport)
+	if cfg.ImportWatchDir != "" {
+		interval, err := time.ParseDuration(cfg.ImportWatchInterval)
+		if err != nil {
+			interval = time.Minute
+		}
+		watcher := handlers.NewImportWatcher(uploadHandler, cfg.ImportWatchDir, interval)
+		watcher.Options.Profile = cfg.ImportWatchProfile
+		watcher.Start()
+	}
+	api.GET("/upload/batches", handlers.AuthMiddleware(), handlers.RequireRole("admin"), uploadHandler.ListBatches)
+	api.POST("/upload/batches/:id/undo", handlers.AuthMiddleware(), handlers.RequireRole("admin"), uploadHandler.UndoBatch)
 	// login
-	api.POST("/login", handlers.LoginHandler(db))
+	loginGuard := handlers.NewLoginGuard(db)
+	if n, err := strconv.Atoi(cfg.LoginMaxFailures); err == nil && n > 0 {
+		loginGuard.Account.MaxFailures = n
+	}
+	if n, err := strconv.Atoi(cfg.LoginIPMaxFailures); err == nil && n > 0 {
+		loginGuard.IP.MaxFailures = n
+	}
+	if d, err := time.ParseDuration(cfg.LoginLockDuration); err == nil && d > 0 {
+		loginGuard.Account.LockDuration, loginGuard.IP.LockDuration = d, d
+	}
+	if err := loginGuard.EnsureIndexes(context.Background()); err != nil {
+		log.Println("login attempt indexes:", err)
+	}
+	// Two-factor authentication
+	if cfg.MFARequiredRoles != "" {
+		handlers.SetMFARequiredRoles(cfg.MFARequiredRoles)
+	}
+	mfaIssuer := cfg.JWT_ISSUER
+	if mfaIssuer == "" {
+		mfaIssuer = "corestack-platform"
+	}
+	twoFactor := handlers.NewTwoFactorHandler(db, loginGuard,
+		utils.DeriveKey([]byte(cfg.SECRET_KEY), "mfa-token"),
+		utils.DeriveKey([]byte(cfg.SECRET_KEY), "totp-secret"),
+		mfaIssuer)
+	api.POST("/login", handlers.LoginHandler(db, loginGuard, twoFactor))
+	api.POST("/login/2fa", twoFactor.Login)
+	api.POST("/auth/2fa/setup", handlers.OptionalAuth(), twoFactor.Setup)
+	api.POST("/auth/2fa/enable", handlers.OptionalAuth(), twoFactor.Enable)
+	api.POST("/auth/2fa/disable", handlers.AuthMiddleware(), twoFactor.Disable)
+	api.POST("/auth/2fa/recovery-codes", handlers.AuthMiddleware(), twoFactor.RegenerateRecoveryCodes)
+	api.GET("/security/lockouts", handlers.AuthMiddleware(), handlers.RequireRole("admin"), loginGuard.ListLockouts)
+	api.POST("/security/lockouts/unlock", handlers.AuthMiddleware(), handlers.RequireRole("admin"), loginGuard.Unlock)
+	api.GET("/security/events", handlers.AuthMiddleware(), handlers.RequireRole("admin"), loginGuard.ListEvents)
+
+	// Password policy
+	if n, err := strconv.Atoi(cfg.PasswordMinLength); err == nil && n > 0 {
+		services.CurrentPasswordPolicy.MinLength = n
+	}
+	if unknown := services.CurrentPasswordPolicy.SetRequired(cfg.PasswordRequire); len(unknown) > 0 {
+		log.Println("PASSWORD_REQUIRE: unknown rules:", strings.Join(unknown, ", "))
+	}
+	if cfg.PasswordBlocklist != "" {
+		if f, err := os.Open(cfg.PasswordBlocklist); err != nil {
+			log.Println("password blocklist:", err)
+		} else {
+			if err := services.AddCommonPasswords(f); err != nil {
+				log.Println("password blocklist:", err)
+			}
+			f.Close()
+		}
+	}
+
+	// Password reset
+	passwordHandler := handlers.NewPasswordHandler(db, mailer, cfg.FRONTEND_URL)
+	if err := passwordHandler.EnsureIndexes(context.Background()); err != nil {
+		log.Println("password reset indexes:", err)
+	}
+	api.POST("/auth/password/forgot", passwordHandler.Forgot)
+	api.POST("/auth/password/reset", passwordHandler.Reset)
+	api.POST("/auth/password/change", handlers.AuthMiddleware(), passwordHandler.Change)
 
 	// Authentication
 	authHandler := handlers.NewAuthHandler(cfg)
 	api.GET("/auth/login/line", authHandler.LineLoginHandler)
 	api.GET("/auth/callback", authHandler.HandleCallback)
+	api.POST("/auth/line/liff", authHandler.LiffLogin)
+	api.POST("/auth/refresh", authHandler.Refresh)
+	api.POST("/auth/logout", authHandler.Logout)
+	api.POST("/auth/link/line", handlers.AuthMiddleware(), authHandler.LinkLine)
+	api.DELETE("/auth/link/line", handlers.AuthMiddleware(), authHandler.UnlinkLine)
+	api.POST("/auth/link/local", handlers.AuthMiddleware(), handlers.LinkLocalHandler(db, emailVerifier))
+
+	// OIDC providers (OIDC_PROVIDERS)
+	oidcHandler := handlers.NewOIDCHandler(db, authHandler, cfg.OIDCProviders)
+	api.GET("/auth/providers", oidcHandler.List)
+	api.GET("/auth/login/:provider", oidcHandler.Login)
+	api.GET("/auth/callback/:provider", oidcHandler.Callback)
+	api.POST("/auth/link/:provider", handlers.AuthMiddleware(), oidcHandler.Link)
+	api.DELETE("/auth/link/:provider", handlers.AuthMiddleware(), oidcHandler.Unlink)
 	api.GET("/profile", handlers.AuthMiddleware(), func(c *gin.Context) {
 		userId, _ := c.Get("userId")
 		role, _ := c.Get("role")
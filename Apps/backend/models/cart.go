@@ -13,7 +13,10 @@ type PremiumInfo struct {
 type CartEntry struct {
 	ID          primitive.ObjectID `bson:"_id" json:"id"`
 	PackageName string             `bson:"packageName" json:"packageName"`
+	InsuredID   string             `bson:"insuredId,omitempty" json:"insuredId,omitempty"`
+	InsuredName string             `bson:"insuredName,omitempty" json:"insuredName,omitempty"`
 	StartAge    int                `bson:"startAge" json:"startAge"`
+	StartDate   time.Time          `bson:"startDate,omitempty" json:"startDate,omitempty"`
 	EndAge      int                `bson:"endAge" json:"endAge"`
 	Premium     PremiumInfo        `bson:"premium" json:"premium"`
 	DateAdded   time.Time          `bson:"dateAdded" json:"dateAdded"`
@@ -0,0 +1,184 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// สถานะของแต่ละแถวในการนำเข้า
+const (
+	RowInsert    = "insert"
+	RowUpdate    = "update"
+	RowUnchanged = "unchanged"
+	RowConflict  = "conflict" // มีความต่างแต่ไม่ได้ใช้ force
+	RowInvalid   = "invalid"
+)
+
+type ImportRow struct {
+	Sheet    string      `json:"sheet,omitempty"` // ชื่อ sheet (เฉพาะ Excel)
+	Row      int         `json:"row"`             // ลำดับแถวในไฟล์ (เริ่มจาก 1 ไม่นับหัวตาราง)
+	ID       string      `json:"id"`
+	Name     string      `json:"name,omitempty"`
+	Status   string      `json:"status"`
+	Reasons  []string    `json:"reasons,omitempty"`
+	Warnings []string    `json:"warnings,omitempty"`
+	Diff     []FieldDiff `json:"diff,omitempty"`
+	// sheet ตารางเบี้ยที่ถูกรวมเข้ากับแถวนี้ (นับผลให้ sheet เหล่านั้นด้วย)
+	MergedSheets []string `json:"mergedSheets,omitempty"`
+}
+
+type ImportReport struct {
+	DryRun      bool          `json:"dryRun"`
+	Inserted    int           `json:"inserted"`
+	Updated     int           `json:"updated"`
+	Unchanged   int           `json:"unchanged"`
+	Invalid     int           `json:"invalid"`
+	Conflicts   []Conflict    `json:"conflicts"`
+	ConflictSet string        `json:"conflictSet,omitempty"` // ชุด conflict ที่เก็บไว้สำหรับ POST /api/upload/resolve
+	Rows        []ImportRow   `json:"rows"`
+	Sheets      []SheetReport `json:"sheets,omitempty"`
+}
+
+// สรุปผลราย sheet ของไฟล์ Excel
+type SheetReport struct {
+	Sheet     string `json:"sheet"`
+	PackageID string `json:"packageId,omitempty"` // จาก sheet map
+	Error     string `json:"error,omitempty"`     // อ่าน sheet นี้ไม่ได้ (ข้ามทั้ง sheet)
+	Inserted  int    `json:"inserted"`
+	Updated   int    `json:"updated"`
+	Unchanged int    `json:"unchanged"`
+	Invalid   int    `json:"invalid"`
+	Conflicts int    `json:"conflicts"`
+}
+
+// การจับคู่หัวคอลัมน์ในไฟล์กับฟิลด์ของ Package
+// Field เป็นชื่อ json ของ Package (เช่น minAge) หรือ pricing.ageFrom, pricing.ageTo,
+// pricing.female, pricing.male, pricing.ageRange สำหรับตารางเบี้ยแบบแบน
+type ColumnMapping struct {
+	Field      string   `json:"field" bson:"field"`
+	Headers    []string `json:"headers" bson:"headers"`
+	Multiplier float64  `json:"multiplier,omitempty" bson:"multiplier,omitempty"` // แปลงหน่วย เช่น 1000 สำหรับ "พันบาท" (0 = ไม่แปลง)
+}
+
+type ImportProfile struct {
+	ID        primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	Name      string             `json:"name" bson:"name"`
+	Columns   []ColumnMapping    `json:"columns" bson:"columns"`
+	UpdatedBy string             `json:"updatedBy,omitempty" bson:"updatedBy,omitempty"`
+	UpdatedAt *time.Time         `json:"updatedAt,omitempty" bson:"updatedAt,omitempty"`
+}
+
+// ตัวเลือกการแก้ conflict รายฟิลด์
+const (
+	ResolveKeepOld = "old"    // คงค่าเดิมในฐานข้อมูล
+	ResolveTakeNew = "new"    // ใช้ค่าจากไฟล์ที่อัปโหลด
+	ResolveCustom  = "custom" // ใช้ค่าที่ระบุใน Value
+)
+
+type FieldResolution struct {
+	Field  string      `json:"field"`
+	Choice string      `json:"choice"`
+	Value  interface{} `json:"value,omitempty"`
+}
+
+// การแก้ conflict ของแพ็กเกจหนึ่งรายการ (ค่าเดิมและค่าใหม่มาจาก PendingConflict ที่เก็บไว้ตอนอัปโหลด)
+type ConflictResolution struct {
+	ID     string            `json:"id"`
+	Fields []FieldResolution `json:"fields"`
+}
+
+// conflict จากการอัปโหลดที่รอแก้ หนึ่งเอกสารต่อแพ็กเกจ หมดอายุตาม ExpiresAt
+// Old คือแพ็กเกจตอนอัปโหลด (ใช้ตรวจว่ายังไม่ถูกแก้) New คือผลลัพธ์ถ้าใช้ค่าจากไฟล์ทุกฟิลด์ที่ต่างกัน
+type PendingConflict struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	SetID      primitive.ObjectID `bson:"setId"`
+	PackageID  string             `bson:"packageId"`
+	Old        Package            `bson:"old"`
+	New        Package            `bson:"new"`
+	FileName   string             `bson:"fileName,omitempty"`
+	UploadedBy string             `bson:"uploadedBy,omitempty"`
+	CreatedAt  time.Time          `bson:"createdAt"`
+	ExpiresAt  time.Time          `bson:"expiresAt"`
+}
+
+// แหล่งที่มาของ batch
+const (
+	BatchSourceUpload  = "upload"
+	BatchSourceResolve = "resolve"
+	BatchSourceWatch   = "watch" // ไฟล์จากโฟลเดอร์ที่เฝ้าดู (ImportWatcher)
+)
+
+// ประวัติการนำเข้าหนึ่งครั้ง ใช้สำหรับดูย้อนหลังและ undo
+// Inserted และ Updates[].After เป็นเอกสารหลังนำเข้า ใช้ตรวจว่าแพ็กเกจถูกแก้ไขไปแล้วหรือยังก่อน undo
+type ImportBatch struct {
+	ID          primitive.ObjectID   `json:"id" bson:"_id,omitempty"`
+	Source      string               `json:"source" bson:"source"`
+	FileName    string               `json:"fileName,omitempty" bson:"fileName,omitempty"`
+	FileHash    string               `json:"fileHash,omitempty" bson:"fileHash,omitempty"` // sha256 ของไฟล์
+	UploadedBy  string               `json:"uploadedBy,omitempty" bson:"uploadedBy,omitempty"`
+	CreatedAt   time.Time            `json:"createdAt" bson:"createdAt"`
+	InsertedIDs []primitive.ObjectID `json:"insertedIds" bson:"insertedIds"`
+	Inserted    []Package            `json:"-" bson:"inserted"`
+	Updates     []BatchUpdate        `json:"updates,omitempty" bson:"updates"`
+	UndoneAt    *time.Time           `json:"undoneAt,omitempty" bson:"undoneAt,omitempty"`
+	UndoneBy    string               `json:"undoneBy,omitempty" bson:"undoneBy,omitempty"`
+}
+
+// before-image ของแพ็กเกจที่ถูกอัปเดตใน batch
+// Before เป็นเอกสารเดิมทั้งก้อน (รวมฟิลด์ที่ Package ไม่รู้จัก) Fields คือฟิลด์ (ชื่อใน bson) ที่ batch แก้
+// undo คืนค่าเฉพาะ Fields จาก Before
+type BatchUpdate struct {
+	PackageID primitive.ObjectID `json:"packageId" bson:"packageId"`
+	Before    bson.M             `json:"before" bson:"before"`
+	Fields    []string           `json:"fields" bson:"fields"`
+	After     Package            `json:"-" bson:"after"`
+}
+
+// ตัวเลือกการอัปโหลดจาก query string (เก็บไว้กับ job เพื่อประมวลผลภายหลัง)
+type ImportOptions struct {
+	Profile       string            `json:"profile,omitempty" bson:"profile,omitempty"`
+	PackagePrefix string            `json:"packagePrefix,omitempty" bson:"packagePrefix,omitempty"`
+	Sheets        []string          `json:"sheets,omitempty" bson:"sheets,omitempty"`
+	SheetMap      map[string]string `json:"sheetMap,omitempty" bson:"sheetMap,omitempty"`
+	Pages         []int             `json:"pages,omitempty" bson:"pages,omitempty"` // PDF: หน้าที่มีตารางเบี้ย
+	Force         bool              `json:"force" bson:"force"`
+	DryRun        bool              `json:"dryRun" bson:"dryRun"`
+}
+
+// สถานะของ import job
+const (
+	JobQueued  = "queued"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+// ขั้นตอนของ import job
+const (
+	PhaseParse    = "parse"
+	PhaseValidate = "validate"
+	PhaseWrite    = "write"
+)
+
+// งานนำเข้าไฟล์แบบ asynchronous (ไฟล์ใหญ่) รายงานผลเก็บใน GridFS ให้ดาวน์โหลดภายหลัง
+type ImportJob struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Status     string             `json:"status" bson:"status"`
+	Phase      string             `json:"phase,omitempty" bson:"phase,omitempty"`
+	Progress   int                `json:"progress" bson:"progress"` // 0-100
+	Processed  int                `json:"processed" bson:"processed"`
+	Total      int                `json:"total" bson:"total"`
+	FileName   string             `json:"fileName" bson:"fileName"`
+	FileHash   string             `json:"fileHash" bson:"fileHash"`
+	FilePath   string             `json:"-" bson:"filePath"`
+	UploadedBy string             `json:"uploadedBy,omitempty" bson:"uploadedBy,omitempty"`
+	Options    ImportOptions      `json:"options" bson:"options"`
+	Error      string             `json:"error,omitempty" bson:"error,omitempty"`
+	BatchID    string             `json:"batchId,omitempty" bson:"batchId,omitempty"`
+	HasReport  bool               `json:"hasReport" bson:"hasReport,omitempty"` // รายงานอยู่ใน GridFS bucket import_reports (id เดียวกับ job)
+	CreatedAt  time.Time          `json:"createdAt" bson:"createdAt"`
+	StartedAt  *time.Time         `json:"startedAt,omitempty" bson:"startedAt,omitempty"`
+	FinishedAt *time.Time         `json:"finishedAt,omitempty" bson:"finishedAt,omitempty"`
+}
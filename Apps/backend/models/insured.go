@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ผู้เอาประกันที่อยู่ภายใต้บัญชีผู้ใช้ (ตัวเอง คู่สมรส บุตร บิดามารดา)
+type InsuredPerson struct {
+	ID           primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	UserID       string             `json:"userId" bson:"userId"`
+	Name         string             `json:"name" bson:"name"`
+	DateOfBirth  time.Time          `json:"dateOfBirth" bson:"dateOfBirth"`
+	Gender       string             `json:"gender" bson:"gender"`             // "male", "female"
+	Relationship string             `json:"relationship" bson:"relationship"` // "self", "spouse", "child", "parent"
+	CreatedAt    time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedAt    time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
+
+var Relationships = []string{"self", "spouse", "child", "parent"}
+
+type FamilyQuoteMember struct {
+	InsuredID    string  `json:"insuredId"`
+	Name         string  `json:"name"`
+	Relationship string  `json:"relationship"`
+	Age          int     `json:"age"`
+	Gender       string  `json:"gender"`
+	PackageName  string  `json:"packageName"`
+	PackageID    string  `json:"packageId,omitempty"`
+	CategoryID   string  `json:"categoryId,omitempty"`
+	Annual       float64 `json:"annual"`
+	Discount     float64 `json:"discount,omitempty"` // ส่วนลดของคนนี้ (โปรโมชั่นที่ไม่ใช่ family)
+	Eligible     bool    `json:"eligible"`
+	Reason       string  `json:"reason,omitempty"`
+}
+
+type FamilyQuote struct {
+	Members   []FamilyQuoteMember `json:"members"`
+	Insured   int                 `json:"insured"` // จำนวนคนที่ผ่านเงื่อนไข
+	Subtotal  float64             `json:"subtotal"`
+	Promotion string              `json:"promotion,omitempty"`
+	Discount  float64             `json:"discount"`
+	Total     float64             `json:"total"`
+}
@@ -11,7 +11,8 @@ type Pricing struct {
 
 type Package struct {
 	// ID                string    `json:"id" bson:"id"`
-	ID                primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"` // ใช้ primitive.ObjectID
+	ID                primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`       // ใช้ primitive.ObjectID
+	PackageID         string             `json:"packageId,omitempty" bson:"id,omitempty"` // id แบบข้อความที่ใช้อ้างอิงตอนอัปโหลด เช่น health-happy-kids-15m
 	Name              string             `json:"name" bson:"name"`
 	CategoryID        string             `json:"categoryId" bson:"categoryId"`
 	BaseMonthly       float64            `json:"baseMonthly" bson:"baseMonthly"`
@@ -21,5 +22,6 @@ type Package struct {
 	GenderRestriction string             `json:"genderRestriction" bson:"genderRestriction"`
 	MinAge            int                `json:"minAge" bson:"minAge"`
 	MaxAge            int                `json:"maxAge" bson:"maxAge"`
+	AgeRule           string             `json:"ageRule,omitempty" bson:"ageRule,omitempty"` // "last" (ค่าเริ่มต้น) หรือ "nearest"
 	Pricing           []Pricing          `json:"pricing" bson:"pricing"`
 }
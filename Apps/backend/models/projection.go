@@ -0,0 +1,35 @@
+package models
+
+// เบี้ยรายปีของแต่ละปีกรมธรรม์
+type PremiumYear struct {
+	Year       int     `json:"year"`       // ปีกรมธรรม์ที่ (เริ่มจาก 1)
+	Age        int     `json:"age"`        // อายุผู้เอาประกันในปีนั้น
+	AgeFrom    int     `json:"ageFrom"`    // ช่วงอายุของ pricing tier ที่ใช้
+	AgeTo      int     `json:"ageTo"`      //
+	Premium    float64 `json:"premium"`    // เบี้ยตามตาราง
+	Projected  float64 `json:"projected"`  // เบี้ยหลังปรับเงินเฟ้อ/ค่ารักษาพยาบาล
+	Increase   float64 `json:"increase"`   // ส่วนต่างจากปีก่อนหน้า
+	StepUp     bool    `json:"stepUp"`     // true เมื่อขึ้น tier ใหม่และเบี้ยเพิ่ม
+	Cumulative float64 `json:"cumulative"` // เบี้ยสะสมถึงปีนี้
+}
+
+type PremiumProjection struct {
+	PackageName   string        `json:"packageName"`
+	Gender        string        `json:"gender"`
+	StartAge      int           `json:"startAge"`
+	EndAge        int           `json:"endAge"`
+	InflationRate float64       `json:"inflationRate"`
+	MedicalTrend  float64       `json:"medicalTrend"`
+	Years         int           `json:"years"`
+	StepUps       int           `json:"stepUps"`
+	TotalPremium  float64       `json:"totalPremium"`
+	AverageAnnual float64       `json:"averageAnnual"`
+	Schedule      []PremiumYear `json:"schedule"`
+	Gaps          []AgeGap      `json:"gaps,omitempty"` // ช่วงอายุที่ตารางเบี้ยไม่ครอบคลุม (ไม่อยู่ใน Schedule และยอดรวม)
+}
+
+// ช่วงอายุ (รวมปลายทั้งสองด้าน) ที่ไม่มี pricing tier
+type AgeGap struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
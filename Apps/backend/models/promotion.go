@@ -6,10 +6,11 @@ type Promotion struct {
 	ID                 primitive.ObjectID `bson:"_id,omitempty"`
 	Name               string             `bson:"name"`
 	Description        string             `bson:"description"`
-	Type               string             `bson:"type"`                 // ประเภทของโปรโมชั่น: "general", "package", "category"
+	Type               string             `bson:"type"`                 // ประเภทของโปรโมชั่น: "general", "package", "category", "family"
 	DiscountPercentage float64            `bson:"discountPercentage"`   // ตัวคูณสำหรับการคำนวณ
 	ValidFrom          string             `bson:"validFrom"`            // วันที่เริ่มต้น
 	ValidTo            string             `bson:"validTo"`              // วันที่สิ้นสุด
 	PackageID          string             `bson:"packageId,omitempty"`  // สำหรับโปรโมชั่นเฉพาะแพ็กเกจ
 	CategoryID         string             `bson:"categoryId,omitempty"` // สำหรับโปรโมชั่นเฉพาะ category
+	MinInsured         int                `bson:"minInsured,omitempty"` // สำหรับโปรโมชั่นครอบครัว: จำนวนผู้เอาประกันขั้นต่ำ
 }
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type QuestionOption struct {
+	Value string `json:"value" bson:"value"`
+	Label string `json:"label" bson:"label"`
+}
+
+type Question struct {
+	Key      string           `json:"key" bson:"key"`
+	Text     string           `json:"text" bson:"text"`
+	Type     string           `json:"type" bson:"type"` // "number", "boolean", "choice", "multi"
+	Options  []QuestionOption `json:"options,omitempty" bson:"options,omitempty"`
+	Required bool             `json:"required" bson:"required"`
+	// ถ้าระบุ คำตอบ (ตัวเลข) คือทุนประกันที่มีอยู่แล้วใน category นี้ และจะถูกหักออกจากทุนที่แนะนำ
+	DeductFrom string `json:"deductFrom,omitempty" bson:"deductFrom,omitempty"`
+}
+
+// กฎให้คะแนน: เมื่อคำตอบของ Question ตรงเงื่อนไข จะเพิ่มคะแนนและทุนประกันให้ Category
+type ScoringRule struct {
+	Question string      `json:"question" bson:"question"`
+	Operator string      `json:"operator" bson:"operator"` // "eq", "ne", "gt", "gte", "lt", "lte", "contains"
+	Value    interface{} `json:"value" bson:"value"`
+	Category string      `json:"category" bson:"category"`
+	Points   float64     `json:"points" bson:"points"`
+	// ทุนประกันที่แนะนำ = CoverageAmount + CoverageIncomeMultiplier × รายได้ต่อปี
+	CoverageAmount           float64 `json:"coverageAmount" bson:"coverageAmount"`
+	CoverageIncomeMultiplier float64 `json:"coverageIncomeMultiplier" bson:"coverageIncomeMultiplier"`
+	Reason                   string  `json:"reason" bson:"reason"`
+}
+
+type Questionnaire struct {
+	ID        primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	Name      string             `json:"name" bson:"name"`
+	Active    bool               `json:"active" bson:"active"`
+	Questions []Question         `json:"questions" bson:"questions"`
+	Rules     []ScoringRule      `json:"rules" bson:"rules"`
+	IncomeKey string             `json:"incomeKey" bson:"incomeKey"` // คำถามที่เป็นรายได้ต่อปี
+	AgeKey    string             `json:"ageKey" bson:"ageKey"`       // ใช้กรองแพ็กเกจที่แนะนำ
+	GenderKey string             `json:"genderKey" bson:"genderKey"` //
+	MinScore  float64            `json:"minScore" bson:"minScore"`   // category ที่คะแนนต่ำกว่านี้จะไม่ถูกแนะนำ
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedAt time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
+
+type NeedsRecommendation struct {
+	Category string   `json:"category" bson:"category"`
+	Score    float64  `json:"score" bson:"score"`
+	Coverage float64  `json:"coverage" bson:"coverage"` // ทุนประกันที่แนะนำหลังหักทุนเดิม
+	Reasons  []string `json:"reasons" bson:"reasons"`
+	Packages []string `json:"packages" bson:"packages"`
+}
+
+type NeedsAssessment struct {
+	ID              primitive.ObjectID     `json:"id,omitempty" bson:"_id,omitempty"`
+	UserID          string                 `json:"userId" bson:"userId"`
+	QuestionnaireID primitive.ObjectID     `json:"questionnaireId" bson:"questionnaireId"`
+	Answers         map[string]interface{} `json:"answers" bson:"answers"`
+	Recommendations []NeedsRecommendation  `json:"recommendations" bson:"recommendations"`
+	CreatedAt       time.Time              `json:"createdAt" bson:"createdAt"`
+}
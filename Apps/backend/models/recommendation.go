@@ -0,0 +1,18 @@
+package models
+
+type BundleItem struct {
+	PackageName string  `json:"packageName"`
+	CategoryID  string  `json:"categoryId"`
+	Rider       bool    `json:"rider"`
+	Annual      float64 `json:"annual"`
+}
+
+// ชุดความคุ้มครองที่แนะนำภายใต้งบประมาณ
+type Bundle struct {
+	Items       []BundleItem `json:"items"`
+	Categories  []string     `json:"categories"`
+	TotalAnnual float64      `json:"totalAnnual"`
+	Remaining   float64      `json:"remaining"` // งบที่เหลือ
+	Score       float64      `json:"score"`
+	Explanation []string     `json:"explanation"`
+}
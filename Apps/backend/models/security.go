@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ตัวนับการเข้าสู่ระบบที่ผิดพลาด ID เป็น "user:<username>" หรือ "ip:<ip>"
+type LoginAttempt struct {
+	ID            string     `json:"key" bson:"_id"`
+	Failures      int        `json:"failures" bson:"failures"`
+	LastFailureAt time.Time  `json:"lastFailureAt" bson:"lastFailureAt"`
+	NextAttemptAt *time.Time `json:"nextAttemptAt,omitempty" bson:"nextAttemptAt,omitempty"` // progressive delay
+	LockedUntil   *time.Time `json:"lockedUntil,omitempty" bson:"lockedUntil,omitempty"`
+	LockCount     int        `json:"lockCount" bson:"lockCount"`
+	Pending       int        `json:"pending" bson:"pending"`       // ครั้งที่จองไว้และกำลังเทียบรหัสผ่าน
+	PendingAt     *time.Time `json:"-" bson:"pendingAt,omitempty"` // เวลาที่จองล่าสุด (ล้าง pending ที่ค้างจาก instance ที่ล่ม)
+	LastIP        string     `json:"lastIp,omitempty" bson:"lastIp,omitempty"`
+	ExpiresAt     time.Time  `json:"-" bson:"expiresAt"` // TTL
+}
+
+// ชนิดของ security event
+const (
+	EventAccountLocked   = "account_locked"
+	EventIPLocked        = "ip_locked"
+	EventUnlocked        = "unlocked"
+	EventRefreshReuse    = "refresh_token_reuse"
+	EventPasswordReset   = "password_reset"
+	EventPasswordChanged = "password_changed"
+)
+
+// เหตุการณ์ด้านความปลอดภัยสำหรับผู้ดูแลตรวจสอบย้อนหลัง
+type SecurityEvent struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Type        string             `json:"type" bson:"type"`
+	Username    string             `json:"username,omitempty" bson:"username,omitempty"`
+	UserID      string             `json:"userId,omitempty" bson:"userId,omitempty"`
+	IP          string             `json:"ip,omitempty" bson:"ip,omitempty"`
+	UserAgent   string             `json:"userAgent,omitempty" bson:"userAgent,omitempty"`
+	Failures    int                `json:"failures,omitempty" bson:"failures,omitempty"`
+	LockedUntil *time.Time         `json:"lockedUntil,omitempty" bson:"lockedUntil,omitempty"`
+	Actor       string             `json:"actor,omitempty" bson:"actor,omitempty"` // ผู้ดูแลที่ดำเนินการ (เช่น unlock)
+	Detail      string             `json:"detail,omitempty" bson:"detail,omitempty"`
+	CreatedAt   time.Time          `json:"createdAt" bson:"createdAt"`
+}
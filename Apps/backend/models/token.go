@@ -0,0 +1,57 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// refresh token ที่ออกให้ผู้ใช้ (เก็บเฉพาะ hash)
+// ทุกครั้งที่ refresh จะได้ token ใหม่ใน family เดิมและ token เก่าถูกทำเครื่องหมาย UsedAt
+// ถ้ามีการใช้ token ที่ถูกใช้ไปแล้วซ้ำ ถือว่ารั่วไหลและเพิกถอนทั้ง family
+type RefreshToken struct {
+	ID           primitive.ObjectID  `bson:"_id,omitempty"`
+	TokenHash    string              `bson:"tokenHash"`
+	FamilyID     string              `bson:"familyId"`
+	UserID       string              `bson:"userId"`
+	MFA          bool                `bson:"mfa,omitempty"` // family นี้เริ่มจากการเข้าสู่ระบบสองขั้นตอน
+	CreatedAt    time.Time           `bson:"createdAt"`
+	ExpiresAt    time.Time           `bson:"expiresAt"`
+	UsedAt       *time.Time          `bson:"usedAt,omitempty"`
+	ReplacedBy   *primitive.ObjectID `bson:"replacedBy,omitempty"`
+	RevokedAt    *time.Time          `bson:"revokedAt,omitempty"`
+	RevokeReason string              `bson:"revokeReason,omitempty"`
+	IP           string              `bson:"ip,omitempty"`
+	UserAgent    string              `bson:"userAgent,omitempty"`
+}
+
+// เหตุผลการเพิกถอน
+const (
+	RevokeLogout         = "logout"
+	RevokeReuse          = "reuse"
+	RevokeUser           = "user-missing"
+	RevokeReset          = "password-reset"
+	RevokePasswordChange = "password-change"
+)
+
+// รายการ access token ที่ถูกเพิกถอนก่อนหมดอายุ (ตรวจใน AuthMiddleware)
+// ID เป็น "jti:<jti>" สำหรับโทเค็นเดียว หรือ "sid:<familyId>" สำหรับทุกโทเค็นของ family
+// ลบอัตโนมัติด้วย TTL index เมื่อถึง ExpiresAt (access token หมดอายุเองแล้ว)
+type RevokedToken struct {
+	ID        string    `bson:"_id"`
+	Reason    string    `bson:"reason"`
+	CreatedAt time.Time `bson:"createdAt"`
+	ExpiresAt time.Time `bson:"expiresAt"`
+}
+
+// โทเค็นตั้งรหัสผ่านใหม่ (ใช้ได้ครั้งเดียวภายในเวลาที่กำหนด เก็บเฉพาะ hash)
+type PasswordReset struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	TokenHash string             `bson:"tokenHash"`
+	UserID    primitive.ObjectID `bson:"userId"`
+	Email     string             `bson:"email"`
+	CreatedAt time.Time          `bson:"createdAt"`
+	ExpiresAt time.Time          `bson:"expiresAt"`
+	UsedAt    *time.Time         `bson:"usedAt,omitempty"`
+	IP        string             `bson:"ip,omitempty"`
+}
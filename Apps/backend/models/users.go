@@ -6,14 +6,100 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// ค่าของ Provider (วิธีที่ใช้สร้างบัญชีครั้งแรก)
+const (
+	ProviderLocal = "local"
+	ProviderLine  = "Line"
+)
+
+// Identity.Provider ของ LINE (ชื่อ route /api/auth/link/line ซึ่ง OIDC_PROVIDERS ใช้ไม่ได้)
+const IdentityLine = "line"
+
+// ผู้ใช้หนึ่งคนต่อหนึ่งเอกสารใน users ไม่ว่าจะสมัครด้วยวิธีใด
+// JWT ใช้ ID (ObjectID hex) เป็น userId เสมอ
+// บัญชีเดียวกันเข้าสู่ระบบได้ทั้งรหัสผ่าน (มี Password) LINE และผู้ให้บริการ OIDC (มีใน Identities) เมื่อเชื่อมบัญชีแล้ว
 type User struct {
 	ID         primitive.ObjectID `bson:"_id,omitempty"`
 	Username   string             `bson:"username"`
-	Password   string             `bson:"password"`
-	LineUserID string             `bson:"lineUserId"`
+	Email      string             `bson:"email,omitempty"`
+	Password   string             `bson:"password,omitempty"`
+	Identities []Identity         `bson:"identities,omitempty"` // LINE และผู้ให้บริการ OIDC ที่ผูกไว้
 	Provider   string             `bson:"provider"`
 	Role       string             `bson:"role"`
 	CreatedAt  time.Time          `bson:"createdAt"`
 	UpdatedAt  time.Time          `bson:"updatedAt"`
 	LastLogin  time.Time          `bson:"lastLogin"`
+
+	// ข้อมูลพฤติกรรม/การใช้งาน
+	LoginCount   int       `bson:"loginCount"`
+	LastIP       string    `bson:"lastIP,omitempty"`
+	LastDevice   string    `bson:"lastDevice,omitempty"`
+	IsActive     bool      `bson:"isActive"`
+	LastActivity time.Time `bson:"lastActivity,omitempty"`
+
+	// nil = ไม่ต้องยืนยัน (LINE หรือบัญชีที่สร้างก่อนมีการยืนยันอีเมล)
+	EmailVerified *bool `bson:"emailVerified,omitempty"`
+
+	// TOTP 2FA: secret เข้ารหัสด้วย SECRET_KEY, RecoveryCodes เก็บเป็น sha256
+	TOTPEnabled   bool     `bson:"totpEnabled,omitempty"`
+	TOTPSecret    string   `bson:"totpSecret,omitempty"`
+	TOTPPending   string   `bson:"totpPending,omitempty"` // secret ที่รอยืนยันรหัสแรก
+	TOTPLastStep  int64    `bson:"totpLastStep,omitempty"`
+	RecoveryCodes []string `bson:"recoveryCodes,omitempty"`
+}
+
+// บัญชีของผู้ให้บริการที่ผูกกับผู้ใช้ (Provider = IdentityLine หรือชื่อใน OIDC_PROVIDERS, Subject = sub ใน ID token)
+type Identity struct {
+	Provider string    `bson:"provider"`
+	Subject  string    `bson:"sub"`
+	Email    string    `bson:"email,omitempty"`
+	LinkedAt time.Time `bson:"linkedAt"`
+}
+
+// เข้าสู่ระบบด้วยชื่อผู้ใช้/รหัสผ่านได้
+func (u User) HasPassword() bool {
+	return u.Password != ""
+}
+
+// ผูกผู้ให้บริการนี้ไว้แล้วหรือไม่
+func (u User) HasIdentity(provider string) bool {
+	for _, id := range u.Identities {
+		if id.Provider == provider {
+			return true
+		}
+	}
+	return false
+}
+
+// จำนวนวิธีเข้าสู่ระบบที่ใช้ได้ (ยกเลิกการผูกได้เมื่อยังเหลืออย่างน้อยหนึ่งวิธี)
+func (u User) LoginMethods() int {
+	n := len(u.Identities)
+	if u.HasPassword() {
+		n++
+	}
+	return n
+}
+
+// ข้อมูลที่ส่งให้ frontend (ไม่มีรหัสผ่านหรือ secret)
+func (u User) Profile() map[string]interface{} {
+	return map[string]interface{}{
+		"userId":        u.ID.Hex(),
+		"username":      u.Username,
+		"email":         u.Email,
+		"role":          u.Role,
+		"provider":      u.Provider,
+		"emailVerified": u.EmailVerified == nil || *u.EmailVerified,
+		"hasPassword":   u.HasPassword(),
+		"lineLinked":    u.HasIdentity(IdentityLine),
+		"totpEnabled":   u.TOTPEnabled,
+		"identities":    identityProviders(u.Identities),
+	}
+}
+
+func identityProviders(ids []Identity) []string {
+	out := make([]string, 0, len(ids))
+	for _, id := range ids {
+		out = append(out, id.Provider)
+	}
+	return out
 }
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// วิธีนับอายุทางประกันภัย กำหนดต่อแพ็กเกจใน models.Package.AgeRule
+const (
+	AgeRuleLastBirthday    = "last"    // อายุเต็มปี ณ วันเกิดครั้งล่าสุด
+	AgeRuleNearestBirthday = "nearest" // ปัดขึ้นเมื่อเลยวันเกิดล่าสุดมาแล้ว 6 เดือน
+)
+
+const dateLayout = "2006-01-02"
+
+// แปลงวันที่รูปแบบ YYYY-MM-DD (ค่าว่าง = วันนี้)
+func ParseDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		now := time.Now()
+		return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC), nil
+	}
+	t, err := time.Parse(dateLayout, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("วันที่ %q ต้องอยู่ในรูปแบบ YYYY-MM-DD", s)
+	}
+	return t, nil
+}
+
+// อายุเต็มปี ณ วันที่ระบุ (นับตามวันเกิดครั้งล่าสุด)
+func AgeLastBirthday(dob, on time.Time) int {
+	age := on.Year() - dob.Year()
+	if on.Month() < dob.Month() || (on.Month() == dob.Month() && on.Day() < dob.Day()) {
+		age--
+	}
+	if age < 0 {
+		return 0
+	}
+	return age
+}
+
+// อายุตามวันเกิดที่ใกล้ที่สุด: ถ้าเลยวันเกิดล่าสุดมาแล้วตั้งแต่ 6 เดือนขึ้นไปจะนับเป็นอายุถัดไป
+func AgeNearestBirthday(dob, on time.Time) int {
+	age := AgeLastBirthday(dob, on)
+	lastBirthday := dob.AddDate(age, 0, 0)
+	if !on.Before(lastBirthday.AddDate(0, 6, 0)) {
+		age++
+	}
+	return age
+}
+
+// อายุทางประกันภัย ณ วันเริ่มคุ้มครอง/วันเสนอราคา ตามกฎของแพ็กเกจ (ค่าว่าง = last)
+func InsuranceAge(dob, on time.Time, rule string) (int, error) {
+	if dob.IsZero() {
+		return 0, errors.New("ต้องระบุวันเกิด")
+	}
+	if on.Before(dob) {
+		return 0, errors.New("วันเริ่มคุ้มครองต้องไม่ก่อนวันเกิด")
+	}
+
+	if !ValidAgeRule(rule) {
+		return 0, fmt.Errorf("ไม่รู้จักกฎการนับอายุ %q", rule)
+	}
+	if strings.ToLower(strings.TrimSpace(rule)) == AgeRuleNearestBirthday {
+		return AgeNearestBirthday(dob, on), nil
+	}
+	return AgeLastBirthday(dob, on), nil
+}
+
+// ค่าว่างถือเป็น AgeRuleLastBirthday
+func ValidAgeRule(rule string) bool {
+	switch strings.ToLower(strings.TrimSpace(rule)) {
+	case "", AgeRuleLastBirthday, AgeRuleNearestBirthday:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func mustDate(s string) time.Time {
+	t, err := time.Parse(dateLayout, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestAgeLastBirthday(t *testing.T) {
+	tests := []struct {
+		dob, on string
+		want    int
+	}{
+		{"1990-04-15", "2020-04-14", 29},
+		{"1990-04-15", "2020-04-15", 30},
+		{"1990-04-15", "2020-12-31", 30},
+		{"1990-04-15", "1990-04-15", 0},
+		{"1990-04-15", "1989-01-01", 0}, // ก่อนวันเกิด
+		// เกิด 29 ก.พ.: ปีที่ไม่มี 29 ก.พ. อายุเพิ่มวันที่ 1 มี.ค.
+		{"2000-02-29", "2001-02-28", 0},
+		{"2000-02-29", "2001-03-01", 1},
+		{"2000-02-29", "2004-02-28", 3},
+		{"2000-02-29", "2004-02-29", 4},
+	}
+	for _, tt := range tests {
+		if got := AgeLastBirthday(mustDate(tt.dob), mustDate(tt.on)); got != tt.want {
+			t.Errorf("AgeLastBirthday(%s, %s) = %d, want %d", tt.dob, tt.on, got, tt.want)
+		}
+	}
+}
+
+func TestAgeNearestBirthday(t *testing.T) {
+	tests := []struct {
+		dob, on string
+		want    int
+	}{
+		{"1990-04-15", "2020-04-14", 30}, // ครบ 6 เดือนหลังวันเกิดปีก่อนแล้ว
+		{"1990-04-15", "2020-04-15", 30},
+		{"1990-04-15", "2020-10-14", 30}, // ขาดอีกหนึ่งวันจะครบ 6 เดือน
+		{"1990-04-15", "2020-10-15", 31}, // ครบ 6 เดือนพอดี
+		{"1990-04-15", "1990-10-14", 0},
+		{"1990-04-15", "1990-10-15", 1},
+		// เกิด 29 ก.พ.: วันเกิดในปีที่ไม่มี 29 ก.พ. คือ 1 มี.ค. และครบ 6 เดือนวันที่ 1 ก.ย.
+		{"2000-02-29", "2000-08-28", 0},
+		{"2000-02-29", "2000-08-29", 1},
+		{"2000-02-29", "2003-08-31", 3},
+		{"2000-02-29", "2003-09-01", 4},
+		{"2000-02-29", "2004-02-28", 4},
+		{"2000-02-29", "2004-08-28", 4},
+		{"2000-02-29", "2004-08-29", 5},
+	}
+	for _, tt := range tests {
+		if got := AgeNearestBirthday(mustDate(tt.dob), mustDate(tt.on)); got != tt.want {
+			t.Errorf("AgeNearestBirthday(%s, %s) = %d, want %d", tt.dob, tt.on, got, tt.want)
+		}
+	}
+}
+
+func TestInsuranceAge(t *testing.T) {
+	dob, on := mustDate("1990-04-15"), mustDate("2020-12-01")
+	for rule, want := range map[string]int{"": 30, AgeRuleLastBirthday: 30, " Nearest ": 31, AgeRuleNearestBirthday: 31} {
+		got, err := InsuranceAge(dob, on, rule)
+		if err != nil || got != want {
+			t.Errorf("InsuranceAge(rule %q) = %d, %v, want %d", rule, got, err, want)
+		}
+	}
+	if _, err := InsuranceAge(dob, on, "youngest"); err == nil {
+		t.Error("unknown rule: want error")
+	}
+	if _, err := InsuranceAge(time.Time{}, on, ""); err == nil {
+		t.Error("zero date of birth: want error")
+	}
+	if _, err := InsuranceAge(on, dob, ""); err == nil {
+		t.Error("start before birth: want error")
+	}
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"backend/models"
+	"strconv"
+	"strings"
+)
+
+// หัวคอลัมน์ของไฟล์ export ใช้ชื่อฟิลด์ตรงๆ จึงนำกลับเข้า DecodeTable ได้ทุก profile
+var (
+	ExportPackageColumns = []string{
+		"id", "name", "categoryId", "baseMonthly", "baseAnnual", "special", "subPackages",
+		"genderRestriction", "minAge", "maxAge", "ageRule",
+	}
+	ExportPricingColumns = []string{"pricing.ageFrom", "pricing.ageTo", "pricing.female", "pricing.male"}
+)
+
+func formatNumber(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+// ค่าของแพ็กเกจตามลำดับ ExportPackageColumns
+func ExportPackageRow(pkg models.Package) []string {
+	return []string{
+		pkg.PackageID,
+		pkg.Name,
+		pkg.CategoryID,
+		formatNumber(pkg.BaseMonthly),
+		formatNumber(pkg.BaseAnnual),
+		strconv.FormatBool(pkg.Special),
+		strings.Join(pkg.SubPackages, ","),
+		pkg.GenderRestriction,
+		strconv.Itoa(pkg.MinAge),
+		strconv.Itoa(pkg.MaxAge),
+		pkg.AgeRule,
+	}
+}
+
+// ค่าของ tier ตามลำดับ ExportPricingColumns
+func ExportPricingRow(t models.Pricing) []string {
+	return []string{strconv.Itoa(t.AgeFrom), strconv.Itoa(t.AgeTo), formatNumber(t.Female), formatNumber(t.Male)}
+}
+
+// ตารางแบบแถวละ tier (รูปแบบเดียวกับที่ DecodeTable รวมกลับเป็นแพ็กเกจ)
+// แถวแรกของแพ็กเกจมีข้อมูลครบ แถวต่อไปมีแค่ id กับ tier
+func ExportTable(pkgs []models.Package) (headers []string, rows [][]string) {
+	headers = append(append([]string{}, ExportPackageColumns...), ExportPricingColumns...)
+	blankPricing := make([]string, len(ExportPricingColumns))
+	for _, pkg := range pkgs {
+		first := ExportPackageRow(pkg)
+		if len(pkg.Pricing) == 0 {
+			rows = append(rows, append(first, blankPricing...))
+			continue
+		}
+		for i, t := range pkg.Pricing {
+			row := make([]string, len(ExportPackageColumns))
+			if i == 0 {
+				copy(row, first)
+			} else {
+				row[0] = pkg.PackageID
+			}
+			rows = append(rows, append(row, ExportPricingRow(t)...))
+		}
+	}
+	return headers, rows
+}
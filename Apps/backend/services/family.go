@@ -0,0 +1,68 @@
+package services
+
+import (
+	"backend/models"
+	"fmt"
+	"time"
+)
+
+// ตรวจสิทธิ์และคำนวณเบี้ยปีแรกของผู้เอาประกันหนึ่งคน ณ วันเริ่มคุ้มครอง on
+// อายุคำนวณจากวันเกิดตาม AgeRule ของแพ็กเกจ
+func QuoteMember(person models.InsuredPerson, pkg models.Package, on time.Time) models.FamilyQuoteMember {
+	member := models.FamilyQuoteMember{
+		Name:         person.Name,
+		Relationship: person.Relationship,
+		PackageName:  pkg.Name,
+		PackageID:    pkg.PackageID,
+		CategoryID:   pkg.CategoryID,
+	}
+
+	if !person.ID.IsZero() {
+		member.InsuredID = person.ID.Hex()
+	}
+
+	age, err := InsuranceAge(person.DateOfBirth, on, pkg.AgeRule)
+	if err != nil {
+		member.Reason = err.Error()
+		return member
+	}
+	member.Age = age
+
+	gender, err := NormalizeGender(person.Gender)
+	if err != nil {
+		member.Reason = err.Error()
+		return member
+	}
+	member.Gender = gender
+
+	if err := CheckEligibility(pkg, member.Age, gender); err != nil {
+		member.Reason = err.Error()
+		return member
+	}
+	tier, ok := FindPricingTier(pkg.Pricing, member.Age)
+	if !ok {
+		member.Reason = fmt.Sprintf("ตารางเบี้ยไม่ครอบคลุมอายุ %d", member.Age)
+		return member
+	}
+
+	member.Annual = TierPremium(tier, gender)
+	member.Eligible = true
+	return member
+}
+
+// รวมเบี้ยของสมาชิกที่ผ่านเงื่อนไข (ยังไม่หักส่วนลด)
+func SummarizeFamily(members []models.FamilyQuoteMember) models.FamilyQuote {
+	quote := models.FamilyQuote{Members: members}
+	counted := map[string]bool{}
+	for _, m := range members {
+		if !m.Eligible {
+			continue
+		}
+		quote.Subtotal += m.Annual
+		counted[m.InsuredID] = true
+	}
+	quote.Insured = len(counted)
+	quote.Subtotal = roundBaht(quote.Subtotal)
+	quote.Total = quote.Subtotal
+	return quote
+}
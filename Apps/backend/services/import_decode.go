@@ -0,0 +1,546 @@
+package services
+
+import (
+	"backend/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 1 record จากไฟล์นำเข้าที่แปลงเป็น Package แล้ว
+// Reasons คือปัญหาตอนแปลงชนิดข้อมูล (เช่นตัวเลขที่อ่านไม่ได้) ซึ่งทำให้ record นี้ไม่ถูกนำเข้า
+type ImportRecord struct {
+	Sheet   string // ชื่อ sheet (เฉพาะ Excel)
+	Row     int
+	Package models.Package
+	Reasons []string
+	// มีเฉพาะตารางเบี้ย (จาก rate sheet) — ถ้ามีแพ็กเกจเดิมจะแทนที่เฉพาะ pricing
+	PricingOnly bool
+	// ฟิลด์ (ชื่อ json ของ Package) ที่ไฟล์มีคอลัมน์หรือคีย์ ถ้ามีแพ็กเกจเดิมจะแทนที่เฉพาะฟิลด์เหล่านี้
+	// nil = ทุกฟิลด์
+	Fields map[string]bool
+	// sheet อื่นที่ตารางเบี้ยถูกรวมเข้ามาใน record นี้ (MergePricingRecords)
+	MergedSheets []string
+}
+
+// profile เริ่มต้น รองรับหัวคอลัมน์ตามชื่อฟิลด์และหัวคอลัมน์ภาษาไทยที่ใช้บ่อย
+func DefaultImportProfile() models.ImportProfile {
+	return models.ImportProfile{
+		Name: "default",
+		Columns: []models.ColumnMapping{
+			{Field: "id", Headers: []string{"id", "packageId", "รหัส", "รหัสแพ็กเกจ"}},
+			{Field: "name", Headers: []string{"name", "packageName", "ชื่อ", "ชื่อแพ็กเกจ"}},
+			{Field: "categoryId", Headers: []string{"categoryId", "category", "หมวด", "หมวดหมู่"}},
+			{Field: "baseMonthly", Headers: []string{"baseMonthly", "เบี้ยรายเดือน"}},
+			{Field: "baseAnnual", Headers: []string{"baseAnnual", "เบี้ยรายปี"}},
+			{Field: "special", Headers: []string{"special", "พิเศษ"}},
+			{Field: "subPackages", Headers: []string{"subPackages", "สัญญาเพิ่มเติม"}},
+			{Field: "genderRestriction", Headers: []string{"genderRestriction", "เพศที่รับ"}},
+			{Field: "minAge", Headers: []string{"minAge", "อายุต่ำสุด"}},
+			{Field: "maxAge", Headers: []string{"maxAge", "อายุสูงสุด"}},
+			{Field: "ageRule", Headers: []string{"ageRule", "วิธีนับอายุ"}},
+			{Field: "pricing", Headers: []string{"pricing", "ตารางเบี้ย"}},
+			{Field: "pricing.ageFrom", Headers: []string{"ageFrom", "อายุเริ่มต้น", "อายุตั้งแต่"}},
+			{Field: "pricing.ageTo", Headers: []string{"ageTo", "อายุสิ้นสุด", "อายุถึง"}},
+			{Field: "pricing.ageRange", Headers: []string{"ageRange", "ช่วงอายุ"}},
+			{Field: "pricing.female", Headers: []string{"female", "F", "หญิง", "เบี้ยหญิง"}},
+			{Field: "pricing.male", Headers: []string{"male", "M", "ชาย", "เบี้ยชาย"}},
+		},
+	}
+}
+
+// คอลัมน์ตารางเบี้ยแบบมี index เช่น pricing.0.male หรือ pricing[0].ageFrom
+var indexedPricingHeader = regexp.MustCompile(`^pricing(?:\[(\d+)\]|\.(\d+))\.?(agefrom|ageto|agerange|female|male)$`)
+
+type tableColumn struct {
+	field      string
+	tier       int // index ของ tier สำหรับคอลัมน์แบบ pricing.N.x (-1 = ไม่ใช่)
+	header     string
+	multiplier float64
+}
+
+func normalizeHeader(h string) string {
+	h = strings.TrimPrefix(h, "\ufeff")
+	h = strings.ToLower(strings.TrimSpace(h))
+	return strings.NewReplacer(" ", "", "_", "").Replace(h)
+}
+
+// จับคู่หัวคอลัมน์กับฟิลด์ตาม profile
+func resolveColumns(headers []string, profile models.ImportProfile) ([]*tableColumn, error) {
+	aliases := map[string]models.ColumnMapping{}
+	for _, col := range profile.Columns {
+		aliases[normalizeHeader(col.Field)] = col // ชื่อฟิลด์เอง เช่น pricing.ageFrom ใช้เป็นหัวคอลัมน์ได้เสมอ
+		for _, h := range col.Headers {
+			aliases[normalizeHeader(h)] = col
+		}
+	}
+
+	columns := make([]*tableColumn, len(headers))
+	hasID := false
+	for i, h := range headers {
+		key := normalizeHeader(h)
+		if col, ok := aliases[key]; ok {
+			columns[i] = &tableColumn{field: col.Field, tier: -1, header: h, multiplier: col.Multiplier}
+			hasID = hasID || col.Field == "id"
+			continue
+		}
+		if m := indexedPricingHeader.FindStringSubmatch(key); m != nil {
+			idx := m[1]
+			if idx == "" {
+				idx = m[2]
+			}
+			n, _ := strconv.Atoi(idx)
+			field := map[string]string{"agefrom": "ageFrom", "ageto": "ageTo", "agerange": "ageRange", "female": "female", "male": "male"}[m[3]]
+			columns[i] = &tableColumn{field: "pricing." + field, tier: n, header: h}
+		}
+	}
+
+	if !hasID {
+		var accepted []string
+		for _, col := range profile.Columns {
+			if col.Field == "id" {
+				accepted = col.Headers
+			}
+		}
+		return nil, fmt.Errorf("ไม่พบคอลัมน์ id (รองรับหัวคอลัมน์: %s)", strings.Join(accepted, ", "))
+	}
+	return columns, nil
+}
+
+// แปลงตาราง (CSV หรือ sheet ของ Excel) เป็น Package ตาม profile
+//
+// ตารางเบี้ยรองรับ 3 แบบ: คอลัมน์ pricing เป็น JSON, คอลัมน์แบบมี index (pricing.0.male)
+// และแบบแถวละ tier ซึ่งแถวที่ id ซ้ำ (หรือ id ว่าง) ต่อจากแถวก่อนจะถูกรวมเป็นแพ็กเกจเดียว
+// แถวที่ id ซ้ำแต่ไม่เข้ารูปแบบนี้เป็น record แยก (prepareImport รายงานว่า id ซ้ำ)
+func DecodeTable(headers []string, rows [][]string, profile models.ImportProfile) ([]ImportRecord, error) {
+	d, err := NewTableDecoder(headers, profile)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		d.Add(row)
+	}
+	return d.Records(), nil
+}
+
+// ตัวแปลงตารางแบบทีละแถว (กฎเดียวกับ DecodeTable) ใช้กับไฟล์ที่อ่านแบบ stream
+// แถวต่อท้ายได้เฉพาะ record ล่าสุด record ก่อนหน้าจึงครบแล้วและ Take ออกไปได้ระหว่างอ่าน
+type TableDecoder struct {
+	columns     []*tableColumn
+	fields      map[string]bool
+	pricingOnly bool
+	rowTiers    bool           // มีคอลัมน์ตารางเบี้ยแบบแถวละ tier
+	records     []ImportRecord // record ที่ยังไม่ถูก Take
+	head        []string       // แถวแรกของ record ล่าสุด
+	lastID      string         // id ของ record ล่าสุด
+	rows        int
+}
+
+func NewTableDecoder(headers []string, profile models.ImportProfile) (*TableDecoder, error) {
+	columns, err := resolveColumns(headers, profile)
+	if err != nil {
+		return nil, err
+	}
+	d := &TableDecoder{columns: columns, fields: columnFields(columns), pricingOnly: isPricingTable(columns)}
+	for _, col := range columns {
+		if col != nil && col.tier < 0 && strings.HasPrefix(col.field, "pricing.") {
+			d.rowTiers = true
+		}
+	}
+	return d, nil
+}
+
+// แถวนี้เป็น tier ถัดไปของ record ล่าสุดหรือไม่: id ว่างหรือเท่ากับ record นั้น มีค่าใน tier
+// และคอลัมน์อื่นว่างหรือเท่ากับแถวแรกของ record
+func (d *TableDecoder) continues(id string, row []string) bool {
+	if !d.rowTiers || len(d.records) == 0 || (id != "" && id != d.lastID) {
+		return false
+	}
+	head := d.head
+	hasTier := false
+	for c, col := range d.columns {
+		if col == nil || c >= len(row) || col.field == "id" {
+			continue
+		}
+		cell := strings.TrimSpace(row[c])
+		if cell == "" {
+			continue
+		}
+		if col.tier < 0 && strings.HasPrefix(col.field, "pricing.") {
+			hasTier = true
+			continue
+		}
+		if c >= len(head) || strings.TrimSpace(head[c]) != cell {
+			return false
+		}
+	}
+	return hasTier
+}
+
+// ฟิลด์ของ Package ที่ตารางมีคอลัมน์
+func columnFields(columns []*tableColumn) map[string]bool {
+	fields := map[string]bool{}
+	for _, col := range columns {
+		switch {
+		case col == nil:
+		case col.field == "id":
+			fields["packageId"] = true
+		case strings.HasPrefix(col.field, "pricing"):
+			fields["pricing"] = true
+		default:
+			fields[col.field] = true
+		}
+	}
+	return fields
+}
+
+// เพิ่มแถวข้อมูลถัดไป (แถวแรกหลังหัวตารางคือแถวที่ 1)
+func (d *TableDecoder) Add(row []string) {
+	d.rows++
+	rowNum := d.rows
+	if isBlankRow(row) {
+		return
+	}
+
+	var id string
+	for c, col := range d.columns {
+		if col != nil && col.field == "id" && c < len(row) {
+			id = strings.TrimSpace(row[c])
+		}
+	}
+
+	// แถวนี้ต่อท้าย record ล่าสุด (ตารางเบี้ยแบบแถวละ tier) หรือเริ่ม record ใหม่
+	if !d.continues(id, row) {
+		d.records = append(d.records, ImportRecord{Row: rowNum, PricingOnly: d.pricingOnly, Fields: d.fields})
+		d.head = append([]string(nil), row...)
+		d.lastID = id
+	}
+	rec := &d.records[len(d.records)-1]
+
+	var tier models.Pricing
+	hasTier := false
+	indexed := map[int]*models.Pricing{}
+
+	for c, col := range d.columns {
+		if col == nil || c >= len(row) {
+			continue
+		}
+		cell := strings.TrimSpace(row[c])
+		if cell == "" {
+			continue
+		}
+		fail := func(err error) {
+			rec.Reasons = append(rec.Reasons, fmt.Sprintf("แถว %d คอลัมน์ %q: %v", rowNum, col.header, err))
+		}
+
+		if strings.HasPrefix(col.field, "pricing.") {
+			target := &tier
+			if col.tier >= 0 {
+				if indexed[col.tier] == nil {
+					indexed[col.tier] = &models.Pricing{}
+				}
+				target = indexed[col.tier]
+			} else {
+				hasTier = true
+			}
+			if err := setPricingField(target, strings.TrimPrefix(col.field, "pricing."), cell, col.multiplier); err != nil {
+				fail(err)
+			}
+			continue
+		}
+
+		if err := setPackageField(&rec.Package, col.field, cell, col.multiplier); err != nil {
+			fail(err)
+		}
+	}
+
+	if hasTier {
+		rec.Package.Pricing = append(rec.Package.Pricing, tier)
+	}
+	keys := make([]int, 0, len(indexed))
+	for k := range indexed {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	for _, k := range keys {
+		rec.Package.Pricing = append(rec.Package.Pricing, *indexed[k])
+	}
+}
+
+// นำ record ที่ครบแล้ว (ทุกตัวยกเว้นตัวล่าสุดซึ่งแถวถัดไปอาจต่อ tier ได้) ออกจากตัวแปลง
+func (d *TableDecoder) Take() []ImportRecord {
+	if len(d.records) <= 1 {
+		return nil
+	}
+	done := d.records[:len(d.records)-1]
+	d.records = []ImportRecord{d.records[len(d.records)-1]}
+	return done
+}
+
+// record ที่เหลือทั้งหมด (เรียกเมื่ออ่านครบทุกแถวแล้ว)
+func (d *TableDecoder) Records() []ImportRecord {
+	return d.records
+}
+
+// ตารางที่มีแค่ id กับคอลัมน์ตารางเบี้ย (เช่น sheet Pricing จาก export) ถือเป็นตารางเบี้ยล้วน
+func isPricingTable(columns []*tableColumn) bool {
+	hasPricing := false
+	for _, col := range columns {
+		if col == nil || col.field == "id" {
+			continue
+		}
+		if !strings.HasPrefix(col.field, "pricing") {
+			return false
+		}
+		hasPricing = true
+	}
+	return hasPricing
+}
+
+func setPackageField(pkg *models.Package, field, cell string, multiplier float64) error {
+	switch field {
+	case "id":
+		pkg.PackageID = cell
+	case "name":
+		pkg.Name = cell
+	case "categoryId":
+		pkg.CategoryID = cell
+	case "genderRestriction":
+		pkg.GenderRestriction = cell
+	case "ageRule":
+		pkg.AgeRule = cell
+	case "subPackages":
+		pkg.SubPackages = nil
+		for _, sub := range strings.Split(cell, ",") {
+			if sub = strings.TrimSpace(sub); sub != "" {
+				pkg.SubPackages = append(pkg.SubPackages, sub)
+			}
+		}
+	case "special":
+		b, err := parseBool(cell)
+		if err != nil {
+			return err
+		}
+		pkg.Special = b
+	case "baseMonthly", "baseAnnual":
+		n, err := parseNumber(cell, multiplier)
+		if err != nil {
+			return err
+		}
+		if field == "baseMonthly" {
+			pkg.BaseMonthly = n
+		} else {
+			pkg.BaseAnnual = n
+		}
+	case "minAge", "maxAge":
+		n, err := parseInt(cell)
+		if err != nil {
+			return err
+		}
+		if field == "minAge" {
+			pkg.MinAge = n
+		} else {
+			pkg.MaxAge = n
+		}
+	case "pricing":
+		var pricing []models.Pricing
+		if err := json.Unmarshal([]byte(cell), &pricing); err != nil {
+			return errors.New("ต้องเป็น JSON array ของ {ageFrom, ageTo, female, male}")
+		}
+		pkg.Pricing = append(pkg.Pricing, pricing...)
+	default:
+		return fmt.Errorf("ไม่รู้จักฟิลด์ %q ใน profile", field)
+	}
+	return nil
+}
+
+func setPricingField(p *models.Pricing, field, cell string, multiplier float64) error {
+	switch field {
+	case "ageFrom", "ageTo":
+		n, err := parseInt(cell)
+		if err != nil {
+			return err
+		}
+		if field == "ageFrom" {
+			p.AgeFrom = n
+		} else {
+			p.AgeTo = n
+		}
+	case "ageRange":
+		from, to, err := ParseAgeRange(cell)
+		if err != nil {
+			return err
+		}
+		p.AgeFrom, p.AgeTo = from, to
+	case "female", "male":
+		n, err := parseNumber(cell, multiplier)
+		if err != nil {
+			return err
+		}
+		if field == "female" {
+			p.Female = n
+		} else {
+			p.Male = n
+		}
+	default:
+		return fmt.Errorf("ไม่รู้จักฟิลด์ pricing.%s ใน profile", field)
+	}
+	return nil
+}
+
+// ฟิลด์ของ Package ที่ record จาก JSON มีคีย์ (id คือ id แบบข้อความ)
+func PackageMapFields(m map[string]interface{}) map[string]bool {
+	fields := map[string]bool{}
+	for key := range m {
+		switch {
+		case key == "id" || key == "packageId":
+			fields["packageId"] = true
+		case resolvableFields[key]:
+			fields[key] = true
+		}
+	}
+	return fields
+}
+
+// แปลง record ที่มาจาก JSON (map) เป็น Package
+// ค่าตัวเลขที่มาเป็นข้อความจะถูกแปลงให้ ถ้าแปลงไม่ได้จะคืนเหตุผลกลับไป
+func DecodePackageMap(m map[string]interface{}) (models.Package, []string) {
+	var pkg models.Package
+	var reasons []string
+
+	rec := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		rec[k] = v
+	}
+	if id, ok := rec["id"]; ok && id != nil {
+		pkg.PackageID = strings.TrimSpace(fmt.Sprintf("%v", id))
+	}
+	delete(rec, "id")
+	delete(rec, "_id")
+
+	for _, key := range []string{"minAge", "maxAge", "baseMonthly", "baseAnnual"} {
+		s, ok := rec[key].(string)
+		if !ok {
+			continue
+		}
+		if strings.TrimSpace(s) == "" {
+			delete(rec, key)
+			continue
+		}
+		n, err := parseNumber(s, 0)
+		if err != nil {
+			reasons = append(reasons, fmt.Sprintf("%s: %v", key, err))
+			delete(rec, key)
+			continue
+		}
+		rec[key] = n
+	}
+	if s, ok := rec["special"].(string); ok {
+		b, err := parseBool(s)
+		if err != nil {
+			reasons = append(reasons, "special: "+err.Error())
+		}
+		rec["special"] = b
+	}
+	if s, ok := rec["subPackages"].(string); ok {
+		var p models.Package
+		_ = setPackageField(&p, "subPackages", s, 0)
+		rec["subPackages"] = p.SubPackages
+	}
+	if s, ok := rec["pricing"].(string); ok {
+		var pricing []interface{}
+		if err := json.Unmarshal([]byte(s), &pricing); err != nil {
+			reasons = append(reasons, "pricing: ต้องเป็น JSON array")
+			delete(rec, "pricing")
+		} else {
+			rec["pricing"] = pricing
+		}
+	}
+
+	id := pkg.PackageID
+	b, err := json.Marshal(rec)
+	if err == nil {
+		err = json.Unmarshal(b, &pkg)
+	}
+	if id != "" {
+		pkg.PackageID = id
+	}
+	if err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			reasons = append(reasons, fmt.Sprintf("%s: ต้องเป็น %s", typeErr.Field, typeErr.Type))
+		} else {
+			reasons = append(reasons, err.Error())
+		}
+	}
+	return pkg, reasons
+}
+
+// แปลงข้อความเป็นตัวเลขด้วย CleanValue แล้วคูณด้วย multiplier (0 = ไม่แปลงหน่วย)
+func parseNumber(s string, multiplier float64) (float64, error) {
+	n, err := CleanValue(s)
+	if err != nil {
+		return 0, err
+	}
+	if multiplier != 0 {
+		n *= multiplier
+	}
+	return n, nil
+}
+
+func parseInt(s string) (int, error) {
+	n, err := parseNumber(s, 0)
+	if err != nil {
+		return 0, err
+	}
+	if n != float64(int(n)) {
+		return 0, fmt.Errorf("%q ต้องเป็นจำนวนเต็ม", s)
+	}
+	return int(n), nil
+}
+
+func parseBool(s string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "true", "yes", "y", "1", "ใช่":
+		return true, nil
+	case "false", "no", "n", "0", "ไม่ใช่", "":
+		return false, nil
+	}
+	return false, fmt.Errorf("%q ต้องเป็น true/false", s)
+}
+
+var ageRangeSeparator = regexp.MustCompile(`\s*(?:-|–|ถึง|to)\s*`)
+
+// แปลงช่วงอายุ เช่น "11-15", "11ถึง15", "11 to 15" หรืออายุเดียว "60"
+func ParseAgeRange(s string) (int, int, error) {
+	parts := ageRangeSeparator.Split(strings.TrimSpace(s), -1)
+	if len(parts) == 1 {
+		n, err := parseInt(parts[0])
+		return n, n, err
+	}
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("ช่วงอายุ %q ไม่ถูกต้อง", s)
+	}
+	from, err := parseInt(parts[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	to, err := parseInt(parts[1])
+	if err != nil {
+		return 0, 0, err
+	}
+	return from, to, nil
+}
+
+func isBlankRow(row []string) bool {
+	for _, cell := range row {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
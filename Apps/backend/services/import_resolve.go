@@ -0,0 +1,78 @@
+package services
+
+import (
+	"backend/models"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// ฟิลด์ของ models.Package ที่แก้ผ่าน resolution ได้ (ชื่อตาม json tag ไม่รวม id)
+// ใช้ชื่อจาก struct แทนคีย์ของเอกสารเดิม ฟิลด์ omitempty ที่ยังไม่มีค่า (เช่น ageRule) จึงแก้ได้
+var resolvableFields = func() map[string]bool {
+	fields := map[string]bool{}
+	t := reflect.TypeOf(models.Package{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" && name != "id" && name != "packageId" {
+			fields[name] = true
+		}
+	}
+	return fields
+}()
+
+// ใช้ตัวเลือกรายฟิลด์กับเอกสารเดิม (existing และ incoming อยู่ในรูป map แบบ json ของ Package)
+// incoming คือค่าจากไฟล์ที่เก็บไว้ตอนอัปโหลด ฟิลด์ที่ไม่ได้ระบุจะคงค่าเดิม
+// ผลลัพธ์ต้องผ่าน ValidatePackage ก่อนถึงจะนำไปบันทึก
+func ApplyResolution(existing, incoming map[string]interface{}, res models.ConflictResolution) (models.Package, []string) {
+	var errs []string
+	doc := make(map[string]interface{}, len(existing))
+	for k, v := range existing {
+		doc[k] = v
+	}
+
+	seen := map[string]bool{}
+	for _, f := range res.Fields {
+		label := f.Field + ": "
+		if !resolvableFields[f.Field] {
+			errs = append(errs, label+"ไม่ใช่ฟิลด์ที่แก้ไขได้")
+			continue
+		}
+		if seen[f.Field] {
+			errs = append(errs, label+"ระบุซ้ำ")
+			continue
+		}
+		seen[f.Field] = true
+
+		switch f.Choice {
+		case models.ResolveKeepOld:
+		case models.ResolveTakeNew:
+			// ไม่มีในค่าจากไฟล์ = ฟิลด์ omitempty ที่ว่าง
+			if v, ok := incoming[f.Field]; ok {
+				doc[f.Field] = v
+			} else {
+				delete(doc, f.Field)
+			}
+		case models.ResolveCustom:
+			doc[f.Field] = f.Value
+		default:
+			errs = append(errs, fmt.Sprintf("%sไม่รู้จักตัวเลือก %q (ใช้ old, new หรือ custom)", label, f.Choice))
+		}
+	}
+
+	var pkg models.Package
+	b, err := json.Marshal(doc)
+	if err == nil {
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&pkg)
+	}
+	if err != nil {
+		return pkg, append(errs, "ชนิดข้อมูลไม่ถูกต้อง: "+err.Error())
+	}
+
+	validationErrs, _ := ValidatePackage(pkg)
+	return pkg, append(errs, validationErrs...)
+}
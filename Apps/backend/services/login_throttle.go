@@ -0,0 +1,70 @@
+package services
+
+import "time"
+
+// นโยบายจำกัดการเข้าสู่ระบบที่ผิดพลาด (ใช้แยกกันต่อบัญชีและต่อ IP)
+//
+//	ผิดครั้งที่ 1..FreeAttempts          ลองใหม่ได้ทันที
+//	ครั้งถัดไป                            ต้องรอ BaseDelay, 2×, 4×, ... ไม่เกิน MaxDelay
+//	ครบ MaxFailures ภายใน Window          ล็อก LockDuration และเพิ่มเป็นเท่าตัวทุกครั้งที่ถูกล็อกซ้ำ (ไม่เกิน MaxLockDuration)
+type LoginThrottle struct {
+	MaxFailures     int
+	FreeAttempts    int
+	Window          time.Duration
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+	LockDuration    time.Duration
+	MaxLockDuration time.Duration
+}
+
+// ค่าเริ่มต้นต่อบัญชี
+func DefaultAccountThrottle() LoginThrottle {
+	return LoginThrottle{
+		MaxFailures:     5,
+		FreeAttempts:    2,
+		Window:          15 * time.Minute,
+		BaseDelay:       time.Second,
+		MaxDelay:        30 * time.Second,
+		LockDuration:    15 * time.Minute,
+		MaxLockDuration: 24 * time.Hour,
+	}
+}
+
+// ค่าเริ่มต้นต่อ IP (หลายผู้ใช้อาจอยู่หลัง NAT เดียวกัน จึงผ่อนกว่าต่อบัญชี)
+func DefaultIPThrottle() LoginThrottle {
+	return LoginThrottle{
+		MaxFailures:     30,
+		FreeAttempts:    10,
+		Window:          15 * time.Minute,
+		BaseDelay:       time.Second,
+		MaxDelay:        10 * time.Second,
+		LockDuration:    15 * time.Minute,
+		MaxLockDuration: 24 * time.Hour,
+	}
+}
+
+// เวลาที่ต้องรอก่อนลองครั้งถัดไปหลังผิดมาแล้ว failures ครั้ง
+func (t LoginThrottle) Delay(failures int) time.Duration {
+	if failures <= t.FreeAttempts || t.BaseDelay <= 0 {
+		return 0
+	}
+	d := t.BaseDelay
+	for i := t.FreeAttempts + 1; i < failures && d < t.MaxDelay; i++ {
+		d *= 2
+	}
+	return min(d, t.MaxDelay)
+}
+
+// ครบจำนวนครั้งที่ต้องล็อกแล้วหรือยัง
+func (t LoginThrottle) ShouldLock(failures int) bool {
+	return t.MaxFailures > 0 && failures >= t.MaxFailures
+}
+
+// ระยะเวลาล็อกครั้งที่ lockCount (เริ่มจาก 1)
+func (t LoginThrottle) LockFor(lockCount int) time.Duration {
+	d := t.LockDuration
+	for i := 1; i < lockCount && d < t.MaxLockDuration; i++ {
+		d *= 2
+	}
+	return min(d, t.MaxLockDuration)
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// อีเมลแบบข้อความล้วน
+type Mail struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// ช่องทางส่งอีเมล เลือกจาก MAIL_DRIVER (smtp, file, log)
+type MailSender interface {
+	Send(ctx context.Context, m Mail) error
+}
+
+type MailConfig struct {
+	Driver   string // smtp | file | log (ว่าง = log)
+	From     string
+	Host     string
+	Port     string
+	Username string
+	Password string
+	Dir      string // โฟลเดอร์ของ file driver
+}
+
+func NewMailSender(cfg MailConfig) (MailSender, error) {
+	switch strings.ToLower(cfg.Driver) {
+	case "smtp":
+		if cfg.Host == "" || cfg.From == "" {
+			return nil, fmt.Errorf("mail: smtp driver needs SMTP_HOST and MAIL_FROM")
+		}
+		port := cfg.Port
+		if port == "" {
+			port = "587"
+		}
+		return &SMTPSender{Host: cfg.Host, Port: port, Username: cfg.Username, Password: cfg.Password, From: cfg.From}, nil
+	case "file":
+		dir := cfg.Dir
+		if dir == "" {
+			dir = "mail"
+		}
+		return &FileSender{Dir: dir, From: cfg.From}, nil
+	case "", "log":
+		return LogSender{}, nil
+	}
+	return nil, fmt.Errorf("mail: unknown driver %q", cfg.Driver)
+}
+
+// ส่งผ่าน SMTP: พอร์ต 465 ใช้ TLS ตั้งแต่ต้น พอร์ตอื่นใช้ STARTTLS ถ้าเซิร์ฟเวอร์รองรับ
+type SMTPSender struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (s *SMTPSender) Send(ctx context.Context, m Mail) error {
+	addr := net.JoinHostPort(s.Host, s.Port)
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	var conn net.Conn
+	var err error
+	if s.Port == "465" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: s.Host})
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, s.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: s.Host}); err != nil {
+			return err
+		}
+	}
+	if s.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.Username, s.Password, s.Host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(s.From); err != nil {
+		return err
+	}
+	if err := client.Rcpt(m.To); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(formatMail(s.From, m)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// เขียนอีเมลเป็นไฟล์ .eml (สำหรับ dev/test เปิดดูลิงก์ได้โดยไม่ต้องมีเมลเซิร์ฟเวอร์)
+type FileSender struct {
+	Dir  string
+	From string
+}
+
+func (s *FileSender) Send(ctx context.Context, m Mail) error {
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s_%s.eml", time.Now().Format("20060102-150405.000"), safeFileName(m.To))
+	return os.WriteFile(filepath.Join(s.Dir, name), formatMail(s.From, m), 0o600)
+}
+
+// พิมพ์อีเมลลง log (ค่าเริ่มต้นเมื่อไม่ได้ตั้ง MAIL_DRIVER)
+type LogSender struct{}
+
+func (LogSender) Send(ctx context.Context, m Mail) error {
+	log.Printf("mail to %s: %s\n%s", m.To, m.Subject, m.Body)
+	return nil
+}
+
+func formatMail(from string, m Mail) []byte {
+	var b strings.Builder
+	if from != "" {
+		b.WriteString("From: " + from + "\r\n")
+	}
+	b.WriteString("To: " + m.To + "\r\n")
+	b.WriteString("Subject: " + mime.BEncoding.Encode("UTF-8", m.Subject) + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(m.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+func safeFileName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' || r < ' ' {
+			return '_'
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,235 @@
+package services
+
+import (
+	"backend/models"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const packagesPerNeed = 3
+
+// ตรวจคำตอบตามชนิดคำถาม และคืนคำตอบที่แปลงชนิดแล้ว (number → float64, boolean → bool, multi → []string)
+func ValidateAnswers(q models.Questionnaire, answers map[string]interface{}) (map[string]interface{}, error) {
+	clean := map[string]interface{}{}
+	for _, question := range q.Questions {
+		raw, ok := answers[question.Key]
+		if !ok || raw == nil || raw == "" {
+			if question.Required {
+				return nil, fmt.Errorf("กรุณาตอบคำถาม %s", question.Key)
+			}
+			continue
+		}
+
+		switch question.Type {
+		case "number":
+			n, ok := toFloat(raw)
+			if !ok {
+				return nil, fmt.Errorf("คำตอบของ %s ต้องเป็นตัวเลข", question.Key)
+			}
+			clean[question.Key] = n
+		case "boolean":
+			b, ok := raw.(bool)
+			if !ok {
+				return nil, fmt.Errorf("คำตอบของ %s ต้องเป็น true/false", question.Key)
+			}
+			clean[question.Key] = b
+		case "choice":
+			s := fmt.Sprintf("%v", raw)
+			if !hasOption(question.Options, s) {
+				return nil, fmt.Errorf("คำตอบของ %s ไม่อยู่ในตัวเลือก", question.Key)
+			}
+			clean[question.Key] = s
+		case "multi":
+			list, ok := raw.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("คำตอบของ %s ต้องเป็นรายการ", question.Key)
+			}
+			values := make([]string, 0, len(list))
+			for _, v := range list {
+				s := fmt.Sprintf("%v", v)
+				if !hasOption(question.Options, s) {
+					return nil, fmt.Errorf("คำตอบ %s ของ %s ไม่อยู่ในตัวเลือก", s, question.Key)
+				}
+				values = append(values, s)
+			}
+			clean[question.Key] = values
+		default:
+			clean[question.Key] = raw
+		}
+	}
+	return clean, nil
+}
+
+// ให้คะแนนคำตอบตามกฎของแบบสอบถาม แล้วจับคู่ category กับแพ็กเกจในแคตตาล็อก
+// answers ต้องผ่าน ValidateAnswers มาก่อน
+func ScoreNeeds(q models.Questionnaire, answers map[string]interface{}, catalog []models.Package) []models.NeedsRecommendation {
+	income, _ := toFloat(answers[q.IncomeKey])
+
+	byCategory := map[string]*models.NeedsRecommendation{}
+	get := func(cat string) *models.NeedsRecommendation {
+		if byCategory[cat] == nil {
+			byCategory[cat] = &models.NeedsRecommendation{Category: cat, Reasons: []string{}, Packages: []string{}}
+		}
+		return byCategory[cat]
+	}
+
+	for _, rule := range q.Rules {
+		if !matchRule(rule, answers[rule.Question]) {
+			continue
+		}
+		rec := get(rule.Category)
+		rec.Score += rule.Points
+		rec.Coverage += rule.CoverageAmount + rule.CoverageIncomeMultiplier*income
+		if rule.Reason != "" {
+			rec.Reasons = append(rec.Reasons, rule.Reason)
+		}
+	}
+
+	// หักทุนประกันที่มีอยู่แล้ว
+	for _, question := range q.Questions {
+		if question.DeductFrom == "" {
+			continue
+		}
+		existing, ok := toFloat(answers[question.Key])
+		if !ok || existing <= 0 {
+			continue
+		}
+		if rec, ok := byCategory[question.DeductFrom]; ok {
+			rec.Coverage -= existing
+			rec.Reasons = append(rec.Reasons, fmt.Sprintf("หักทุนประกันเดิม %.0f บาท", existing))
+			if rec.Coverage < 0 {
+				rec.Coverage = 0
+			}
+		}
+	}
+
+	age, hasAge := toFloat(answers[q.AgeKey])
+	gender, genderErr := NormalizeGender(fmt.Sprintf("%v", answers[q.GenderKey]))
+
+	var results []models.NeedsRecommendation
+	for _, rec := range byCategory {
+		if rec.Score <= 0 || rec.Score < q.MinScore {
+			continue
+		}
+		rec.Coverage = roundBaht(rec.Coverage)
+
+		// แพ็กเกจใน category ที่ผู้ตอบมีสิทธิ์ซื้อ เรียงจากเบี้ยต่ำไปสูง
+		type candidate struct {
+			name    string
+			premium float64
+		}
+		var candidates []candidate
+		for _, p := range catalog {
+			if p.CategoryID != rec.Category {
+				continue
+			}
+			premium := 0.0
+			if hasAge && genderErr == nil {
+				if CheckEligibility(p, int(age), gender) != nil {
+					continue
+				}
+				if tier, ok := FindPricingTier(p.Pricing, int(age)); ok {
+					premium = TierPremium(tier, gender)
+				}
+			}
+			candidates = append(candidates, candidate{p.Name, premium})
+		}
+		sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].premium < candidates[j].premium })
+		for i := 0; i < len(candidates) && i < packagesPerNeed; i++ {
+			rec.Packages = append(rec.Packages, candidates[i].name)
+		}
+
+		results = append(results, *rec)
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Category < results[j].Category
+	})
+	return results
+}
+
+// ค่าว่างถือเป็น "eq"
+func ValidRuleOperator(op string) bool {
+	switch op {
+	case "", "eq", "ne", "gt", "gte", "lt", "lte", "contains":
+		return true
+	}
+	return false
+}
+
+func matchRule(rule models.ScoringRule, answer interface{}) bool {
+	if answer == nil {
+		return false
+	}
+
+	switch rule.Operator {
+	case "contains":
+		list, ok := answer.([]string)
+		if !ok {
+			return false
+		}
+		want := fmt.Sprintf("%v", rule.Value)
+		for _, v := range list {
+			if v == want {
+				return true
+			}
+		}
+		return false
+	case "gt", "gte", "lt", "lte":
+		a, ok1 := toFloat(answer)
+		b, ok2 := toFloat(rule.Value)
+		if !ok1 || !ok2 {
+			return false
+		}
+		switch rule.Operator {
+		case "gt":
+			return a > b
+		case "gte":
+			return a >= b
+		case "lt":
+			return a < b
+		default:
+			return a <= b
+		}
+	case "ne":
+		return fmt.Sprintf("%v", answer) != fmt.Sprintf("%v", rule.Value)
+	case "eq", "":
+		return fmt.Sprintf("%v", answer) == fmt.Sprintf("%v", rule.Value)
+	default:
+		// operator ที่ไม่รู้จัก (ข้อมูลเก่าก่อนมีการตรวจตอนสร้าง) ไม่ให้คะแนน
+		return false
+	}
+}
+
+func hasOption(options []models.QuestionOption, value string) bool {
+	for _, o := range options {
+		if o.Value == value {
+			return true
+		}
+	}
+	return false
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case string:
+		f, err := strconv.ParseFloat(strings.ReplaceAll(strings.TrimSpace(n), ",", ""), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,258 @@
+package services
+
+import (
+	"backend/utils"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ผู้ให้บริการ OpenID Connect (Google, Microsoft, Keycloak ฯลฯ) ที่อ่าน endpoint จาก discovery
+// ใช้ authorization code + PKCE (S256) + nonce และตรวจลายเซ็น ID token จาก jwks_uri
+type OIDCProvider struct {
+	Name         string // ใช้ใน URL: /api/auth/login/<name>
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	Client       *http.Client
+
+	mu        sync.Mutex
+	discovery *OIDCDiscovery
+	keys      *utils.JWKSCache
+}
+
+// ส่วนของ /.well-known/openid-configuration ที่ใช้
+type OIDCDiscovery struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	UserinfoEndpoint      string   `json:"userinfo_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	CodeChallengeMethods  []string `json:"code_challenge_methods_supported"`
+}
+
+// ข้อมูลผู้ใช้จาก ID token ที่ตรวจสอบแล้ว
+type OIDCIdentity struct {
+	Subject       string `json:"-"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"-"`
+	Name          string `json:"name"`
+	Username      string `json:"preferred_username"`
+	Picture       string `json:"picture"`
+	Nonce         string `json:"nonce"`
+}
+
+type idTokenClaims struct {
+	OIDCIdentity
+	RawEmailVerified interface{} `json:"email_verified"` // บางรายส่งเป็น string "true"
+	TenantID         string      `json:"tid"`
+	AuthorizedParty  string      `json:"azp"`
+	jwt.RegisteredClaims
+}
+
+// ผลของการแลก code
+type OIDCTokens struct {
+	AccessToken string `json:"access_token"`
+	IDToken     string `json:"id_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+var ErrOIDCNonce = errors.New("oidc: nonce mismatch")
+
+func (p *OIDCProvider) httpClient() *http.Client {
+	if p.Client != nil {
+		return p.Client
+	}
+	return &http.Client{Timeout: 10 * time.Second}
+}
+
+// โหลด discovery ครั้งแรกที่ใช้งาน (ผู้ให้บริการล่มตอนเริ่มโปรแกรมจะไม่ทำให้ backend เริ่มไม่ได้)
+// ถ้าโหลดไม่สำเร็จจะลองใหม่ในคำขอถัดไป
+func (p *OIDCProvider) Discover(ctx context.Context) (*OIDCDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+	d, err := p.fetchDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.discovery, p.keys = d, utils.NewJWKSCache(d.JWKSURI, p.httpClient())
+	return d, nil
+}
+
+func (p *OIDCProvider) fetchDiscovery(ctx context.Context) (*OIDCDiscovery, error) {
+	endpoint := strings.TrimRight(p.Issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.httpClient().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("oidc %s discovery: %w", p.Name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oidc %s discovery: %s", p.Name, resp.Status)
+	}
+	var d OIDCDiscovery
+	if err := json.NewDecoder(resp.Body).Decode(&d); err != nil {
+		return nil, fmt.Errorf("oidc %s discovery: %w", p.Name, err)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, fmt.Errorf("oidc %s discovery: missing endpoints", p.Name)
+	}
+	// issuer ในเอกสารต้องตรงกับที่ตั้งค่า (ยกเว้น Microsoft แบบ multi-tenant ที่มี {tenantid})
+	if !issuerMatches(d.Issuer, p.Issuer, "") && !strings.Contains(d.Issuer, "{tenantid}") {
+		return nil, fmt.Errorf("oidc %s discovery: issuer %q does not match %q", p.Name, d.Issuer, p.Issuer)
+	}
+	return &d, nil
+}
+
+func issuerMatches(got, want, tenantID string) bool {
+	if tenantID != "" {
+		want = strings.ReplaceAll(want, "{tenantid}", tenantID)
+	}
+	return strings.TrimRight(got, "/") == strings.TrimRight(want, "/")
+}
+
+// ---------- PKCE ----------
+
+// code_verifier สุ่มและ code_challenge แบบ S256 (RFC 7636)
+func NewPKCE() (verifier, challenge string) {
+	verifier = utils.GenerateSecureState()
+	verifier = strings.TrimRight(verifier, "=")
+	return verifier, PKCEChallenge(verifier)
+}
+
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// ---------- Flow ----------
+
+// URL สำหรับ redirect ผู้ใช้ไปเข้าสู่ระบบ
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	d, err := p.Discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	scopes := p.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "email", "profile"}
+	}
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", p.ClientID)
+	q.Set("redirect_uri", p.RedirectURL)
+	q.Set("scope", strings.Join(scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", codeChallenge)
+	q.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return d.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// แลก authorization code เป็นโทเค็น (ส่ง code_verifier ของ PKCE)
+func (p *OIDCProvider) Exchange(ctx context.Context, code, codeVerifier string) (*OIDCTokens, error) {
+	d, err := p.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.RedirectURL)
+	form.Set("client_id", p.ClientID)
+	form.Set("code_verifier", codeVerifier)
+	if p.ClientSecret != "" {
+		form.Set("client_secret", p.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.httpClient().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("oidc %s token: %w", p.Name, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oidc %s token: %s: %s", p.Name, resp.Status, strings.TrimSpace(string(body)))
+	}
+	var tokens OIDCTokens
+	if err := json.Unmarshal(body, &tokens); err != nil {
+		return nil, fmt.Errorf("oidc %s token: %w", p.Name, err)
+	}
+	if tokens.IDToken == "" {
+		return nil, fmt.Errorf("oidc %s token: no id_token (is the openid scope requested?)", p.Name)
+	}
+	return &tokens, nil
+}
+
+// ตรวจ ID token: ลายเซ็น (jwks_uri), iss, aud = ClientID, exp และ nonce
+func (p *OIDCProvider) VerifyIDToken(ctx context.Context, raw, nonce string) (*OIDCIdentity, error) {
+	d, err := p.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	claims := &idTokenClaims{}
+	_, err = jwt.ParseWithClaims(raw, claims, p.keys.Keyfunc(ctx),
+		jwt.WithValidMethods(utils.RemoteSigningMethods),
+		jwt.WithAudience(p.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("oidc %s id_token: %w", p.Name, err)
+	}
+	if !issuerMatches(claims.Issuer, d.Issuer, claims.TenantID) {
+		return nil, fmt.Errorf("oidc %s id_token: unexpected issuer %q", p.Name, claims.Issuer)
+	}
+	// มีหลาย audience ต้องระบุ azp เป็นของเรา
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.ClientID {
+		return nil, fmt.Errorf("oidc %s id_token: unexpected azp %q", p.Name, claims.AuthorizedParty)
+	}
+	if nonce == "" || claims.Nonce != nonce {
+		return nil, ErrOIDCNonce
+	}
+	if claims.RegisteredClaims.Subject == "" {
+		return nil, fmt.Errorf("oidc %s id_token: missing sub", p.Name)
+	}
+
+	id := claims.OIDCIdentity
+	id.Subject = claims.RegisteredClaims.Subject
+	switch v := claims.RawEmailVerified.(type) {
+	case bool:
+		id.EmailVerified = v
+	case string:
+		id.EmailVerified = v == "true"
+	}
+	return &id, nil
+}
@@ -0,0 +1,274 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ผู้ให้บริการ OIDC จำลอง: discovery, authorize (ออก code), token (ตรวจ PKCE) และ jwks
+type mockIssuer struct {
+	t      *testing.T
+	srv    *httptest.Server
+	key    *rsa.PrivateKey
+	issuer string // issuer ใน discovery (ค่าว่าง = URL ของเซิร์ฟเวอร์)
+
+	mu    sync.Mutex
+	codes map[string]mockGrant
+}
+
+type mockGrant struct {
+	challenge string
+	nonce     string
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockIssuer{t: t, key: key, codes: map[string]mockGrant{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		issuer := m.issuer
+		if issuer == "" {
+			issuer = m.srv.URL
+		}
+		json.NewEncoder(w).Encode(OIDCDiscovery{
+			Issuer:                issuer,
+			AuthorizationEndpoint: m.srv.URL + "/authorize",
+			TokenEndpoint:         m.srv.URL + "/token",
+			JWKSURI:               m.srv.URL + "/jwks",
+			CodeChallengeMethods:  []string{"S256"},
+		})
+	})
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+			http.Error(w, "pkce required", http.StatusBadRequest)
+			return
+		}
+		code := "code-" + q.Get("state")
+		m.mu.Lock()
+		m.codes[code] = mockGrant{challenge: q.Get("code_challenge"), nonce: q.Get("nonce")}
+		m.mu.Unlock()
+		http.Redirect(w, r, q.Get("redirect_uri")+"?code="+code+"&state="+q.Get("state"), http.StatusFound)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		m.mu.Lock()
+		grant, ok := m.codes[r.PostForm.Get("code")]
+		delete(m.codes, r.PostForm.Get("code"))
+		m.mu.Unlock()
+		if !ok || r.PostForm.Get("grant_type") != "authorization_code" ||
+			PKCEChallenge(r.PostForm.Get("code_verifier")) != grant.challenge {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(OIDCTokens{
+			AccessToken: "access",
+			TokenType:   "Bearer",
+			IDToken: m.sign(jwt.MapClaims{
+				"iss":            m.srv.URL,
+				"aud":            r.PostForm.Get("client_id"),
+				"sub":            "user-1",
+				"email":          "user@example.com",
+				"email_verified": "true",
+				"nonce":          grant.nonce,
+				"iat":            time.Now().Unix(),
+				"exp":            time.Now().Add(time.Hour).Unix(),
+			}),
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		b64 := base64.RawURLEncoding
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "k1",
+			"use": "sig",
+			"alg": "RS256",
+			"n":   b64.EncodeToString(key.N.Bytes()),
+			"e":   b64.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	m.srv = httptest.NewServer(mux)
+	t.Cleanup(m.srv.Close)
+	return m
+}
+
+func (m *mockIssuer) sign(claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "k1"
+	raw, err := token.SignedString(m.key)
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	return raw
+}
+
+func (m *mockIssuer) provider() *OIDCProvider {
+	return &OIDCProvider{
+		Name:        "mock",
+		Issuer:      m.srv.URL,
+		ClientID:    "client-1",
+		RedirectURL: "https://app.example.com/callback",
+		Client:      m.srv.Client(),
+	}
+}
+
+// เข้าสู่ระบบผ่าน authorize endpoint แล้วคืน code จาก redirect
+func (m *mockIssuer) authorize(t *testing.T, authURL string) string {
+	t.Helper()
+	client := *m.srv.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize: %s", resp.Status)
+	}
+	loc, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc.Query().Get("code")
+}
+
+func TestOIDCCodeFlowWithPKCE(t *testing.T) {
+	m := newMockIssuer(t)
+	p := m.provider()
+	ctx := context.Background()
+
+	verifier, challenge := NewPKCE()
+	authURL, err := p.AuthCodeURL(ctx, "state-1", "nonce-1", challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(authURL, m.srv.URL+"/authorize?") {
+		t.Fatalf("auth url = %s", authURL)
+	}
+	q, _ := url.Parse(authURL)
+	for k, want := range map[string]string{"client_id": "client-1", "code_challenge": challenge, "code_challenge_method": "S256", "nonce": "nonce-1", "state": "state-1"} {
+		if got := q.Query().Get(k); got != want {
+			t.Errorf("%s = %q, want %q", k, got, want)
+		}
+	}
+
+	tokens, err := p.Exchange(ctx, m.authorize(t, authURL), verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := p.VerifyIDToken(ctx, tokens.IDToken, "nonce-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.Subject != "user-1" || id.Email != "user@example.com" || !id.EmailVerified {
+		t.Errorf("identity = %+v", id)
+	}
+}
+
+func TestOIDCExchangeWrongVerifier(t *testing.T) {
+	m := newMockIssuer(t)
+	p := m.provider()
+	ctx := context.Background()
+
+	_, challenge := NewPKCE()
+	authURL, err := p.AuthCodeURL(ctx, "state-1", "nonce-1", challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _ := NewPKCE()
+	if _, err := p.Exchange(ctx, m.authorize(t, authURL), other); err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Fatalf("err = %v, want invalid_grant", err)
+	}
+}
+
+func TestOIDCDiscoveryIssuerMismatch(t *testing.T) {
+	m := newMockIssuer(t)
+	m.issuer = "https://evil.example.com"
+	if _, err := m.provider().Discover(context.Background()); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Fatalf("err = %v, want issuer mismatch", err)
+	}
+}
+
+func TestOIDCVerifyIDToken(t *testing.T) {
+	m := newMockIssuer(t)
+	p := m.provider()
+	ctx := context.Background()
+
+	claims := func(change func(jwt.MapClaims)) string {
+		c := jwt.MapClaims{
+			"iss":   m.srv.URL,
+			"aud":   "client-1",
+			"sub":   "user-1",
+			"nonce": "nonce-1",
+			"iat":   time.Now().Unix(),
+			"exp":   time.Now().Add(time.Hour).Unix(),
+		}
+		if change != nil {
+			change(c)
+		}
+		return m.sign(c)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		nonce   string
+		wantErr string // ค่าว่าง = ผ่าน
+	}{
+		{"valid", claims(nil), "nonce-1", ""},
+		{"nonce mismatch", claims(nil), "nonce-2", ErrOIDCNonce.Error()},
+		{"nonce missing", claims(func(c jwt.MapClaims) { delete(c, "nonce") }), "nonce-1", ErrOIDCNonce.Error()},
+		{"issuer mismatch", claims(func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }), "nonce-1", "unexpected issuer"},
+		{"audience mismatch", claims(func(c jwt.MapClaims) { c["aud"] = "client-2" }), "nonce-1", "aud"},
+		{"multiple audiences without azp", claims(func(c jwt.MapClaims) { c["aud"] = []string{"client-1", "client-2"} }), "nonce-1", "unexpected azp"},
+		{"multiple audiences with other azp", claims(func(c jwt.MapClaims) {
+			c["aud"] = []string{"client-1", "client-2"}
+			c["azp"] = "client-2"
+		}), "nonce-1", "unexpected azp"},
+		{"multiple audiences with our azp", claims(func(c jwt.MapClaims) {
+			c["aud"] = []string{"client-1", "client-2"}
+			c["azp"] = "client-1"
+		}), "nonce-1", ""},
+		{"expired", claims(func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }), "nonce-1", "expired"},
+		{"missing sub", claims(func(c jwt.MapClaims) { delete(c, "sub") }), "nonce-1", "missing sub"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := p.VerifyIDToken(ctx, tt.token, tt.nonce)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if id.Subject != "user-1" {
+					t.Errorf("subject = %q", id.Subject)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+			if tt.wantErr == ErrOIDCNonce.Error() && !errors.Is(err, ErrOIDCNonce) {
+				t.Errorf("err = %v, want ErrOIDCNonce", err)
+			}
+		})
+	}
+}
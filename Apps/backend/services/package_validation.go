@@ -0,0 +1,70 @@
+package services
+
+import (
+	"backend/models"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ตรวจแพ็กเกจตามโครงสร้างและกฎของตารางเบี้ย
+// errs คือข้อผิดพลาดที่ทำให้นำเข้าไม่ได้ ส่วน warnings เป็นข้อสังเกตที่ยังนำเข้าได้
+func ValidatePackage(pkg models.Package) (errs []string, warnings []string) {
+	if strings.TrimSpace(pkg.PackageID) == "" {
+		errs = append(errs, "id: ต้องระบุ")
+	}
+	if strings.TrimSpace(pkg.Name) == "" {
+		errs = append(errs, "name: ต้องระบุ")
+	}
+	if pkg.MinAge < 0 {
+		errs = append(errs, "minAge: ต้องไม่ติดลบ")
+	}
+	if pkg.MaxAge > 0 && pkg.MaxAge < pkg.MinAge {
+		errs = append(errs, fmt.Sprintf("maxAge: ต้องไม่น้อยกว่า minAge (%d < %d)", pkg.MaxAge, pkg.MinAge))
+	}
+	if pkg.BaseMonthly < 0 || pkg.BaseAnnual < 0 {
+		errs = append(errs, "baseMonthly/baseAnnual: ต้องไม่ติดลบ")
+	}
+	if pkg.GenderRestriction != "" {
+		if _, err := NormalizeGender(pkg.GenderRestriction); err != nil {
+			errs = append(errs, "genderRestriction: "+err.Error())
+		}
+	}
+	if !ValidAgeRule(pkg.AgeRule) {
+		errs = append(errs, fmt.Sprintf("ageRule: ไม่รู้จักกฎ %q", pkg.AgeRule))
+	}
+
+	if len(pkg.Pricing) == 0 {
+		warnings = append(warnings, "pricing: ไม่มีตารางเบี้ย")
+		return errs, warnings
+	}
+
+	tiers := make([]models.Pricing, len(pkg.Pricing))
+	copy(tiers, pkg.Pricing)
+	sort.SliceStable(tiers, func(i, j int) bool { return tiers[i].AgeFrom < tiers[j].AgeFrom })
+
+	for i, t := range tiers {
+		label := fmt.Sprintf("pricing[%d-%d]", t.AgeFrom, t.AgeTo)
+		if t.AgeFrom > t.AgeTo {
+			errs = append(errs, label+": ageFrom ต้องไม่มากกว่า ageTo")
+		}
+		if t.Male < 0 || t.Female < 0 {
+			errs = append(errs, label+": เบี้ยต้องไม่ติดลบ")
+		}
+		if t.Male == 0 && t.Female == 0 {
+			warnings = append(warnings, label+": ไม่มีเบี้ยทั้งชายและหญิง")
+		}
+		if t.AgeFrom < pkg.MinAge || (pkg.MaxAge > 0 && t.AgeTo > pkg.MaxAge) {
+			errs = append(errs, fmt.Sprintf("%s: อยู่นอกช่วงอายุของแพ็กเกจ (%d-%d)", label, pkg.MinAge, pkg.MaxAge))
+		}
+		if i > 0 {
+			prev := tiers[i-1]
+			if t.AgeFrom <= prev.AgeTo {
+				errs = append(errs, fmt.Sprintf("%s: ช่วงอายุซ้อนกับ pricing[%d-%d]", label, prev.AgeFrom, prev.AgeTo))
+			} else if t.AgeFrom > prev.AgeTo+1 {
+				warnings = append(warnings, fmt.Sprintf("pricing: ไม่มีเบี้ยสำหรับอายุ %d-%d", prev.AgeTo+1, t.AgeFrom-1))
+			}
+		}
+	}
+	return errs, warnings
+}
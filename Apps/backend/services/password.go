@@ -0,0 +1,214 @@
+package services
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// รหัสกฎที่ไม่ผ่าน (ส่งให้ frontend ใน "rules" พร้อมข้อความ)
+const (
+	RulePasswordLength   = "length"
+	RulePasswordUpper    = "upper"
+	RulePasswordLower    = "lower"
+	RulePasswordDigit    = "digit"
+	RulePasswordSymbol   = "symbol"
+	RulePasswordUsername = "username"
+	RulePasswordEmail    = "email"
+	RulePasswordCommon   = "common"
+)
+
+// นโยบายรหัสผ่านสำหรับผู้ใช้ local (สมัคร ตั้งใหม่ และเปลี่ยนรหัสผ่าน)
+type PasswordPolicy struct {
+	MinLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	CheckCommon   bool // ปฏิเสธรหัสผ่านที่อยู่ในรายการรหัสผ่านยอดนิยม
+}
+
+// ค่าเริ่มต้น: ยาวอย่างน้อย 8 ตัวอักษรและไม่อยู่ในรายการยอดนิยม ไม่บังคับชนิดตัวอักษร
+var DefaultPasswordPolicy = PasswordPolicy{MinLength: 8, CheckCommon: true}
+
+// นโยบายที่ใช้งานอยู่ (ตั้งจาก PASSWORD_MIN_LENGTH / PASSWORD_REQUIRE ใน main)
+var CurrentPasswordPolicy = DefaultPasswordPolicy
+
+// "upper,digit,symbol" → เปิดกฎชนิดตัวอักษรตามรายการ คืนชื่อที่ไม่รู้จัก
+func (p *PasswordPolicy) SetRequired(list string) []string {
+	var unknown []string
+	p.RequireUpper, p.RequireLower, p.RequireDigit, p.RequireSymbol = false, false, false, false
+	for _, r := range strings.Split(list, ",") {
+		switch r = strings.ToLower(strings.TrimSpace(r)); r {
+		case "", "none":
+		case RulePasswordUpper:
+			p.RequireUpper = true
+		case RulePasswordLower:
+			p.RequireLower = true
+		case RulePasswordDigit:
+			p.RequireDigit = true
+		case RulePasswordSymbol:
+			p.RequireSymbol = true
+		default:
+			unknown = append(unknown, r)
+		}
+	}
+	return unknown
+}
+
+// ตัดช่องว่างหน้าและหลังรหัสผ่าน ใช้ทุกจุดก่อนตรวจนโยบาย แฮช และเทียบ
+// (สมัคร ตั้งใหม่ เปลี่ยน ตั้งรหัสผ่านให้บัญชี LINE และเข้าสู่ระบบ)
+func NormalizePassword(password string) string {
+	return strings.TrimSpace(password)
+}
+
+// ตรวจรหัสผ่านใหม่ คืนรหัสกฎที่ไม่ผ่าน (ว่าง = ผ่าน)
+// ตรวจหลัง NormalizePassword ช่องว่างหน้าและหลังจึงไม่นับเป็นสัญลักษณ์หรือความยาว
+func (p PasswordPolicy) Validate(password, username, email string) []string {
+	password = NormalizePassword(password)
+	var failed []string
+	if utf8.RuneCountInString(password) < p.MinLength {
+		failed = append(failed, RulePasswordLength)
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || r == ' ': // ช่องว่างระหว่างคำ (passphrase)
+			symbol = true
+		}
+	}
+	if p.RequireUpper && !upper {
+		failed = append(failed, RulePasswordUpper)
+	}
+	if p.RequireLower && !lower {
+		failed = append(failed, RulePasswordLower)
+	}
+	if p.RequireDigit && !digit {
+		failed = append(failed, RulePasswordDigit)
+	}
+	if p.RequireSymbol && !symbol {
+		failed = append(failed, RulePasswordSymbol)
+	}
+
+	lowered := strings.ToLower(password)
+	if containsIdentity(lowered, username) {
+		failed = append(failed, RulePasswordUsername)
+	}
+	// ทั้งอีเมลและส่วนหน้า @
+	local, _, _ := strings.Cut(email, "@")
+	if containsIdentity(lowered, email) || containsIdentity(lowered, local) {
+		failed = append(failed, RulePasswordEmail)
+	}
+
+	if p.CheckCommon && IsCommonPassword(password) {
+		failed = append(failed, RulePasswordCommon)
+	}
+	return failed
+}
+
+// ชื่อสั้นกว่า 3 ตัวอักษรไม่ตรวจ (ไม่เช่นนั้นรหัสผ่านแทบทุกตัวจะไม่ผ่าน)
+func containsIdentity(lowered, identity string) bool {
+	identity = strings.ToLower(strings.TrimSpace(identity))
+	return utf8.RuneCountInString(identity) >= 3 && strings.Contains(lowered, identity)
+}
+
+// ตรวจด้วยนโยบายที่ใช้งานอยู่
+func ValidatePassword(password, username, email string) []string {
+	return CurrentPasswordPolicy.Validate(password, username, email)
+}
+
+// ---------- รายการรหัสผ่านยอดนิยม ----------
+
+//go:embed common_passwords.txt
+var bundledCommonPasswords string
+
+var commonPasswords = map[string]bool{}
+
+func init() {
+	_ = AddCommonPasswords(strings.NewReader(bundledCommonPasswords))
+}
+
+// เพิ่มรายการจากไฟล์ (บรรทัดละหนึ่งรหัส ข้ามบรรทัดว่างและบรรทัดที่ขึ้นต้นด้วย #)
+// เรียกตอนเริ่มโปรแกรมเท่านั้น (map ไม่ได้ป้องกันการเขียนพร้อมกัน)
+func AddCommonPasswords(r io.Reader) error {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		commonPasswords[strings.ToLower(line)] = true
+	}
+	return sc.Err()
+}
+
+// ไม่สนตัวพิมพ์ และนับรวมแบบที่ต่อท้ายด้วยตัวเลข/สัญลักษณ์ เช่น "Password123!" หรือ "dragon2024"
+func IsCommonPassword(password string) bool {
+	p := strings.ToLower(strings.TrimSpace(password))
+	if commonPasswords[p] {
+		return true
+	}
+	base := strings.TrimRightFunc(p, func(r rune) bool {
+		return unicode.IsDigit(r) || unicode.IsPunct(r) || unicode.IsSymbol(r)
+	})
+	return utf8.RuneCountInString(base) >= 4 && commonPasswords[base]
+}
+
+// ---------- ข้อความ ----------
+
+// กฎที่ไม่ผ่านพร้อมข้อความสำหรับแสดงผู้ใช้
+type PasswordRuleError struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+var passwordRuleMessages = map[string]map[string]string{
+	"th": {
+		RulePasswordLength:   "ต้องมีความยาวอย่างน้อย %d ตัวอักษร",
+		RulePasswordUpper:    "ต้องมีตัวพิมพ์ใหญ่อย่างน้อย 1 ตัว",
+		RulePasswordLower:    "ต้องมีตัวพิมพ์เล็กอย่างน้อย 1 ตัว",
+		RulePasswordDigit:    "ต้องมีตัวเลขอย่างน้อย 1 ตัว",
+		RulePasswordSymbol:   "ต้องมีสัญลักษณ์อย่างน้อย 1 ตัว เช่น ! @ # $",
+		RulePasswordUsername: "ต้องไม่มีชื่อผู้ใช้อยู่ในรหัสผ่าน",
+		RulePasswordEmail:    "ต้องไม่มีอีเมลอยู่ในรหัสผ่าน",
+		RulePasswordCommon:   "รหัสผ่านนี้ถูกใช้บ่อยและคาดเดาได้ง่าย กรุณาเลือกรหัสอื่น",
+	},
+	"en": {
+		RulePasswordLength:   "Must be at least %d characters long",
+		RulePasswordUpper:    "Must contain at least one uppercase letter",
+		RulePasswordLower:    "Must contain at least one lowercase letter",
+		RulePasswordDigit:    "Must contain at least one digit",
+		RulePasswordSymbol:   "Must contain at least one symbol such as ! @ # $",
+		RulePasswordUsername: "Must not contain your username",
+		RulePasswordEmail:    "Must not contain your email address",
+		RulePasswordCommon:   "This password is too common and easy to guess; please choose another",
+	},
+}
+
+// ข้อความตามภาษา (Accept-Language) ภาษาที่ไม่รองรับใช้ภาษาไทย
+func DescribePasswordRules(failed []string, acceptLanguage string) []PasswordRuleError {
+	messages := passwordRuleMessages["th"]
+	if lang := strings.ToLower(strings.TrimSpace(acceptLanguage)); strings.HasPrefix(lang, "en") {
+		messages = passwordRuleMessages["en"]
+	}
+	out := make([]PasswordRuleError, 0, len(failed))
+	for _, rule := range failed {
+		msg := messages[rule]
+		if rule == RulePasswordLength {
+			msg = fmt.Sprintf(msg, CurrentPasswordPolicy.MinLength)
+		}
+		out = append(out, PasswordRuleError{Rule: rule, Message: msg})
+	}
+	return out
+}
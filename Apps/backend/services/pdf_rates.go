@@ -0,0 +1,572 @@
+package services
+
+import (
+	"backend/models"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ตารางเบี้ยใน PDF (เช่นเล่ม Benefits ของบริษัทประกัน)
+//
+//	อายุ (ปี) | แผน 1        | แผน 5        |      หรือ   อายุ (ปี) | 1000 | 1600 | ...   (+ ป้าย "เพศชาย")
+//	          | ชาย  | หญิง  | ชาย  | หญิง  |
+//	15 วัน - 5 | 53,500 | 47,600 | ...
+//
+// หัวตารางหาจากช่อง "อายุ" แล้วใช้ตำแหน่งแนวนอนของหัวคอลัมน์จับคู่ค่าในแต่ละแถว
+// แผนหนึ่งในตารางกลายเป็น 1 record (PricingOnly) เหมือน DecodeRateSheet
+// ตารางที่ต่อกัน (ซ้าย/ขวา หรือข้ามหน้า) และตารางชาย/หญิงที่แยกกันจะถูกรวมเป็นแผนเดียว
+
+var (
+	pdfAgeHeader = regexp.MustCompile(`^(ช่วง)?(อายุ|age)\s*(\(?\s*(ปี|years?)\s*\)?)?$`)
+	pdfAgeCell   = regexp.MustCompile(`^(\d{1,3})\s*(วัน|เดือน|ปี)?\s*(?:(?:-|–|ถึง)\s*(\d{1,3})\s*(ปี)?)?$`)
+	pdfSpaces    = regexp.MustCompile(`\s+`)
+)
+
+const (
+	pdfHeaderSpan = 30.0 // ระยะ (pt) เหนือ/ใต้ช่องอายุที่ถือเป็นหัวตาราง
+	pdfMaxRowGap  = 40.0 // ช่องว่างระหว่างแถวที่มากกว่านี้ถือว่าจบตาราง
+)
+
+type pdfRateColumn struct {
+	x, endX float64
+	plan    string
+	gender  string // "M", "F" หรือ "" (ใช้ทั้งสองเพศ)
+}
+
+func (c pdfRateColumn) center() float64 { return (c.x + c.endX) / 2 }
+
+// ช่องในหัวตารางพร้อมตำแหน่งแนวตั้งของบรรทัด
+type headerCell struct {
+	PDFCell
+	y float64
+}
+
+type pdfRateRow struct {
+	from, to int
+	values   map[int]float64 // index ของคอลัมน์ → เบี้ย
+}
+
+type pdfRateTable struct {
+	page    int
+	columns []pdfRateColumn
+	rows    []pdfRateRow
+}
+
+// ชื่อแผนตามลำดับคอลัมน์ (ใช้เทียบว่าสองตารางเป็นชุดแผนเดียวกัน)
+func (t *pdfRateTable) plans() []string {
+	var plans []string
+	for _, col := range t.columns {
+		if len(plans) == 0 || plans[len(plans)-1] != col.plan {
+			plans = append(plans, col.plan)
+		}
+	}
+	return plans
+}
+
+func (t *pdfRateTable) genders() string {
+	seen := map[string]bool{}
+	for _, col := range t.columns {
+		seen[col.gender] = true
+	}
+	var out []string
+	for g := range seen {
+		out = append(out, g)
+	}
+	sort.Strings(out)
+	return strings.Join(out, ",")
+}
+
+func pdfGender(text string) string {
+	t := strings.ToLower(pdfSpaces.ReplaceAllString(text, ""))
+	t = strings.TrimPrefix(t, "เพศ")
+	switch t {
+	case "ชาย", "male", "m":
+		return "M"
+	case "หญิง", "female", "f":
+		return "F"
+	}
+	return ""
+}
+
+func isPDFAgeHeader(text string) bool {
+	return pdfAgeHeader.MatchString(strings.ToLower(strings.TrimSpace(text)))
+}
+
+// ช่วงอายุในคอลัมน์อายุ เช่น "15 วัน - 5", "11 - 15*", "81 - 85 ปี" หรือ "30"
+// อายุหน่วยวัน/เดือนนับเป็น 0 ปี
+func parsePDFAge(text string) (int, int, bool) {
+	t := strings.TrimSpace(strings.Trim(strings.TrimSpace(text), "*"))
+	m := pdfAgeCell.FindStringSubmatch(t)
+	if m == nil {
+		return 0, 0, false
+	}
+	from, _ := strconv.Atoi(m[1])
+	if m[2] == "วัน" || m[2] == "เดือน" {
+		from = 0
+	}
+	to := from
+	if m[3] != "" {
+		to, _ = strconv.Atoi(m[3])
+	} else if m[2] == "วัน" || m[2] == "เดือน" {
+		to = 0
+	}
+	if to < from {
+		return 0, 0, false
+	}
+	return from, to, true
+}
+
+func parsePDFValue(text string) (float64, bool) {
+	t := strings.TrimSpace(text)
+	if t == "" || strings.IndexFunc(t, func(r rune) bool { return r >= '0' && r <= '9' }) < 0 {
+		return 0, false
+	}
+	v, err := CleanValue(t)
+	return v, err == nil
+}
+
+// หาตารางเบี้ยทั้งหมดในหน้าหนึ่ง (lines เรียงจากบนลงล่างแล้ว)
+func findPDFRateTables(page int, lines []PDFLine) []pdfRateTable {
+	type anchor struct {
+		line int
+		cell PDFCell
+		y    float64
+	}
+	var anchors []anchor
+	for i, line := range lines {
+		for _, cell := range line.Cells {
+			if isPDFAgeHeader(cell.Text) {
+				anchors = append(anchors, anchor{line: i, cell: cell, y: line.Y})
+			}
+		}
+	}
+
+	// ตารางที่วางเคียงกัน (หัวอยู่ระดับใกล้กัน) เรียงจากซ้ายไปขวา เพื่อให้ตารางที่ต่อกันอยู่ติดกัน
+	sort.SliceStable(anchors, func(i, j int) bool {
+		if math.Abs(anchors[i].y-anchors[j].y) <= pdfHeaderSpan {
+			return anchors[i].cell.X < anchors[j].cell.X
+		}
+		return anchors[i].y > anchors[j].y
+	})
+
+	var tables []pdfRateTable
+	for _, a := range anchors {
+		// ขอบขวาคือหัว "อายุ" ของตารางที่วางเคียงกัน
+		right := math.Inf(1)
+		for _, b := range anchors {
+			if b.cell.X > a.cell.X+10 && math.Abs(b.y-a.y) < pdfHeaderSpan+10 && b.cell.X < right {
+				right = b.cell.X
+			}
+		}
+		left := a.cell.X - 15
+		if t, ok := buildPDFRateTable(page, lines, a.line, a.cell, left, right); ok {
+			tables = append(tables, t)
+		}
+	}
+	return tables
+}
+
+func buildPDFRateTable(page int, lines []PDFLine, anchorLine int, ageCell PDFCell, left, right float64) (pdfRateTable, bool) {
+	anchorY := lines[anchorLine].Y
+	inRegion := func(c PDFCell) bool { return c.X >= left && c.X < right }
+
+	// แถวข้อมูลแรก: ช่องซ้ายสุดเป็นช่วงอายุและมีตัวเลขตามมา
+	firstData := -1
+	for i := anchorLine; i < len(lines) && lines[i].Y >= anchorY-2*pdfHeaderSpan-pdfMaxRowGap; i++ {
+		var cells []PDFCell
+		for _, c := range lines[i].Cells {
+			if inRegion(c) {
+				cells = append(cells, c)
+			}
+		}
+		if len(cells) < 2 {
+			continue
+		}
+		if _, _, ok := parsePDFAge(cells[0].Text); !ok || cells[0].X > ageCell.EndX+10 {
+			continue
+		}
+		if _, ok := parsePDFValue(cells[1].Text); ok {
+			firstData = i
+			break
+		}
+	}
+	if firstData < 0 {
+		return pdfRateTable{}, false
+	}
+
+	// หัวคอลัมน์: ช่องในบริเวณตารางที่อยู่ขวาของคอลัมน์อายุ ระหว่างหัว "อายุ" กับแถวข้อมูลแรก
+	var header [][]headerCell
+	for i, line := range lines {
+		if line.Y <= lines[firstData].Y || line.Y > anchorY+pdfHeaderSpan || i >= firstData {
+			continue
+		}
+		var cells []headerCell
+		for _, c := range line.Cells {
+			if inRegion(c) && c.X > ageCell.EndX-2 && !isPDFAgeHeader(c.Text) {
+				cells = append(cells, headerCell{PDFCell: c, y: line.Y})
+			}
+		}
+		if len(cells) > 0 {
+			header = append(header, cells)
+		}
+	}
+
+	var columns []pdfRateColumn
+	var captions []headerCell
+	genderY := anchorY
+	for _, cells := range header {
+		for _, c := range cells {
+			if g := pdfGender(c.Text); g != "" {
+				columns = append(columns, pdfRateColumn{x: c.X, endX: c.EndX, gender: g})
+				genderY = cells[0].y
+			} else if c.EndX <= right {
+				// หัวที่ยาวเกินขอบขวาเป็นชื่อเรื่องที่คร่อมหลายตาราง ไม่ใช่ชื่อแผน
+				captions = append(captions, c)
+			}
+		}
+	}
+	if len(columns) > 0 {
+		sort.Slice(columns, func(i, j int) bool { return columns[i].x < columns[j].x })
+		// ชื่อแผนคือหัวที่คร่อมกึ่งกลางคอลัมน์เพศ ถ้ามีหลายบรรทัดใช้บรรทัดที่ใกล้หัวเพศที่สุด
+		// ถ้าไม่มีหัวที่คร่อม ใช้หัวที่กึ่งกลางใกล้ที่สุดภายในระยะห่างของคอลัมน์ (หัวสั้นที่วางกลางคู่ชาย/หญิง)
+		spacing := math.Inf(1)
+		for i := 1; i < len(columns); i++ {
+			spacing = math.Min(spacing, columns[i].center()-columns[i-1].center())
+		}
+		for i := range columns {
+			center := columns[i].center()
+			best, nearest := math.Inf(1), spacing
+			for _, c := range captions {
+				if c.y < genderY {
+					continue
+				}
+				if c.X <= center && center <= c.EndX {
+					if d := c.y - genderY; d < best {
+						best, columns[i].plan = d, c.Text
+					}
+				} else if d := math.Abs((c.X+c.EndX)/2 - center); math.IsInf(best, 1) && d < nearest {
+					nearest, columns[i].plan = d, c.Text
+				}
+			}
+		}
+		numberRepeatedPlans(columns)
+	} else {
+		// ไม่มีหัวเพศ: บรรทัดหัวที่มีช่องมากที่สุดคือชื่อแผน เพศมาจากป้ายของตาราง (เช่น "เพศชาย")
+		widest := -1
+		for i, cells := range header {
+			if widest < 0 || len(cells) > len(header[widest]) {
+				widest = i
+			}
+		}
+		gender := pdfTableGender(lines, firstData, ageCell, left-40, right)
+		if widest >= 0 && len(header[widest]) > 1 {
+			for _, c := range header[widest] {
+				columns = append(columns, pdfRateColumn{x: c.X, endX: c.EndX, plan: c.Text, gender: gender})
+			}
+		} else {
+			for _, c := range lines[firstData].Cells {
+				if inRegion(c) && c.X > ageCell.EndX+10 {
+					columns = append(columns, pdfRateColumn{x: c.X, endX: c.EndX, gender: gender})
+				}
+			}
+			if len(columns) > 1 {
+				for i := range columns {
+					columns[i].plan = strconv.Itoa(i + 1)
+				}
+			}
+		}
+	}
+	if len(columns) == 0 {
+		return pdfRateTable{}, false
+	}
+
+	// ค่าในแถวจับคู่กับคอลัมน์ที่กึ่งกลางใกล้ที่สุด ภายในครึ่งหนึ่งของระยะห่างระหว่างคอลัมน์
+	tolerance := 30.0
+	for i := 1; i < len(columns); i++ {
+		tolerance = math.Min(tolerance, (columns[i].center()-columns[i-1].center())/2)
+	}
+	tolerance = math.Max(tolerance, 5)
+	right = math.Min(right, columns[len(columns)-1].endX+tolerance)
+
+	table := pdfRateTable{page: page, columns: columns}
+	lastY := lines[firstData].Y
+	for i := firstData; i < len(lines) && lastY-lines[i].Y <= pdfMaxRowGap; i++ {
+		var cells []PDFCell
+		for _, c := range lines[i].Cells {
+			if inRegion(c) {
+				cells = append(cells, c)
+			}
+		}
+		if len(cells) == 0 {
+			continue
+		}
+		if i > firstData && isPDFAgeHeader(cells[0].Text) {
+			break
+		}
+		if cells[0].X >= columns[0].x-5 {
+			continue
+		}
+		from, to, ok := parsePDFAge(cells[0].Text)
+		if !ok {
+			continue
+		}
+		row := pdfRateRow{from: from, to: to, values: map[int]float64{}}
+		shared := map[int]float64{}
+		for _, c := range cells[1:] {
+			v, ok := parsePDFValue(c.Text)
+			if !ok {
+				continue
+			}
+			center := (c.X + c.EndX) / 2
+			best, bestDist := -1, tolerance
+			for j, col := range columns {
+				if d := math.Abs(col.center() - center); d <= bestDist {
+					best, bestDist = j, d
+				}
+			}
+			if best < 0 {
+				continue
+			}
+			row.values[best] = v
+			// ค่าเดียวที่วางกลางระหว่างคอลัมน์ชาย/หญิงของแผนเดียวกัน คือเบี้ยที่ใช้ทั้งสองเพศ
+			for _, other := range []int{best - 1, best + 1} {
+				if other < 0 || other >= len(columns) || columns[other].plan != columns[best].plan || columns[other].gender == columns[best].gender {
+					continue
+				}
+				spacing := math.Abs(columns[other].center() - columns[best].center())
+				if bestDist > spacing/4 && math.Abs(columns[other].center()-center) <= spacing*3/4 {
+					shared[other] = v
+				}
+			}
+		}
+		for j, v := range shared {
+			if _, ok := row.values[j]; !ok {
+				row.values[j] = v
+			}
+		}
+		if len(row.values) == 0 {
+			continue
+		}
+		table.rows = append(table.rows, row)
+		lastY = lines[i].Y
+	}
+	if len(table.rows) < 2 {
+		return pdfRateTable{}, false
+	}
+	return table, true
+}
+
+// ป้ายเพศของทั้งตาราง (ตารางที่แยกชาย/หญิงเป็นคนละตาราง)
+// ป้ายมักเป็นข้อความแนวตั้งทางซ้ายของคอลัมน์อายุ จึงเลือกป้ายที่ใกล้คอลัมน์อายุที่สุด
+func pdfTableGender(lines []PDFLine, from int, ageCell PDFCell, left, right float64) string {
+	gender, best := "", math.Inf(1)
+	for i := from; i < len(lines); i++ {
+		for _, c := range lines[i].Cells {
+			if c.X < left || c.X >= right {
+				continue
+			}
+			if g := pdfGender(c.Text); g != "" && math.Abs(c.X-ageCell.X) < best {
+				gender, best = g, math.Abs(c.X-ageCell.X)
+			}
+		}
+	}
+	return gender
+}
+
+// คอลัมน์ที่ไม่มีชื่อแผน: ถ้าเพศซ้ำกันแปลว่ามีหลายแผน ตั้งชื่อแผนเป็นลำดับ 1, 2, ...
+func numberRepeatedPlans(columns []pdfRateColumn) {
+	plan, seen := 1, map[string]bool{}
+	repeated := false
+	for _, col := range columns {
+		if col.plan != "" {
+			continue
+		}
+		if seen[col.gender] {
+			repeated = true
+		}
+		seen[col.gender] = true
+	}
+	if !repeated {
+		return
+	}
+	clear(seen)
+	for i := range columns {
+		if columns[i].plan != "" {
+			continue
+		}
+		if seen[columns[i].gender] {
+			plan++
+			clear(seen)
+		}
+		seen[columns[i].gender] = true
+		columns[i].plan = strconv.Itoa(plan)
+	}
+}
+
+// กลุ่มของตารางที่เป็นแผนชุดเดียวกัน
+type pdfRateGroup struct {
+	page    int
+	plans   []string
+	genders string
+	maxAge  int
+	tiers   map[string]map[[2]int]*models.Pricing
+}
+
+func (g *pdfRateGroup) add(t pdfRateTable) {
+	for _, row := range t.rows {
+		for j, v := range row.values {
+			col := t.columns[j]
+			key := [2]int{row.from, row.to}
+			tier := g.tiers[col.plan][key]
+			if tier == nil {
+				tier = &models.Pricing{AgeFrom: row.from, AgeTo: row.to}
+				g.tiers[col.plan][key] = tier
+			}
+			switch col.gender {
+			case "M":
+				tier.Male = v
+			case "F":
+				tier.Female = v
+			default:
+				tier.Male, tier.Female = v, v
+			}
+		}
+		g.maxAge = max(g.maxAge, row.to)
+	}
+}
+
+func samePlans(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// รวมตารางที่ต่อกัน: ตารางเพศเดียวเติมเพศที่ขาดของตารางก่อนหน้าในหน้าเดียวกัน
+// ตารางที่ช่วงอายุต่อจากตารางก่อนหน้า (ชุดแผนเดียวกัน) ต่อท้ายเป็นแผนเดิม
+func groupPDFRateTables(tables []pdfRateTable) []*pdfRateGroup {
+	var groups []*pdfRateGroup
+	for _, t := range tables {
+		plans, genders := t.plans(), t.genders()
+		minAge := t.rows[0].from
+		for _, row := range t.rows {
+			minAge = min(minAge, row.from)
+		}
+
+		var target *pdfRateGroup
+		if n := len(groups); n > 0 {
+			last := groups[n-1]
+			switch {
+			case !samePlans(last.plans, plans):
+			case genders != last.genders && (genders == "M" || genders == "F") && last.page == t.page && !strings.Contains(last.genders, ","):
+				target = last
+				last.genders = "F,M"
+			case genders == last.genders && minAge > last.maxAge:
+				target = last
+			}
+		}
+		if target == nil {
+			target = &pdfRateGroup{page: t.page, plans: plans, genders: genders, tiers: map[string]map[[2]int]*models.Pricing{}}
+			for _, p := range plans {
+				target.tiers[p] = map[[2]int]*models.Pricing{}
+			}
+			groups = append(groups, target)
+		}
+		target.add(t)
+	}
+	return groups
+}
+
+// แปลงตารางเบี้ยใน PDF เป็น record ละแผน (PricingOnly) เพื่อเข้ากระบวนการ dry-run/conflict เดียวกับไฟล์อื่น
+// pages ว่างหมายถึงทุกหน้า
+// ไฟล์มาจากผู้ใช้: panic ใดๆ ในตัวอ่าน PDF กลายเป็น error ของไฟล์นั้นแทนการทำให้โปรแกรมล่ม
+func DecodeRatePDF(data []byte, pages []int, opts SheetOptions) (records []ImportRecord, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			records, err = nil, fmt.Errorf("อ่านไฟล์ PDF ไม่สำเร็จ (ไฟล์อาจเสียหาย): %v", r)
+		}
+	}()
+	lines, err := ExtractPDFLines(data)
+	if err != nil {
+		return nil, err
+	}
+	wanted := map[int]bool{}
+	for _, p := range pages {
+		wanted[p] = true
+	}
+
+	byPage := map[int][]PDFLine{}
+	var pageNums []int
+	for _, line := range lines {
+		if len(wanted) > 0 && !wanted[line.Page] {
+			continue
+		}
+		if _, ok := byPage[line.Page]; !ok {
+			pageNums = append(pageNums, line.Page)
+		}
+		byPage[line.Page] = append(byPage[line.Page], line)
+	}
+	var tables []pdfRateTable
+	for _, p := range pageNums {
+		tables = append(tables, findPDFRateTables(p, byPage[p])...)
+	}
+	if len(tables) == 0 {
+		return nil, errors.New("ไม่พบตารางเบี้ย (คอลัมน์อายุและเบี้ยชาย/หญิง) ใน PDF")
+	}
+
+	prefix := opts.IDPrefix
+	if opts.PackageID != "" {
+		prefix = opts.PackageID + "-"
+	}
+	usedNames := map[string]int{}
+	for gi, g := range groupPDFRateTables(tables) {
+		for pi, plan := range g.plans {
+			if len(g.tiers[plan]) == 0 {
+				continue
+			}
+			name := strings.TrimSpace(plan)
+			if name == "" {
+				name = fmt.Sprintf("หน้า %d ตาราง %d", g.page, gi+1)
+			}
+			class := pdfSpaces.ReplaceAllString(name, "")
+			if plan == "" {
+				class = fmt.Sprintf("p%d-%d", g.page, pi+1)
+			}
+			usedNames[class]++
+			if n := usedNames[class]; n > 1 {
+				name = fmt.Sprintf("%s (%d)", name, n)
+				class = fmt.Sprintf("%s-%d", class, n)
+			}
+
+			pkg := models.Package{PackageID: prefix + class, Name: name}
+			for _, t := range g.tiers[plan] {
+				pkg.Pricing = append(pkg.Pricing, *t)
+			}
+			sort.Slice(pkg.Pricing, func(a, b int) bool { return pkg.Pricing[a].AgeFrom < pkg.Pricing[b].AgeFrom })
+			pkg.MinAge = pkg.Pricing[0].AgeFrom
+			for _, t := range pkg.Pricing {
+				pkg.MaxAge = max(pkg.MaxAge, t.AgeTo)
+			}
+			records = append(records, ImportRecord{
+				Sheet:       fmt.Sprintf("หน้า %d", g.page),
+				Row:         gi + 1,
+				Package:     pkg,
+				PricingOnly: true,
+			})
+		}
+	}
+	if len(records) == 1 && opts.PackageID != "" {
+		records[0].Package.PackageID = opts.PackageID
+	}
+	return records, nil
+}
@@ -0,0 +1,485 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// ข้อความจาก PDF พร้อมตำแหน่ง สำหรับนำไปประกอบเป็นบรรทัดและช่องของตาราง
+// โครงสร้างไฟล์ (xref, object stream, filter, ToUnicode CMap) อ่านด้วย github.com/ledongthuc/pdf
+// ที่นี่เหลือเฉพาะการเดิน content stream เก็บตำแหน่งข้อความ เพราะตัวดึงข้อความของ library
+// ไม่รู้จักชื่อ glyph ไทยใน Differences (uni0E01, maieklowrightthai) และไม่เข้าไปใน form XObject
+
+// ขีดจำกัดสำหรับไฟล์ที่เสียหายหรือจงใจสร้างมา (page tree วน, form XObject เรียกตัวเอง)
+const (
+	pdfMaxPages      = 5000
+	pdfMaxTreeDepth  = 32      // Pages ซ้อนกัน
+	pdfMaxFormDepth  = 8       // form XObject ซ้อนกัน
+	pdfMaxFormRuns   = 200     // จำนวนครั้งที่วาด form XObject ต่อหน้า
+	pdfMaxOperations = 5000000 // จำนวนคำสั่งใน content stream ทั้งเอกสาร (รวม form XObject)
+)
+
+var errPDFTooComplex = errors.New("content stream ของ PDF ยาวเกินกำหนด")
+
+// บรรทัดของตารางในหน้าหนึ่ง: ข้อความแยกเป็นช่องตามระยะห่างแนวนอน
+type PDFLine struct {
+	Page  int
+	Y     float64
+	Cells []PDFCell
+}
+
+type PDFCell struct {
+	X, EndX float64
+	Text    string
+}
+
+// ดึงข้อความจาก PDF เป็นบรรทัด (เรียงจากบนลงล่าง) และช่องในบรรทัด (เรียงจากซ้ายไปขวา)
+// library panic กับไฟล์เสียหาย: ทั้งไฟล์อ่านไม่ได้เป็น error ส่วนหน้าที่เสียหายถูกข้าม
+func ExtractPDFLines(data []byte) (lines []PDFLine, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			lines, err = nil, fmt.Errorf("อ่านไฟล์ PDF ไม่สำเร็จ (ไฟล์อาจเสียหาย): %v", r)
+		}
+	}()
+	reader, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("อ่านไฟล์ PDF ไม่สำเร็จ: %w", err)
+	}
+	pages := pdfPages(reader.Trailer().Key("Root").Key("Pages"))
+	if len(pages) == 0 {
+		return nil, errors.New("ไม่พบหน้าใน PDF")
+	}
+	var budget pdfBudget
+	for i, page := range pages {
+		items, err := pageText(page, &budget)
+		if errors.Is(err, errPDFTooComplex) {
+			return nil, err
+		}
+		lines = append(lines, groupLines(i+1, items)...)
+	}
+	return lines, nil
+}
+
+// หน้าหนึ่งพร้อม Resources ที่สืบทอดจาก Pages
+type pdfPage struct {
+	contents, resources pdf.Value
+}
+
+// หน้าทั้งหมดตามลำดับ (ไม่ใช้ Reader.Page ของ library เพราะวนไม่รู้จบเมื่อ page tree อ้างถึงตัวเอง)
+func pdfPages(root pdf.Value) []pdfPage {
+	var pages []pdfPage
+	var walk func(node, resources pdf.Value, depth int)
+	walk = func(node, resources pdf.Value, depth int) {
+		if depth > pdfMaxTreeDepth || len(pages) >= pdfMaxPages || node.Kind() != pdf.Dict {
+			return
+		}
+		if r := node.Key("Resources"); !r.IsNull() {
+			resources = r
+		}
+		kids := node.Key("Kids")
+		if node.Key("Type").Name() == "Page" || (kids.IsNull() && !node.Key("Contents").IsNull()) {
+			pages = append(pages, pdfPage{contents: node.Key("Contents"), resources: resources})
+			return
+		}
+		for i := 0; i < kids.Len(); i++ {
+			walk(kids.Index(i), resources, depth+1)
+		}
+	}
+	walk(root, pdf.Value{}, 0)
+	return pages
+}
+
+// ข้อความหนึ่งชิ้นบนหน้า (พิกัดของหน้า หน่วย point)
+type pdfTextItem struct {
+	X, Y, EndX, Size float64
+	Text             string
+}
+
+// งบการเดิน content stream: คำสั่งนับทั้งเอกสาร form XObject นับต่อหน้า
+type pdfBudget struct {
+	ops, forms int
+}
+
+func pageText(page pdfPage, budget *pdfBudget) (items []pdfTextItem, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(error); ok && errors.Is(e, errPDFTooComplex) {
+				err = e
+			}
+		}
+	}()
+	budget.forms = 0
+	runContent(page.contents, page.resources, identityMatrix, &items, budget, 0)
+	return items, nil
+}
+
+// ===== fonts =====
+
+type pdfFont struct {
+	twoByte bool
+	enc     pdf.TextEncoding
+	glyphs  map[int]string // จาก Differences (ฟอนต์ไทยแบบ simple มักไม่มี ToUnicode)
+	widths  map[int]float64
+	dw      float64
+}
+
+func newPDFFont(v pdf.Value) *pdfFont {
+	f := &pdfFont{glyphs: map[int]string{}, widths: map[int]float64{}, dw: 500}
+	if v.Kind() == pdf.Null {
+		return f
+	}
+	f.enc = pdf.Font{V: v}.Encoder()
+	if v.Key("Subtype").Name() == "Type0" {
+		f.twoByte, f.dw = true, 1000
+		cid := v.Key("DescendantFonts").Index(0)
+		if dw := cid.Key("DW"); !dw.IsNull() {
+			f.dw = dw.Float64()
+		}
+		f.cidWidths(cid.Key("W"))
+		return f
+	}
+	first := int(v.Key("FirstChar").Int64())
+	widths := v.Key("Widths")
+	for i := 0; i < widths.Len(); i++ {
+		f.widths[first+i] = widths.Index(i).Float64()
+	}
+	diffs := v.Key("Encoding").Key("Differences")
+	code := 0
+	for i := 0; i < diffs.Len(); i++ {
+		switch d := diffs.Index(i); d.Kind() {
+		case pdf.Integer:
+			code = int(d.Int64())
+		case pdf.Name:
+			if t := glyphText(d.Name()); t != "" {
+				f.glyphs[code] = t
+			}
+			code++
+		}
+	}
+	return f
+}
+
+// W ของ CIDFont: [c [w1 w2 ...]] หรือ [cFirst cLast w]
+func (f *pdfFont) cidWidths(w pdf.Value) {
+	for i := 0; i+1 < w.Len(); {
+		first := int(w.Index(i).Int64())
+		if arr := w.Index(i + 1); arr.Kind() == pdf.Array {
+			for j := 0; j < arr.Len(); j++ {
+				f.widths[first+j] = arr.Index(j).Float64()
+			}
+			i += 2
+			continue
+		}
+		if i+2 >= w.Len() {
+			return
+		}
+		last, width := int(w.Index(i+1).Int64()), w.Index(i+2).Float64()
+		for c := first; c <= last && c-first < 65536; c++ {
+			f.widths[c] = width
+		}
+		i += 3
+	}
+}
+
+func (f *pdfFont) text(code int, raw string) string {
+	if t, ok := f.glyphs[code]; ok && !f.twoByte {
+		return t
+	}
+	if f.enc == nil {
+		if code >= 32 && code < 127 {
+			return string(rune(code))
+		}
+		return ""
+	}
+	// รหัสที่ถอดไม่ได้ (control char หรือ U+FFFD) ไม่นับเป็นข้อความ
+	return strings.Map(func(r rune) rune {
+		if r < 32 || r == utf8.RuneError {
+			return -1
+		}
+		return r
+	}, f.enc.Decode(raw))
+}
+
+func (f *pdfFont) width(code int) float64 {
+	if w, ok := f.widths[code]; ok {
+		return w
+	}
+	return f.dw
+}
+
+var glyphNames = map[string]string{
+	"space": " ", "period": ".", "comma": ",", "hyphen": "-", "endash": "-", "emdash": "-",
+	"percent": "%", "slash": "/", "colon": ":", "parenleft": "(", "parenright": ")", "asterisk": "*",
+	"zero": "0", "one": "1", "two": "2", "three": "3", "four": "4",
+	"five": "5", "six": "6", "seven": "7", "eight": "8", "nine": "9",
+}
+
+// ชื่อ glyph ตำแหน่งพิเศษของสระ/วรรณยุกต์ไทย (เช่น maieklowrightthai) ตรวจตามลำดับ prefix ที่ยาวก่อน
+var thaiGlyphPrefixes = []struct{ prefix, text string }{
+	{"maieksarauee", "\u0e37\u0e48"}, {"maiek", "\u0e48"}, {"maitho", "\u0e49"}, {"maitri", "\u0e4a"},
+	{"maichattawa", "\u0e4b"}, {"thanthakhat", "\u0e4c"}, {"maitaikhu", "\u0e47"}, {"maihanakat", "\u0e31"},
+	{"nikhahit", "\u0e4d"}, {"sarauee", "\u0e37"}, {"saraue", "\u0e36"}, {"saraii", "\u0e35"},
+	{"sarai", "\u0e34"}, {"sarauu", "\u0e39"}, {"sarau", "\u0e38"}, {"phinthu", "\u0e3a"},
+}
+
+func glyphText(name string) string {
+	if i := strings.IndexByte(name, '.'); i > 0 {
+		name = name[:i]
+	}
+	if t, ok := glyphNames[name]; ok {
+		return t
+	}
+	if strings.HasPrefix(name, "uni") && len(name) >= 7 {
+		if n, err := strconv.ParseUint(name[3:7], 16, 32); err == nil {
+			return string(rune(n))
+		}
+	}
+	if strings.HasPrefix(name, "u") && len(name) >= 5 {
+		if n, err := strconv.ParseUint(name[1:5], 16, 32); err == nil {
+			return string(rune(n))
+		}
+	}
+	for _, g := range thaiGlyphPrefixes {
+		if strings.HasPrefix(name, g.prefix) {
+			return g.text
+		}
+	}
+	if len(name) == 1 {
+		return name
+	}
+	return ""
+}
+
+// ===== content streams =====
+
+type pdfMatrix [6]float64
+
+var identityMatrix = pdfMatrix{1, 0, 0, 1, 0, 0}
+
+func (m pdfMatrix) mul(n pdfMatrix) pdfMatrix {
+	return pdfMatrix{
+		m[0]*n[0] + m[1]*n[2],
+		m[0]*n[1] + m[1]*n[3],
+		m[2]*n[0] + m[3]*n[2],
+		m[2]*n[1] + m[3]*n[3],
+		m[4]*n[0] + m[5]*n[2] + n[4],
+		m[4]*n[1] + m[5]*n[3] + n[5],
+	}
+}
+
+func translate(tx, ty float64) pdfMatrix {
+	return pdfMatrix{1, 0, 0, 1, tx, ty}
+}
+
+func matrixOf(args []pdf.Value) pdfMatrix {
+	var m pdfMatrix
+	for i := 0; i < 6 && i < len(args); i++ {
+		m[i] = args[i].Float64()
+	}
+	return m
+}
+
+type textState struct {
+	ctm                               pdfMatrix
+	font                              *pdfFont
+	size, charSpace, wordSpace, scale float64
+	leading                           float64
+}
+
+func runContent(strm, resources pdf.Value, ctm pdfMatrix, items *[]pdfTextItem, budget *pdfBudget, depth int) {
+	if depth > pdfMaxFormDepth {
+		return
+	}
+	fonts := map[string]*pdfFont{}
+	st := textState{ctm: ctm, scale: 1, size: 1}
+	var stack []textState
+	tm, tlm := identityMatrix, identityMatrix
+
+	show := func(s string) {
+		if st.font == nil {
+			st.font = newPDFFont(pdf.Value{})
+		}
+		step := 1
+		if st.font.twoByte {
+			step = 2
+		}
+		start := tm.mul(st.ctm)
+		var text strings.Builder
+		for i := 0; i+step <= len(s); i += step {
+			code := int(s[i])
+			if step == 2 {
+				code = code<<8 | int(s[i+1])
+			}
+			text.WriteString(st.font.text(code, s[i:i+step]))
+			tx := st.font.width(code)/1000*st.size + st.charSpace
+			if !st.font.twoByte && code == 32 {
+				tx += st.wordSpace
+			}
+			tm = translate(tx*st.scale, 0).mul(tm)
+		}
+		end := tm.mul(st.ctm)
+		size := st.size * (math.Abs(start[3]) + math.Abs(start[1]))
+		if t := text.String(); strings.TrimSpace(t) != "" {
+			*items = append(*items, pdfTextItem{X: start[4], Y: start[5], EndX: end[4], Size: size, Text: t})
+		}
+	}
+
+	pdf.Interpret(strm, func(stk *pdf.Stack, op string) {
+		args := make([]pdf.Value, stk.Len())
+		for i := len(args) - 1; i >= 0; i-- {
+			args[i] = stk.Pop()
+		}
+		if budget.ops++; budget.ops > pdfMaxOperations {
+			panic(errPDFTooComplex)
+		}
+		num := func(i int) float64 {
+			if i < len(args) {
+				return args[i].Float64()
+			}
+			return 0
+		}
+		switch op {
+		case "q":
+			stack = append(stack, st)
+		case "Q":
+			if len(stack) > 0 {
+				st = stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+			}
+		case "cm":
+			st.ctm = matrixOf(args).mul(st.ctm)
+		case "BT":
+			tm, tlm = identityMatrix, identityMatrix
+		case "Tf":
+			if len(args) >= 2 {
+				name := args[0].Name()
+				if _, ok := fonts[name]; !ok {
+					fonts[name] = newPDFFont(resources.Key("Font").Key(name))
+				}
+				st.font = fonts[name]
+				st.size = num(1)
+			}
+		case "Tc":
+			st.charSpace = num(0)
+		case "Tw":
+			st.wordSpace = num(0)
+		case "Tz":
+			st.scale = num(0) / 100
+		case "TL":
+			st.leading = num(0)
+		case "Td":
+			tlm = translate(num(0), num(1)).mul(tlm)
+			tm = tlm
+		case "TD":
+			st.leading = -num(1)
+			tlm = translate(num(0), num(1)).mul(tlm)
+			tm = tlm
+		case "Tm":
+			tlm = matrixOf(args)
+			tm = tlm
+		case "T*":
+			tlm = translate(0, -st.leading).mul(tlm)
+			tm = tlm
+		case "Tj", "'", "\"":
+			if op != "Tj" {
+				if op == "\"" {
+					st.wordSpace, st.charSpace = num(0), num(1)
+				}
+				tlm = translate(0, -st.leading).mul(tlm)
+				tm = tlm
+			}
+			if len(args) > 0 {
+				show(args[len(args)-1].RawString())
+			}
+		case "TJ":
+			if len(args) > 0 {
+				arr := args[len(args)-1]
+				for i := 0; i < arr.Len(); i++ {
+					switch e := arr.Index(i); e.Kind() {
+					case pdf.String:
+						show(e.RawString())
+					case pdf.Integer, pdf.Real:
+						tm = translate(-e.Float64()/1000*st.size*st.scale, 0).mul(tm)
+					}
+				}
+			}
+		case "Do":
+			if len(args) > 0 && budget.forms < pdfMaxFormRuns {
+				form := resources.Key("XObject").Key(args[0].Name())
+				if form.Kind() == pdf.Stream && form.Key("Subtype").Name() == "Form" {
+					formCTM := st.ctm
+					if m := form.Key("Matrix"); m.Len() == 6 {
+						formCTM = pdfMatrix{m.Index(0).Float64(), m.Index(1).Float64(), m.Index(2).Float64(),
+							m.Index(3).Float64(), m.Index(4).Float64(), m.Index(5).Float64()}.mul(st.ctm)
+					}
+					formRes := form.Key("Resources")
+					if formRes.IsNull() {
+						formRes = resources
+					}
+					budget.forms++
+					runContent(form, formRes, formCTM, items, budget, depth+1)
+				}
+			}
+		}
+	})
+}
+
+// ===== lines & cells =====
+
+func groupLines(page int, items []pdfTextItem) []PDFLine {
+	sort.SliceStable(items, func(i, j int) bool { return items[i].Y > items[j].Y })
+
+	var lines []PDFLine
+	var group []pdfTextItem
+	flush := func() {
+		if len(group) == 0 {
+			return
+		}
+		sort.SliceStable(group, func(i, j int) bool { return group[i].X < group[j].X })
+		line := PDFLine{Page: page, Y: group[0].Y}
+		for _, it := range group {
+			gap := 0.6 * it.Size
+			if gap < 2 {
+				gap = 2
+			}
+			if n := len(line.Cells); n > 0 && it.X-line.Cells[n-1].EndX < gap {
+				cell := &line.Cells[n-1]
+				if it.X-cell.EndX > 0.15*it.Size {
+					cell.Text += " "
+				}
+				cell.Text += it.Text
+				if it.EndX > cell.EndX {
+					cell.EndX = it.EndX
+				}
+				continue
+			}
+			line.Cells = append(line.Cells, PDFCell{X: it.X, EndX: it.EndX, Text: it.Text})
+		}
+		for i := range line.Cells {
+			line.Cells[i].Text = strings.TrimSpace(line.Cells[i].Text)
+		}
+		lines = append(lines, line)
+		group = nil
+	}
+
+	for _, it := range items {
+		tolerance := 0.4 * it.Size
+		if tolerance < 1.5 {
+			tolerance = 1.5
+		}
+		if len(group) > 0 && math.Abs(group[0].Y-it.Y) > tolerance {
+			flush()
+		}
+		group = append(group, it)
+	}
+	flush()
+	return lines
+}
@@ -0,0 +1,240 @@
+package services
+
+import (
+	"backend/models"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ไฟล์ตัวอย่างใน Data/Testing/pdf ของ repo
+func samplePDF(t testing.TB, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("..", "..", "..", "Data", "Testing", "pdf", name))
+	if err != nil {
+		t.Skipf("sample %s: %v", name, err)
+	}
+	return data
+}
+
+func TestDecodeRatePDFSamples(t *testing.T) {
+	tests := []struct {
+		file      string
+		records   int
+		firstID   string
+		firstName string
+		tiers     int
+	}{
+		{"AIA_Benefit.pdf", 177, "Term5", "Term 5", 40},
+		{"AIA_Benefit_removed.pdf", 138, "แผน1ล้านบาท", "แผน 1 ล้านบาท", 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			records, err := DecodeRatePDF(samplePDF(t, tt.file), nil, SheetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != tt.records {
+				t.Fatalf("records = %d, want %d", len(records), tt.records)
+			}
+			first := records[0].Package
+			if first.PackageID != tt.firstID || first.Name != tt.firstName || len(first.Pricing) != tt.tiers {
+				t.Errorf("first = %q %q (%d tiers), want %q %q (%d tiers)",
+					first.PackageID, first.Name, len(first.Pricing), tt.firstID, tt.firstName, tt.tiers)
+			}
+			for _, r := range records {
+				if !r.PricingOnly || len(r.Package.Pricing) == 0 {
+					t.Errorf("%s: pricingOnly=%v tiers=%d", r.Package.PackageID, r.PricingOnly, len(r.Package.Pricing))
+				}
+			}
+		})
+	}
+}
+
+// เบี้ยชาย/หญิงรายช่วงอายุตามที่พิมพ์ในเล่ม (ตรวจกับไฟล์ตัวอย่างทีละช่อง)
+func TestDecodeRatePDFPremiums(t *testing.T) {
+	tests := []struct {
+		file      string
+		packageID string
+		tiers     []models.Pricing // ทุกช่วงของแผน (เรียงตามอายุ)
+		some      []models.Pricing // บางช่วงของแผน
+	}{
+		{
+			// หน้า 7: ตารางที่ 1 (15 วัน - 10 ปี) ทางซ้ายต่อกับตารางที่ 2 (11 - 98 ปี) ทางขวา
+			file:      "AIA_Benefit_removed.pdf",
+			packageID: "แผน1ล้านบาท",
+			tiers: []models.Pricing{
+				{AgeFrom: 0, AgeTo: 5, Male: 53500, Female: 47600},
+				{AgeFrom: 6, AgeTo: 10, Male: 28600, Female: 24600},
+				{AgeFrom: 11, AgeTo: 15, Male: 16400, Female: 14400},
+				{AgeFrom: 16, AgeTo: 20, Male: 13500, Female: 15200},
+				{AgeFrom: 21, AgeTo: 25, Male: 13700, Female: 17200},
+				{AgeFrom: 26, AgeTo: 30, Male: 14700, Female: 17500},
+				{AgeFrom: 31, AgeTo: 35, Male: 15100, Female: 18400},
+				{AgeFrom: 36, AgeTo: 40, Male: 17000, Female: 20400},
+				{AgeFrom: 41, AgeTo: 45, Male: 19200, Female: 22300},
+				{AgeFrom: 46, AgeTo: 50, Male: 21600, Female: 24500},
+				{AgeFrom: 51, AgeTo: 55, Male: 28300, Female: 28500},
+				{AgeFrom: 56, AgeTo: 59, Male: 34100, Female: 34400},
+				{AgeFrom: 60, AgeTo: 65, Male: 40900, Female: 41500},
+				{AgeFrom: 66, AgeTo: 70, Male: 59400, Female: 60800},
+				{AgeFrom: 71, AgeTo: 75, Male: 85400, Female: 88200},
+				{AgeFrom: 76, AgeTo: 80, Male: 122900, Female: 126300},
+				{AgeFrom: 81, AgeTo: 85, Male: 177800, Female: 182700},
+				{AgeFrom: 86, AgeTo: 90, Male: 204500, Female: 210100},
+				{AgeFrom: 91, AgeTo: 95, Male: 235200, Female: 241600},
+				{AgeFrom: 96, AgeTo: 98, Male: 270500, Female: 277800},
+			},
+		},
+		{
+			file:      "AIA_Benefit_removed.pdf",
+			packageID: "แผน5ล้านบาท",
+			some: []models.Pricing{
+				{AgeFrom: 0, AgeTo: 5, Male: 73900, Female: 64400},
+				{AgeFrom: 6, AgeTo: 10, Male: 39400, Female: 34500},
+				{AgeFrom: 11, AgeTo: 15, Male: 20200, Female: 18200},
+				{AgeFrom: 96, AgeTo: 98, Male: 330300, Female: 339700},
+			},
+		},
+		{
+			// หน้า 5: อัตราต่อจำนวนเงินเอาประกัน 1,000 บาท รายอายุ
+			file:      "AIA_Benefit.pdf",
+			packageID: "Term5",
+			some: []models.Pricing{
+				{AgeFrom: 20, AgeTo: 20, Male: 4.89, Female: 3.28},
+				{AgeFrom: 40, AgeTo: 40, Male: 7.46, Female: 4.41},
+				{AgeFrom: 59, AgeTo: 59, Male: 23.54, Female: 13.30},
+			},
+		},
+		{
+			file:      "AIA_Benefit.pdf",
+			packageID: "Term20",
+			some: []models.Pricing{
+				{AgeFrom: 20, AgeTo: 20, Male: 4.56, Female: 2.75},
+				{AgeFrom: 40, AgeTo: 40, Male: 10.12, Female: 5.46},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file+"/"+tt.packageID, func(t *testing.T) {
+			records, err := DecodeRatePDF(samplePDF(t, tt.file), nil, SheetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var pricing []models.Pricing
+			for _, r := range records {
+				if r.Package.PackageID == tt.packageID {
+					pricing = r.Package.Pricing
+					break
+				}
+			}
+			if pricing == nil {
+				t.Fatalf("package %q not found", tt.packageID)
+			}
+			if tt.tiers != nil && !slices.Equal(pricing, tt.tiers) {
+				t.Errorf("pricing =\n%+v\nwant\n%+v", pricing, tt.tiers)
+			}
+			for _, want := range tt.some {
+				i := slices.IndexFunc(pricing, func(p models.Pricing) bool { return p.AgeFrom == want.AgeFrom })
+				if i < 0 {
+					t.Errorf("age %d: tier not found", want.AgeFrom)
+				} else if pricing[i] != want {
+					t.Errorf("age %d: got %+v, want %+v", want.AgeFrom, pricing[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeRatePDFNoTable(t *testing.T) {
+	data := samplePDF(t, "medium.pdf")
+	lines, err := ExtractPDFLines(data)
+	if err != nil || len(lines) == 0 {
+		t.Fatalf("ExtractPDFLines: %d lines, %v", len(lines), err)
+	}
+	if _, err := DecodeRatePDF(data, nil, SheetOptions{}); err == nil {
+		t.Fatal("expected error for PDF without rate table")
+	}
+}
+
+// ประกอบไฟล์ PDF เล็กๆ จาก object (เลข object เริ่มที่ 1, object 1 เป็น Root) พร้อม xref
+func buildPDF(objects ...string) []byte {
+	var b strings.Builder
+	b.WriteString("%PDF-1.7\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&b, "trailer\n<</Size %d/Root 1 0 R>>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return []byte(b.String())
+}
+
+func pdfStreamObj(dict, data string) string {
+	return fmt.Sprintf("<<%s/Length %d>>\nstream\n%s\nendstream", dict, len(data), data)
+}
+
+// ไฟล์ที่เสียหายหรือจงใจสร้างต้องได้ error หรือผลว่าง ไม่ panic และไม่ค้าง
+var malformedPDFs = map[string][]byte{
+	"objstm negative offset":     buildPDF(pdfStreamObj("/Type/ObjStm/N 1/First 10", "5 -400    <</A 1>>")),
+	"objstm offset past end":     buildPDF(pdfStreamObj("/Type/ObjStm/N 1/First 10", "5 999999  <</A 1>>")),
+	"objstm negative first":      buildPDF(pdfStreamObj("/Type/ObjStm/N 1/First -5", "5 0 <</A 1>>")),
+	"objstm first past end":      buildPDF(pdfStreamObj("/Type/ObjStm/N 1/First 1e300", "5 0 <</A 1>>")),
+	"objstm huge count":          buildPDF(pdfStreamObj("/Type/ObjStm/N 1e18/First 4", "5 0 <</A 1>>")),
+	"objstm huge object number":  buildPDF(pdfStreamObj("/Type/ObjStm/N 1/First 25", "99999999999999999999 0 <</A 1>>")),
+	"negative stream length":     buildPDF("<</Length -100>>\nstream\nBT ET\nendstream"),
+	"huge stream length":         buildPDF("<</Length 1e300>>\nstream\nBT ET\nendstream"),
+	"unterminated stream":        []byte("%PDF-1.7\n1 0 obj\n<</Length 5>>\nstream\nBT"),
+	"unterminated hex string":    []byte("%PDF-1.7\n1 0 obj\n<</A <414243"),
+	"unterminated literal":       []byte("%PDF-1.7\n1 0 obj\n<</A (abc\\"),
+	"deep nesting":               buildPDF(strings.Repeat("[", 200000)),
+	"huge reference":             buildPDF("<</Type/Catalog/Pages 99999999999999999999 99999999999999 R>>"),
+	"huge object header":         []byte("%PDF-1.7\n99999999999999999999 0 obj\n<</Type/Catalog>>\nendobj\n"),
+	"predictor columns too wide": buildPDF(pdfStreamObj("/Type/ObjStm/N 1/First 4/Filter/FlateDecode/DecodeParms<</Predictor 12/Columns 1e15>>", "x")),
+	"self referencing form": buildPDF(
+		"<</Type/Catalog/Pages 2 0 R>>",
+		"<</Type/Pages/Kids[3 0 R]>>",
+		"<</Type/Page/Resources 6 0 R/Contents 5 0 R>>",
+		pdfStreamObj("/Subtype/Form/Resources 6 0 R", strings.Repeat("/X Do\n", 100)),
+		pdfStreamObj("", "/X Do"),
+		"<</XObject<</X 4 0 R>>>>",
+	),
+	"page tree cycle": buildPDF(
+		"<</Type/Catalog/Pages 2 0 R>>",
+		"<</Type/Pages/Kids[2 0 R 1 0 R]>>",
+	),
+}
+
+func TestExtractPDFLinesMalformed(t *testing.T) {
+	for name, data := range malformedPDFs {
+		t.Run(name, func(t *testing.T) {
+			start := time.Now()
+			_, _ = ExtractPDFLines(data)
+			if _, err := DecodeRatePDF(data, nil, SheetOptions{}); err == nil {
+				t.Error("expected error")
+			}
+			if d := time.Since(start); d > 10*time.Second {
+				t.Errorf("took %s", d)
+			}
+		})
+	}
+}
+
+func FuzzExtractPDFLines(f *testing.F) {
+	for _, data := range malformedPDFs {
+		f.Add(data)
+	}
+	f.Add(samplePDF(f, "medium.pdf"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		_, _ = ExtractPDFLines(data)
+	})
+}
@@ -0,0 +1,184 @@
+package services
+
+import (
+	"backend/models"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+var (
+	ErrInvalidGender = errors.New("เพศไม่ถูกต้อง (male/female)")
+	ErrNoPricing     = errors.New("แพ็กเกจนี้ไม่มีตารางเบี้ย")
+)
+
+// แปลงค่าเพศจากรูปแบบต่างๆ (male, M, ชาย ...) ให้เป็น "male" หรือ "female"
+func NormalizeGender(g string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(g)) {
+	case "male", "m", "ชาย":
+		return "male", nil
+	case "female", "f", "หญิง":
+		return "female", nil
+	}
+	return "", ErrInvalidGender
+}
+
+// หา tier ของตารางเบี้ยที่ครอบคลุมอายุที่ระบุ
+func FindPricingTier(pricing []models.Pricing, age int) (models.Pricing, bool) {
+	for _, p := range pricing {
+		if age >= p.AgeFrom && age <= p.AgeTo {
+			return p, true
+		}
+	}
+	return models.Pricing{}, false
+}
+
+// เบี้ยรายปีของ tier ตามเพศ (gender ต้องผ่าน NormalizeGender แล้ว)
+func TierPremium(p models.Pricing, gender string) float64 {
+	if gender == "female" {
+		return p.Female
+	}
+	return p.Male
+}
+
+// ตรวจสอบว่าผู้เอาประกันอายุ/เพศนี้ซื้อแพ็กเกจได้หรือไม่ (gender ต้องผ่าน NormalizeGender แล้ว)
+func CheckEligibility(pkg models.Package, age int, gender string) error {
+	if len(pkg.Pricing) == 0 {
+		return ErrNoPricing
+	}
+	if pkg.GenderRestriction != "" {
+		if restricted, err := NormalizeGender(pkg.GenderRestriction); err == nil && restricted != gender {
+			return fmt.Errorf("แพ็กเกจนี้รับเฉพาะเพศ %s", restricted)
+		}
+	}
+	if age < pkg.MinAge || (pkg.MaxAge > 0 && age > pkg.MaxAge) {
+		return fmt.Errorf("อายุ %d อยู่นอกช่วงที่รับประกัน (%d-%d)", age, pkg.MinAge, pkg.MaxAge)
+	}
+	return nil
+}
+
+// เบี้ยรายปีเฉลี่ยตั้งแต่ startAge ถึง endAge แบบเดียวกับ calculateTieredPremium ฝั่ง frontend
+// (ปัดเป็นบาท อายุที่ตารางเบี้ยไม่ครอบคลุมไม่นำมาเฉลี่ย) gender ต้องผ่าน NormalizeGender แล้ว
+func AveragePremium(pricing []models.Pricing, gender string, startAge, endAge int) (float64, error) {
+	if endAge < startAge {
+		return 0, fmt.Errorf("อายุสิ้นสุด (%d) ต้องไม่น้อยกว่าอายุเริ่มต้น (%d)", endAge, startAge)
+	}
+	total, years := 0.0, 0
+	for age := startAge; age <= endAge; age++ {
+		if tier, ok := FindPricingTier(pricing, age); ok {
+			total += TierPremium(tier, gender)
+			years++
+		}
+	}
+	if years == 0 {
+		return 0, fmt.Errorf("ตารางเบี้ยไม่ครอบคลุมอายุ %d-%d", startAge, endAge)
+	}
+	return math.Round(total / float64(years)), nil
+}
+
+type ProjectionOptions struct {
+	TargetAge     int     // 0 = ใช้ MaxAge ของแพ็กเกจ (ไม่มี MaxAge = อายุสุดท้ายของตารางเบี้ย)
+	InflationRate float64 // เช่น 0.03 = 3% ต่อปี
+	MedicalTrend  float64 // อัตราเพิ่มของค่ารักษาพยาบาลต่อปี
+}
+
+// คำนวณตารางเบี้ยรายปีตั้งแต่อายุปัจจุบันจนถึง TargetAge (หรือ MaxAge)
+// ต่างจาก calculateTieredPremium ฝั่ง frontend ที่เฉลี่ยเบี้ยทั้งช่วง
+// ตรงนี้จะคืนเบี้ยทีละปีเพื่อให้เห็นจุดที่เบี้ยขึ้นตาม tier อายุ
+// อายุที่ตารางเบี้ยไม่ครอบคลุมข้ามไปและรายงานไว้ใน Gaps
+func ProjectPremium(pkg models.Package, gender string, currentAge int, opt ProjectionOptions) (*models.PremiumProjection, error) {
+	gender, err := NormalizeGender(gender)
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckEligibility(pkg, currentAge, gender); err != nil {
+		return nil, err
+	}
+	if opt.InflationRate < 0 || opt.MedicalTrend < 0 {
+		return nil, errors.New("อัตราเงินเฟ้อและค่ารักษาพยาบาลต้องไม่ติดลบ")
+	}
+
+	endAge := opt.TargetAge
+	if endAge == 0 {
+		endAge = pkg.MaxAge
+	}
+	if endAge == 0 {
+		endAge = lastPricingAge(pkg.Pricing)
+	}
+	if pkg.MaxAge > 0 && endAge > pkg.MaxAge {
+		endAge = pkg.MaxAge
+	}
+	if endAge < currentAge {
+		return nil, fmt.Errorf("อายุเป้าหมาย (%d) ต้องไม่น้อยกว่าอายุปัจจุบัน (%d)", endAge, currentAge)
+	}
+
+	projection := &models.PremiumProjection{
+		PackageName:   pkg.Name,
+		Gender:        gender,
+		StartAge:      currentAge,
+		EndAge:        endAge,
+		InflationRate: opt.InflationRate,
+		MedicalTrend:  opt.MedicalTrend,
+		Schedule:      []models.PremiumYear{},
+	}
+
+	growth := (1 + opt.InflationRate) * (1 + opt.MedicalTrend)
+	var prev *models.PremiumYear
+	for age := currentAge; age <= endAge; age++ {
+		tier, ok := FindPricingTier(pkg.Pricing, age)
+		if !ok {
+			if n := len(projection.Gaps); n > 0 && projection.Gaps[n-1].To == age-1 {
+				projection.Gaps[n-1].To = age
+			} else {
+				projection.Gaps = append(projection.Gaps, models.AgeGap{From: age, To: age})
+			}
+			continue
+		}
+
+		year := age - currentAge + 1
+		premium := TierPremium(tier, gender)
+		row := models.PremiumYear{
+			Year:      year,
+			Age:       age,
+			AgeFrom:   tier.AgeFrom,
+			AgeTo:     tier.AgeTo,
+			Premium:   premium,
+			Projected: roundBaht(premium * math.Pow(growth, float64(year-1))),
+		}
+		if prev != nil {
+			row.Increase = roundBaht(row.Projected - prev.Projected)
+			row.StepUp = tier.AgeFrom != prev.AgeFrom && premium > prev.Premium
+			row.Cumulative = prev.Cumulative
+		}
+		row.Cumulative = roundBaht(row.Cumulative + row.Projected)
+		if row.StepUp {
+			projection.StepUps++
+		}
+
+		projection.Schedule = append(projection.Schedule, row)
+		prev = &projection.Schedule[len(projection.Schedule)-1]
+	}
+
+	if prev == nil {
+		return nil, fmt.Errorf("ตารางเบี้ยไม่ครอบคลุมอายุ %d", currentAge)
+	}
+
+	projection.Years = len(projection.Schedule)
+	projection.TotalPremium = prev.Cumulative
+	projection.AverageAnnual = roundBaht(prev.Cumulative / float64(projection.Years))
+	return projection, nil
+}
+
+// อายุสูงสุดที่ตารางเบี้ยครอบคลุม
+func lastPricingAge(pricing []models.Pricing) int {
+	last := 0
+	for _, p := range pricing {
+		last = max(last, p.AgeTo)
+	}
+	return last
+}
+
+func roundBaht(v float64) float64 {
+	return math.Round(v*100) / 100
+}
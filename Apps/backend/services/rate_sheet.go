@@ -0,0 +1,274 @@
+package services
+
+import (
+	"backend/models"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ตารางเบี้ยแบบกว้างตามรูปแบบของ TableToContext (modules/TableToContext.py)
+//
+//	year,1M_M,1M_F,5M_M,5M_F     (ไฟล์ต้นฉบับ: คอลัมน์ละ แผน_เพศ)
+//	year,Class,F,M               (ไฟล์ที่ผ่าน TableToContext แล้ว: แถวละ ช่วงอายุ+แผน)
+//
+// แต่ละ Class จะกลายเป็น 1 แพ็กเกจ โดย id = prefix + Class
+
+var (
+	rateSheetColumn   = regexp.MustCompile(`^([^_]+)_([MFmf])$`)
+	yearLabelStrip    = regexp.MustCompile(`["',*]`)
+	yearLabelSpace    = regexp.MustCompile(`\s+`)
+	thousandsNumber   = regexp.MustCompile(`^-?\d{1,3}(?:,\d{3})+(?:\.\d+)?$`)
+	parenthesisNumber = regexp.MustCompile(`^\((.*)\)$`)
+	nonNumericChars   = regexp.MustCompile(`[^\d.\-]+`)
+)
+
+// ตรวจว่าหัวตารางเป็นรูปแบบ year,Class,F,M หรือ year,Plan_M,Plan_F,...
+func IsRateSheet(headers []string) bool {
+	if len(headers) < 2 || normalizeHeader(headers[0]) != "year" {
+		return false
+	}
+	if _, ok := longRateColumns(headers); ok {
+		return true
+	}
+	for _, h := range headers[1:] {
+		if strings.TrimSpace(h) != "" && !rateSheetColumn.MatchString(strings.TrimSpace(h)) {
+			return false
+		}
+	}
+	return true
+}
+
+type rateColumns struct {
+	class, female, male int
+}
+
+func longRateColumns(headers []string) (rateColumns, bool) {
+	cols := rateColumns{class: -1, female: -1, male: -1}
+	for i, h := range headers {
+		switch normalizeHeader(h) {
+		case "class":
+			cols.class = i
+		case "f":
+			cols.female = i
+		case "m":
+			cols.male = i
+		}
+	}
+	return cols, cols.class >= 0 && (cols.female >= 0 || cols.male >= 0)
+}
+
+// แปลงตัวเลขแบบเดียวกับ clean_value: (123) → -123, 12,345.67 → 12345.67,
+// 12345,67 → 12345.67 และตัดสัญลักษณ์อื่น (เช่น ฿ หรือช่องว่าง) ทิ้ง
+func CleanValue(s string) (float64, error) {
+	v := strings.TrimSpace(s)
+	v = parenthesisNumber.ReplaceAllString(v, "-$1")
+	if thousandsNumber.MatchString(v) {
+		v = strings.ReplaceAll(v, ",", "")
+	} else if strings.Contains(v, ",") && !strings.Contains(v, ".") {
+		v = strings.ReplaceAll(v, ",", ".")
+	}
+	v = nonNumericChars.ReplaceAllString(v, "")
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%q ไม่ใช่ตัวเลข", s)
+	}
+	return n, nil
+}
+
+// ป้ายช่วงอายุในคอลัมน์ year เช่น "15 15" → "15ถึง15" แล้วแปลงเป็นช่วงอายุ
+func ParseYearLabel(s string) (int, int, error) {
+	label := strings.TrimSpace(yearLabelStrip.ReplaceAllString(s, ""))
+	if !ageRangeSeparator.MatchString(label) {
+		label = yearLabelSpace.ReplaceAllString(label, "ถึง")
+	}
+	return ParseAgeRange(label)
+}
+
+// แปลงตารางเบี้ยแบบกว้างเป็นแพ็กเกจ (record ละ Class) ที่มีเฉพาะตารางเบี้ย
+func DecodeRateSheet(headers []string, rows [][]string, idPrefix string) ([]ImportRecord, error) {
+	var records []ImportRecord
+	byClass := map[string]int{}
+	tiers := map[string]map[[2]int]*models.Pricing{}
+
+	record := func(class string, rowNum int) *ImportRecord {
+		idx, ok := byClass[class]
+		if !ok {
+			records = append(records, ImportRecord{
+				Row:         rowNum,
+				PricingOnly: true,
+				Package:     models.Package{PackageID: idPrefix + class, Name: class},
+			})
+			idx = len(records) - 1
+			byClass[class] = idx
+			tiers[class] = map[[2]int]*models.Pricing{}
+		}
+		return &records[idx]
+	}
+
+	// ใส่เบี้ยของเพศหนึ่งลงใน tier ของ class ตามช่วงอายุ
+	set := func(class string, rowNum int, from, to int, gender, header, cell string) {
+		rec := record(class, rowNum)
+		if strings.TrimSpace(cell) == "" {
+			return
+		}
+		v, err := CleanValue(cell)
+		if err != nil {
+			rec.Reasons = append(rec.Reasons, fmt.Sprintf("แถว %d คอลัมน์ %q: %v", rowNum, header, err))
+			return
+		}
+		key := [2]int{from, to}
+		t := tiers[class][key]
+		if t == nil {
+			t = &models.Pricing{AgeFrom: from, AgeTo: to}
+			tiers[class][key] = t
+		}
+		if gender == "F" {
+			t.Female = v
+		} else {
+			t.Male = v
+		}
+	}
+
+	long, isLong := longRateColumns(headers)
+	for i, row := range rows {
+		rowNum := i + 1
+		if isBlankRow(row) {
+			continue
+		}
+		from, to, err := ParseYearLabel(row[0])
+		if err != nil {
+			return nil, fmt.Errorf("แถว %d: %v", rowNum, err)
+		}
+
+		if isLong {
+			if long.class >= len(row) || strings.TrimSpace(row[long.class]) == "" {
+				return nil, fmt.Errorf("แถว %d: ไม่มีค่า Class", rowNum)
+			}
+			class := strings.TrimSpace(row[long.class])
+			if long.female >= 0 && long.female < len(row) {
+				set(class, rowNum, from, to, "F", headers[long.female], row[long.female])
+			}
+			if long.male >= 0 && long.male < len(row) {
+				set(class, rowNum, from, to, "M", headers[long.male], row[long.male])
+			}
+			continue
+		}
+
+		for c := 1; c < len(headers) && c < len(row); c++ {
+			m := rateSheetColumn.FindStringSubmatch(strings.TrimSpace(headers[c]))
+			if m == nil {
+				continue
+			}
+			set(m[1], rowNum, from, to, strings.ToUpper(m[2]), headers[c], row[c])
+		}
+	}
+
+	for i := range records {
+		pkg := &records[i].Package
+		for _, t := range tiers[pkg.Name] {
+			pkg.Pricing = append(pkg.Pricing, *t)
+		}
+		sort.Slice(pkg.Pricing, func(a, b int) bool { return pkg.Pricing[a].AgeFrom < pkg.Pricing[b].AgeFrom })
+		if len(pkg.Pricing) > 0 {
+			pkg.MinAge = pkg.Pricing[0].AgeFrom
+			for _, t := range pkg.Pricing {
+				if t.AgeTo > pkg.MaxAge {
+					pkg.MaxAge = t.AgeTo
+				}
+			}
+		}
+	}
+	return records, nil
+}
+
+// ตัวเลือกการแปลงตารางหนึ่งตาราง (ไฟล์ CSV หรือ sheet หนึ่งของ Excel)
+type SheetOptions struct {
+	Profile  models.ImportProfile
+	IDPrefix string // rate sheet: id = IDPrefix + Class
+	// แพ็กเกจที่ sheet นี้ผูกไว้ (จาก sheet map)
+	// rate sheet ที่มีแผนเดียวใช้ id นี้ตรงๆ ถ้ามีหลายแผนจะเป็น PackageID-Class
+	// ส่วนตารางทั่วไปที่ไม่มีคอลัมน์ id จะใช้ id นี้ทุกแถว
+	PackageID string
+}
+
+// แปลงตารางจาก CSV/Excel: ถ้าเป็นตารางเบี้ยแบบกว้างใช้ DecodeRateSheet นอกนั้นใช้ DecodeTable ตาม profile
+func DecodeSheet(headers []string, rows [][]string, opts SheetOptions) ([]ImportRecord, error) {
+	if IsRateSheet(headers) {
+		if opts.PackageID == "" {
+			return DecodeRateSheet(headers, rows, opts.IDPrefix)
+		}
+		records, err := DecodeRateSheet(headers, rows, opts.PackageID+"-")
+		if len(records) == 1 {
+			records[0].Package.PackageID = opts.PackageID
+		}
+		return records, err
+	}
+
+	if opts.PackageID != "" && !hasIDColumn(headers, opts.Profile) {
+		headers = append([]string{"id"}, headers...)
+		withID := make([][]string, len(rows))
+		for i, row := range rows {
+			withID[i] = append([]string{opts.PackageID}, row...)
+		}
+		rows = withID
+	}
+	return DecodeTable(headers, rows, opts.Profile)
+}
+
+func hasIDColumn(headers []string, profile models.ImportProfile) bool {
+	accepted := map[string]bool{"id": true}
+	for _, col := range profile.Columns {
+		if col.Field == "id" {
+			for _, h := range col.Headers {
+				accepted[normalizeHeader(h)] = true
+			}
+		}
+	}
+	for _, h := range headers {
+		if accepted[normalizeHeader(h)] {
+			return true
+		}
+	}
+	return false
+}
+
+// รวมตารางเบี้ยจาก rate sheet เข้ากับ record ของแพ็กเกจเดียวกันจาก sheet สรุป
+// (workbook แบบ sheet สรุป + sheet ตารางเบี้ยรายแพ็กเกจ)
+func MergePricingRecords(records []ImportRecord) []ImportRecord {
+	full := map[string]int{}
+	for i, rec := range records {
+		if !rec.PricingOnly && rec.Package.PackageID != "" {
+			full[rec.Package.PackageID] = i
+		}
+	}
+
+	for _, rec := range records {
+		if idx, ok := full[rec.Package.PackageID]; ok && rec.PricingOnly {
+			records[idx].Package.Pricing = append(records[idx].Package.Pricing, rec.Package.Pricing...)
+			if records[idx].Fields != nil && !records[idx].Fields["pricing"] {
+				fields := map[string]bool{"pricing": true}
+				for f := range records[idx].Fields {
+					fields[f] = true
+				}
+				records[idx].Fields = fields
+			}
+			records[idx].Reasons = append(records[idx].Reasons, rec.Reasons...)
+			if rec.Sheet != "" && rec.Sheet != records[idx].Sheet && !slices.Contains(records[idx].MergedSheets, rec.Sheet) {
+				records[idx].MergedSheets = append(records[idx].MergedSheets, rec.Sheet)
+			}
+		}
+	}
+
+	merged := make([]ImportRecord, 0, len(records))
+	for _, rec := range records {
+		if _, ok := full[rec.Package.PackageID]; ok && rec.PricingOnly {
+			continue
+		}
+		merged = append(merged, rec)
+	}
+	return merged
+}
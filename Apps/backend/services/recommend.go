@@ -0,0 +1,304 @@
+package services
+
+import (
+	"backend/models"
+	"container/heap"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	maxOptionsPerCategory = 5 // จำนวนตัวเลือกสูงสุดที่พิจารณาต่อ category
+	maxRidersPerPlan      = 8 // rider ต่อแผนที่นำมาจัดชุด (2^8 ชุดย่อย) เลือกตัวที่เบี้ยถูกก่อน
+	defaultBundleLimit    = 5
+)
+
+type RecommendRequest struct {
+	Age         int
+	DateOfBirth time.Time // ถ้าระบุ จะคำนวณอายุ ณ StartDate ตาม AgeRule ของแต่ละแพ็กเกจแทน Age
+	StartDate   time.Time
+	Gender      string
+	Budget      float64  // งบประมาณต่อปี (บาท)
+	Categories  []string // category ที่สนใจ เรียงตามความสำคัญ (ว่าง = ทุก category)
+	Limit       int
+}
+
+// ตัวเลือกภายใน category เดียว: แผนหลัก 1 แผน + rider ของแผนนั้น (ถ้ามี)
+type bundleOption struct {
+	category string
+	items    []models.BundleItem
+	total    float64
+}
+
+// ค้นหาชุดแผนหลักและ rider ที่เบี้ยปีแรกรวมกันไม่เกินงบ แล้วเรียงตามคะแนน
+//
+// แผนที่ชื่ออยู่ใน SubPackages ของแพ็กเกจอื่นถือเป็น rider และจะถูกเลือกได้
+// เฉพาะเมื่อมีแผนหลักของมันอยู่ในชุดเดียวกัน ในแต่ละ category เลือกแผนหลักได้ไม่เกิน 1 แผน
+func RecommendBundles(pkgs []models.Package, req RecommendRequest) ([]models.Bundle, error) {
+	gender, err := NormalizeGender(req.Gender)
+	if err != nil {
+		return nil, err
+	}
+	if req.Budget <= 0 {
+		return nil, errors.New("งบประมาณต้องมากกว่า 0")
+	}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultBundleLimit
+	}
+
+	riderNames := map[string]bool{}
+	for _, p := range pkgs {
+		for _, sub := range p.SubPackages {
+			riderNames[sub] = true
+		}
+	}
+
+	// เบี้ยปีแรกของแพ็กเกจที่ผู้เอาประกันมีสิทธิ์ซื้อ
+	premiums := map[string]float64{}
+	byName := map[string]models.Package{}
+	for _, p := range pkgs {
+		age := req.Age
+		if !req.DateOfBirth.IsZero() {
+			if age, err = InsuranceAge(req.DateOfBirth, req.StartDate, p.AgeRule); err != nil {
+				continue
+			}
+		}
+		if CheckEligibility(p, age, gender) != nil {
+			continue
+		}
+		tier, ok := FindPricingTier(p.Pricing, age)
+		if !ok || TierPremium(tier, gender) <= 0 {
+			continue
+		}
+		premiums[p.Name] = TierPremium(tier, gender)
+		byName[p.Name] = p
+	}
+
+	weights := categoryWeights(req.Categories)
+	options := map[string][]bundleOption{}
+	for name, p := range byName {
+		if riderNames[name] {
+			continue
+		}
+		if len(weights) > 0 {
+			if _, ok := weights[p.CategoryID]; !ok {
+				continue
+			}
+		}
+		options[p.CategoryID] = append(options[p.CategoryID], planOptions(p, byName, premiums, req.Budget)...)
+	}
+
+	if len(weights) == 0 {
+		// ไม่ระบุความสนใจ ทุก category มีน้ำหนักเท่ากัน
+		for cat := range options {
+			weights[cat] = 1
+		}
+	}
+
+	var categories []string
+	for cat, opts := range options {
+		// ให้แผนที่ครอบคลุมมากกว่า (เบี้ยสูงกว่า) ถูกพิจารณาก่อน
+		sort.Slice(opts, func(i, j int) bool { return opts[i].total > opts[j].total })
+		if len(opts) > maxOptionsPerCategory {
+			opts = opts[:maxOptionsPerCategory]
+		}
+		options[cat] = opts
+		categories = append(categories, cat)
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		wi, wj := weights[categories[i]], weights[categories[j]]
+		if wi != wj {
+			return wi > wj
+		}
+		return categories[i] < categories[j]
+	})
+
+	// น้ำหนักและเบี้ยสูงสุดที่ category ตั้งแต่ idx เป็นต้นไปยังเพิ่มได้ ใช้ประเมินคะแนนสูงสุดของกิ่งที่เหลือ
+	restWeight := make([]float64, len(categories)+1)
+	restTotal := make([]float64, len(categories)+1)
+	for i := len(categories) - 1; i >= 0; i-- {
+		restWeight[i] = restWeight[i+1] + weights[categories[i]]
+		restTotal[i] = restTotal[i+1]
+		if opts := options[categories[i]]; len(opts) > 0 {
+			restTotal[i] += opts[0].total
+		}
+	}
+	var maxWeight float64
+	for _, w := range weights {
+		maxWeight += w
+	}
+
+	top := &bundleHeap{}
+	seq := 0
+	var chosen []bundleOption
+	var search func(idx int, total, gotWeight float64)
+	search = func(idx int, total, gotWeight float64) {
+		// ได้ครบ limit ชุดแล้วและกิ่งนี้ทำคะแนนได้ไม่ถึงชุดที่แย่ที่สุด ไม่ต้องค้นต่อ
+		if top.Len() == limit {
+			bound := 70*(gotWeight+restWeight[idx])/maxWeight + 20*min(total+restTotal[idx], req.Budget)/req.Budget + 10
+			if roundBaht(bound) < (*top)[0].Score {
+				return
+			}
+		}
+		if idx == len(categories) {
+			if len(chosen) > 0 {
+				seq++
+				b := rankedBundle{Bundle: buildBundle(chosen, total, req.Budget, weights), seq: seq}
+				if top.Len() < limit {
+					heap.Push(top, b)
+				} else if b.better((*top)[0]) {
+					(*top)[0] = b
+					heap.Fix(top, 0)
+				}
+			}
+			return
+		}
+		cat := categories[idx]
+		for _, opt := range options[cat] {
+			if total+opt.total > req.Budget {
+				continue
+			}
+			chosen = append(chosen, opt)
+			search(idx+1, total+opt.total, gotWeight+weights[cat])
+			chosen = chosen[:len(chosen)-1]
+		}
+		// ข้าม category นี้
+		search(idx+1, total, gotWeight)
+	}
+	search(0, 0, 0)
+
+	ranked := *top
+	sort.Slice(ranked, func(i, j int) bool { return ranked[i].better(ranked[j]) })
+	bundles := make([]models.Bundle, len(ranked))
+	for i, b := range ranked {
+		bundles[i] = b.Bundle
+	}
+	return bundles, nil
+}
+
+// ชุดที่ค้นเจอพร้อมลำดับที่พบ ใช้ตัดสินเมื่อคะแนนและเบี้ยเท่ากัน
+type rankedBundle struct {
+	models.Bundle
+	seq int
+}
+
+// คะแนนสูงกว่าดีกว่า ถ้าเท่ากันเบี้ยรวมต่ำกว่าดีกว่า ถ้ายังเท่ากันชุดที่พบก่อนดีกว่า
+func (b rankedBundle) better(o rankedBundle) bool {
+	if b.Score != o.Score {
+		return b.Score > o.Score
+	}
+	if b.TotalAnnual != o.TotalAnnual {
+		return b.TotalAnnual < o.TotalAnnual
+	}
+	return b.seq < o.seq
+}
+
+// min-heap ของชุดที่ดีที่สุด limit ชุด ชุดที่แย่ที่สุดอยู่ที่ [0] เพื่อแทนที่เมื่อเจอชุดที่ดีกว่า
+type bundleHeap []rankedBundle
+
+func (h bundleHeap) Len() int            { return len(h) }
+func (h bundleHeap) Less(i, j int) bool  { return h[j].better(h[i]) }
+func (h bundleHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *bundleHeap) Push(x interface{}) { *h = append(*h, x.(rankedBundle)) }
+func (h *bundleHeap) Pop() interface{} {
+	old := *h
+	b := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return b
+}
+
+// ตัวเลือกของแผนหลัก 1 แผน: แผนเดี่ยว และแผนพร้อม rider ทุกชุดที่ไม่เกินงบ
+// rider ที่ชื่อซ้ำหรือเบี้ยเกินงบที่เหลือจะถูกตัดออก และนำมาจัดชุดไม่เกิน maxRidersPerPlan ตัว
+func planOptions(p models.Package, byName map[string]models.Package, premiums map[string]float64, budget float64) []bundleOption {
+	base := models.BundleItem{PackageName: p.Name, CategoryID: p.CategoryID, Annual: premiums[p.Name]}
+	if base.Annual > budget {
+		return nil
+	}
+
+	var riders []models.BundleItem
+	added := map[string]bool{}
+	for _, sub := range p.SubPackages {
+		rp, ok := byName[sub]
+		if !ok || added[sub] || base.Annual+premiums[sub] > budget {
+			continue
+		}
+		added[sub] = true
+		riders = append(riders, models.BundleItem{PackageName: rp.Name, CategoryID: rp.CategoryID, Rider: true, Annual: premiums[sub]})
+	}
+	if len(riders) > maxRidersPerPlan {
+		sort.SliceStable(riders, func(i, j int) bool { return riders[i].Annual < riders[j].Annual })
+		riders = riders[:maxRidersPerPlan]
+	}
+
+	var opts []bundleOption
+	for mask := 0; mask < 1<<len(riders); mask++ {
+		opt := bundleOption{category: p.CategoryID, items: []models.BundleItem{base}, total: base.Annual}
+		for i, r := range riders {
+			if mask&(1<<i) != 0 {
+				opt.items = append(opt.items, r)
+				opt.total += r.Annual
+			}
+		}
+		if opt.total <= budget {
+			opts = append(opts, opt)
+		}
+	}
+	return opts
+}
+
+// น้ำหนักของ category ตามลำดับความสำคัญ (อันดับแรกได้น้ำหนักมากสุด)
+func categoryWeights(categories []string) map[string]float64 {
+	weights := map[string]float64{}
+	for i, cat := range categories {
+		if _, ok := weights[cat]; !ok {
+			weights[cat] = float64(len(categories) - i)
+		}
+	}
+	return weights
+}
+
+// คะแนน = ความครอบคลุม category ที่สนใจ (70) + สัดส่วนการใช้งบ (20) + rider (10)
+func buildBundle(chosen []bundleOption, total, budget float64, weights map[string]float64) models.Bundle {
+	b := models.Bundle{
+		TotalAnnual: roundBaht(total),
+		Remaining:   roundBaht(budget - total),
+	}
+
+	var maxWeight, gotWeight float64
+	for _, w := range weights {
+		maxWeight += w
+	}
+	riderCount := 0
+	for _, opt := range chosen {
+		b.Items = append(b.Items, opt.items...)
+		b.Categories = append(b.Categories, opt.category)
+		for _, item := range opt.items {
+			if item.Rider {
+				riderCount++
+			}
+		}
+
+		gotWeight += weights[opt.category]
+		b.Explanation = append(b.Explanation, fmt.Sprintf("ครอบคลุมหมวด %s (น้ำหนัก %.0f/%.0f)", opt.category, weights[opt.category], maxWeight))
+	}
+
+	coverage := 70 * gotWeight / maxWeight
+	utilisation := 20 * total / budget
+	riders := 0.0
+	if riderCount > 0 {
+		riders = 10
+	}
+	b.Score = roundBaht(coverage + utilisation + riders)
+
+	b.Explanation = append(b.Explanation,
+		fmt.Sprintf("ความครอบคลุม %.1f/70", coverage),
+		fmt.Sprintf("ใช้งบ %.0f%% (%.1f/20)", 100*total/budget, utilisation),
+	)
+	if riderCount > 0 {
+		b.Explanation = append(b.Explanation, fmt.Sprintf("มีสัญญาเพิ่มเติม %d รายการ (10/10)", riderCount))
+	}
+	return b
+}
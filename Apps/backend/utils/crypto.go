@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+)
+
+// ความยาวขั้นต่ำของ SECRET_KEY
+const MinSecretKeyLength = 32
+
+// แยกกุญแจตามการใช้งานจาก SECRET_KEY (HMAC-SHA256 ของชื่อการใช้งาน)
+// ลายเซ็นหรือข้อมูลเข้ารหัสของการใช้งานหนึ่งจึงนำไปใช้กับอีกการใช้งานไม่ได้
+func DeriveKey(secret []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("corestack/" + purpose))
+	return mac.Sum(nil)
+}
+
+// เข้ารหัสค่าลับที่ต้องเก็บในฐานข้อมูล (เช่น TOTP secret) ด้วย AES-256-GCM
+// กุญแจได้จาก sha256 ของ secret (ส่งกุญแจจาก DeriveKey)
+func EncryptString(secret []byte, plain string) (string, error) {
+	gcm, err := newGCM(secret)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.RawStdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(plain), nil)), nil
+}
+
+func DecryptString(secret []byte, encoded string) (string, error) {
+	gcm, err := newGCM(secret)
+	if err != nil {
+		return "", err
+	}
+	data, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil || len(data) < gcm.NonceSize() {
+		return "", errors.New("invalid ciphertext")
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+func newGCM(secret []byte) (cipher.AEAD, error) {
+	key := sha256.Sum256(secret)
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
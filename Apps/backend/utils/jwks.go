@@ -0,0 +1,185 @@
+package utils
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// public key ของผู้ให้บริการภายนอก (เช่น ID token ของ OIDC) โหลดจาก jwks_uri
+// โหลดใหม่เมื่อครบอายุหรือพบ kid ที่ไม่รู้จัก (ผู้ให้บริการหมุนกุญแจ)
+type JWKSCache struct {
+	URL    string
+	Client *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]remoteKey
+	fetchedAt time.Time
+}
+
+type remoteKey struct {
+	algs []string // อัลกอริทึมที่ใช้กับกุญแจนี้ได้ (ตาม alg ใน JWK หรือชนิดของกุญแจ)
+	key  interface{}
+}
+
+const (
+	jwksMaxAge      = time.Hour
+	jwksMinInterval = 30 * time.Second // ไม่โหลดถี่กว่านี้แม้เจอ kid แปลก
+)
+
+// อัลกอริทึมแบบ asymmetric ที่รับจากผู้ให้บริการภายนอก
+var RemoteSigningMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+func NewJWKSCache(url string, client *http.Client) *JWKSCache {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &JWKSCache{URL: url, Client: client}
+}
+
+// keyfunc สำหรับ jwt.Parse
+func (c *JWKSCache) Keyfunc(ctx context.Context) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, err := c.lookup(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		for _, alg := range key.algs {
+			if token.Method.Alg() == alg {
+				return key.key, nil
+			}
+		}
+		return nil, fmt.Errorf("unexpected signing method %s for kid %q", token.Method.Alg(), kid)
+	}
+}
+
+func (c *JWKSCache) lookup(ctx context.Context, kid string) (remoteKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key, ok := c.find(kid)
+	age := time.Since(c.fetchedAt)
+	if (!ok && age > jwksMinInterval) || age > jwksMaxAge {
+		keys, err := c.fetch(ctx)
+		if err != nil {
+			if ok {
+				return key, nil // ใช้กุญแจเดิมต่อไปถ้าโหลดใหม่ไม่ได้
+			}
+			return remoteKey{}, err
+		}
+		c.keys, c.fetchedAt = keys, time.Now()
+		key, ok = c.find(kid)
+	}
+	if !ok {
+		return remoteKey{}, fmt.Errorf("unknown kid %q", kid)
+	}
+	return key, nil
+}
+
+// token ที่ไม่มี kid ใช้ได้เมื่อ JWKS มีกุญแจดอกเดียว
+func (c *JWKSCache) find(kid string) (remoteKey, bool) {
+	if kid == "" && len(c.keys) == 1 {
+		for _, k := range c.keys {
+			return k, true
+		}
+	}
+	k, ok := c.keys[kid]
+	return k, ok
+}
+
+func (c *JWKSCache) fetch(ctx context.Context) (map[string]remoteKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("jwks %s: %s", c.URL, resp.Status)
+	}
+
+	var body struct {
+		Keys []struct {
+			JWK
+			Y string `json:"y"` // EC
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("jwks %s: %w", c.URL, err)
+	}
+
+	keys := map[string]remoteKey{}
+	for _, k := range body.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, algs := parseJWK(k.JWK, k.Y)
+		if key == nil {
+			continue // ชนิดที่ไม่รองรับ
+		}
+		if k.Alg != "" {
+			algs = []string{k.Alg}
+		}
+		keys[k.Kid] = remoteKey{algs: algs, key: key}
+	}
+	return keys, nil
+}
+
+func parseJWK(k JWK, y string) (interface{}, []string) {
+	b64 := base64.RawURLEncoding
+	switch k.Kty {
+	case "RSA":
+		n, err1 := b64.DecodeString(k.N)
+		e, err2 := b64.DecodeString(k.E)
+		if err1 != nil || err2 != nil || len(n) < 256 {
+			return nil, nil // ไม่รับ RSA ที่สั้นกว่า 2048 บิต
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())},
+			[]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512"}
+	case "EC":
+		var curve elliptic.Curve
+		var alg string
+		switch k.Crv {
+		case "P-256":
+			curve, alg = elliptic.P256(), "ES256"
+		case "P-384":
+			curve, alg = elliptic.P384(), "ES384"
+		case "P-521":
+			curve, alg = elliptic.P521(), "ES512"
+		default:
+			return nil, nil
+		}
+		x, err1 := b64.DecodeString(k.X)
+		yb, err2 := b64.DecodeString(y)
+		if err1 != nil || err2 != nil {
+			return nil, nil
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(yb)}
+		if _, err := pub.ECDH(); err != nil {
+			return nil, nil // จุดไม่อยู่บนเส้นโค้ง
+		}
+		return pub, []string{alg}
+	case "OKP":
+		x, err := b64.DecodeString(k.X)
+		if k.Crv != "Ed25519" || err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, nil
+		}
+		return ed25519.PublicKey(x), []string{"EdDSA"}
+	}
+	return nil, nil
+}
@@ -2,72 +2,103 @@ package utils
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
-	"os"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var jwtSecret = []byte(os.Getenv("JWT_SECRET"))
-var jwtIssuer = os.Getenv("JWT_ISSUER")
-var jwtAudience = os.Getenv("JWT_AUDIENCE")
+var jwtIssuer, jwtAudience string
+
+// ตั้งค่า issuer/audience และโหลดกุญแจลงนาม (เรียกครั้งเดียวจาก main หลังโหลด .env)
+func ConfigureJWT(issuer, audience, keysDir, signingKid string) error {
+	jwtIssuer, jwtAudience = issuer, audience
+	return loadJWTKeys(keysDir, signingKid)
+}
+
+// อายุของ access token (สั้น เพื่อให้การเพิกถอน/เปลี่ยน role มีผลเร็ว) และ refresh token
+// main ตั้งค่าใหม่ได้จาก JWT_ACCESS_TTL / JWT_REFRESH_TTL
+var (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 30 * 24 * time.Hour
+)
 
 type CustomClaims struct {
-	UserID string `json:"userId"`
-	Role   string `json:"role"`
+	UserID    string `json:"userId"`
+	Role      string `json:"role"`
+	SessionID string `json:"sid,omitempty"` // family ของ refresh token ที่ออก access token นี้
+	MFA       bool   `json:"mfa,omitempty"` // เข้าสู่ระบบด้วยการยืนยันสองขั้นตอน
 	jwt.RegisteredClaims
 }
 
-func GenerateJWT(userID, role string) (string, error) {
+// สร้าง access token อายุ AccessTokenTTL พร้อม jti สำหรับเพิกถอนรายโทเค็น
+func GenerateJWT(userID, role, sessionID string, mfa bool) (string, error) {
 	now := time.Now()
+	jti, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
 	claims := CustomClaims{
-		UserID: userID,
-		Role:   role,
+		UserID:    userID,
+		Role:      role,
+		SessionID: sessionID,
+		MFA:       mfa,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(now.Add(24 * time.Hour)),
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(now.Add(AccessTokenTTL)),
 			IssuedAt:  jwt.NewNumericDate(now),
 			Issuer:    jwtIssuer,
 			Audience:  []string{jwtAudience},
 		},
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	key := jwtKeys.signer()
+	if key == nil {
+		return "", fmt.Errorf("jwt: signing key not loaded")
+	}
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.kid
+	return token.SignedString(key.private)
 }
 
+// ตรวจลายเซ็นด้วยกุญแจตาม kid รับเฉพาะ RS256/EdDSA และ issuer/audience ต้องตรงกับที่ GenerateJWT ใส่ไว้
 func ParseJWT(tokenString string) (*CustomClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &CustomClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return jwtSecret, nil
-	})
-
+	claims := &CustomClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, jwtKeys.verificationKey,
+		jwt.WithValidMethods(validSigningMethods),
+		jwt.WithIssuer(jwtIssuer),
+		jwt.WithAudience(jwtAudience),
+		jwt.WithExpirationRequired(),
+	)
 	if err != nil {
 		return nil, err
 	}
+	return claims, nil
+}
 
-	claims, ok := token.Claims.(*CustomClaims)
-	if !ok || !token.Valid {
-		return nil, err
-	}
+// refresh token แบบสุ่ม (opaque) ฝั่งเซิร์ฟเวอร์เก็บเฉพาะ HashToken ของมัน
+func GenerateRefreshToken() (string, error) {
+	return randomToken(32)
+}
 
-	// ตรวจสอบ issuer และ audience ให้ตรงตามที่กำหนดไว้ใน GenerateJWT
-	if claims.Issuer != jwtIssuer {
-		return nil, fmt.Errorf("invalid issuer: %s", claims.Issuer)
-	}
+// โทเค็นสุ่มใช้ครั้งเดียว (เช่น ลิงก์ตั้งรหัสผ่านใหม่)
+func GenerateOneTimeToken() (string, error) {
+	return randomToken(32)
+}
 
-	// ตรวจสอบให้แน่ใจว่า audience มี jwtAudience
-	found := false
-	for _, aud := range claims.Audience {
-		if aud == jwtAudience {
-			found = true
-			break
-		}
-	}
-	if !found {
-		return nil, fmt.Errorf("invalid audience: %v", claims.Audience)
-	}
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
 
-	return claims, nil
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
 }
 
 func GenerateSecureState() string {
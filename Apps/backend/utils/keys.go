@@ -0,0 +1,247 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// กุญแจสำหรับลงนาม/ตรวจสอบ JWT หนึ่งดอก ระบุด้วย kid (ชื่อไฟล์ไม่รวม .pem / .pub.pem)
+// กุญแจที่มีแต่ public key ใช้ตรวจสอบได้อย่างเดียว (กุญแจเก่าที่รอ token หมดอายุ)
+type signingKey struct {
+	kid     string
+	method  jwt.SigningMethod // RS256 หรือ EdDSA
+	private interface{}       // *rsa.PrivateKey หรือ ed25519.PrivateKey (nil = ตรวจสอบอย่างเดียว)
+	public  crypto.PublicKey
+}
+
+type keySet struct {
+	mu     sync.RWMutex
+	keys   map[string]*signingKey
+	active *signingKey
+}
+
+var jwtKeys = &keySet{keys: map[string]*signingKey{}}
+
+// อัลกอริทึมที่ยอมรับตอนตรวจสอบ (ไม่รับ HS256/none)
+var validSigningMethods = []string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}
+
+// โหลดกุญแจทั้งหมดใน dir (*.pem) และเลือกกุญแจที่ใช้ลงนาม
+//
+//	signingKid ว่าง = private key ที่ชื่อมากที่สุด (ตั้งชื่อตามวันที่ เช่น 2026-10-19.pem)
+//	dir ไม่มี private key = สร้าง Ed25519 ใหม่ในโฟลเดอร์
+//	dir ว่าง = สร้างกุญแจชั่วคราวในหน่วยความจำ (token ใช้ไม่ได้หลังรีสตาร์ต เหมาะกับ dev เท่านั้น)
+//
+// การหมุนกุญแจ: วางไฟล์ใหม่ให้ทุก instance เผยแพร่ใน JWKS ก่อน แล้วจึงเปลี่ยน JWT_SIGNING_KID
+// ลบไฟล์เก่าหลังจาก access token ที่ลงนามด้วยกุญแจเก่าหมดอายุแล้ว
+func loadJWTKeys(dir, signingKid string) error {
+	keys := map[string]*signingKey{}
+	if dir == "" {
+		key, err := generateEd25519Key("ephemeral-" + time.Now().Format("20060102150405"))
+		if err != nil {
+			return err
+		}
+		log.Println("jwt: JWT_KEYS_DIR not set, using an ephemeral signing key")
+		keys[key.kid] = key
+	} else {
+		paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+		if err != nil {
+			return err
+		}
+		for _, path := range paths {
+			key, err := readKeyFile(path)
+			if err != nil {
+				return fmt.Errorf("%s: %w", filepath.Base(path), err)
+			}
+			if prev, ok := keys[key.kid]; ok && prev.private != nil {
+				continue // มีทั้ง <kid>.pem และ <kid>.pub.pem
+			}
+			keys[key.kid] = key
+		}
+		if !hasPrivateKey(keys) && signingKid == "" {
+			key, err := generateEd25519Key(time.Now().Format("2006-01-02"))
+			if err != nil {
+				return err
+			}
+			if err := writeKeyFile(filepath.Join(dir, key.kid+".pem"), key); err != nil {
+				return err
+			}
+			log.Printf("jwt: generated signing key %s in %s", key.kid, dir)
+			keys[key.kid] = key
+		}
+	}
+
+	active, err := pickSigningKey(keys, signingKid)
+	if err != nil {
+		return err
+	}
+
+	jwtKeys.mu.Lock()
+	jwtKeys.keys, jwtKeys.active = keys, active
+	jwtKeys.mu.Unlock()
+	return nil
+}
+
+func hasPrivateKey(keys map[string]*signingKey) bool {
+	for _, k := range keys {
+		if k.private != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func pickSigningKey(keys map[string]*signingKey, kid string) (*signingKey, error) {
+	if kid != "" {
+		key, ok := keys[kid]
+		if !ok || key.private == nil {
+			return nil, fmt.Errorf("jwt: signing key %q not found", kid)
+		}
+		return key, nil
+	}
+	kids := make([]string, 0, len(keys))
+	for id, k := range keys {
+		if k.private != nil {
+			kids = append(kids, id)
+		}
+	}
+	if len(kids) == 0 {
+		return nil, errors.New("jwt: no private key to sign with")
+	}
+	sort.Strings(kids)
+	return keys[kids[len(kids)-1]], nil
+}
+
+func generateEd25519Key(kid string) (*signingKey, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &signingKey{kid: kid, method: jwt.SigningMethodEdDSA, private: priv, public: pub}, nil
+}
+
+func writeKeyFile(path string, key *signingKey) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key.private)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600)
+}
+
+// อ่าน PEM: PRIVATE KEY (PKCS#8), RSA PRIVATE KEY (PKCS#1) หรือ PUBLIC KEY (PKIX)
+func readKeyFile(path string) (*signingKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("not a PEM file")
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM type %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	kid := strings.TrimSuffix(strings.TrimSuffix(filepath.Base(path), ".pem"), ".pub")
+	key := &signingKey{kid: kid}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.method, key.private, key.public = jwt.SigningMethodRS256, k, &k.PublicKey
+	case *rsa.PublicKey:
+		key.method, key.public = jwt.SigningMethodRS256, k
+	case ed25519.PrivateKey:
+		key.method, key.private, key.public = jwt.SigningMethodEdDSA, k, k.Public()
+	case ed25519.PublicKey:
+		key.method, key.public = jwt.SigningMethodEdDSA, k
+	default:
+		return nil, fmt.Errorf("unsupported key type %T (use RSA or Ed25519)", parsed)
+	}
+	if rsaKey, ok := key.public.(*rsa.PublicKey); ok && rsaKey.N.BitLen() < 2048 {
+		return nil, errors.New("RSA key must be at least 2048 bits")
+	}
+	return key, nil
+}
+
+func (s *keySet) signer() *signingKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.active
+}
+
+// keyfunc สำหรับ jwt.Parse: ต้องมี kid ที่รู้จักและอัลกอริทึมต้องตรงกับชนิดของกุญแจ
+func (s *keySet) verificationKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	s.mu.RLock()
+	key, ok := s.keys[kid]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown kid %q", kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s for kid %q", token.Method.Alg(), kid)
+	}
+	return key.public, nil
+}
+
+// JSON Web Key (RFC 7517) ของ public key
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`   // RSA
+	E   string `json:"e,omitempty"`   // RSA
+	Crv string `json:"crv,omitempty"` // OKP
+	X   string `json:"x,omitempty"`   // OKP
+}
+
+// public key ทุกดอกที่ยังใช้ตรวจสอบได้ สำหรับ /.well-known/jwks.json
+func JWKS() []JWK {
+	jwtKeys.mu.RLock()
+	defer jwtKeys.mu.RUnlock()
+
+	out := make([]JWK, 0, len(jwtKeys.keys))
+	for _, key := range jwtKeys.keys {
+		jwk := JWK{Kid: key.kid, Use: "sig", Alg: key.method.Alg()}
+		switch pub := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty, jwk.Crv = "OKP", "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+		out = append(out, jwk)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Kid < out[j].Kid })
+	return out
+}
@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errSignedToken = errors.New("invalid or expired token")
+
+// ลงนาม payload ด้วย HMAC-SHA256 พร้อมเวลาหมดอายุ (สำหรับลิงก์ในอีเมลที่ไม่ต้องเก็บสถานะ)
+// รูปแบบ: base64url(payload "|" unix) "." base64url(hmac)
+func SignPayload(secret []byte, payload string, expires time.Time) string {
+	body := base64.RawURLEncoding.EncodeToString([]byte(payload + "|" + strconv.FormatInt(expires.Unix(), 10)))
+	return body + "." + base64.RawURLEncoding.EncodeToString(signPayload(secret, body))
+}
+
+// ตรวจลายเซ็นและเวลาหมดอายุ คืน payload เดิม
+func VerifySignedPayload(secret []byte, token string) (string, error) {
+	body, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", errSignedToken
+	}
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(got, signPayload(secret, body)) {
+		return "", errSignedToken
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(body)
+	if err != nil {
+		return "", errSignedToken
+	}
+	i := strings.LastIndexByte(string(raw), '|')
+	if i < 0 {
+		return "", errSignedToken
+	}
+	exp, err := strconv.ParseInt(string(raw[i+1:]), 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return "", errSignedToken
+	}
+	return string(raw[:i]), nil
+}
+
+func signPayload(secret []byte, body string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(body))
+	return mac.Sum(nil)
+}
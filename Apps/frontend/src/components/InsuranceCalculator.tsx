@@ -21,6 +21,7 @@ import { Promotion, CouponType,PremiumResult } from '@/lib/types';
 import { config } from '@/config';
 interface CalculatorData {
   gender: string;
+  dateOfBirth: string;
   currentAge: string;
   coverageAge: string;
   paymentFrequency: string;
@@ -35,11 +36,12 @@ interface StepData {
   savedData: unknown;
 }
 
+// อายุเริ่มต้นและเบี้ยคำนวณที่ backend จากวันเกิด
 interface NewCartEntry {
   packageName: string;
-  startAge: number;
+  dateOfBirth: string;
+  gender: string;
   endAge: number;
-  premium: PremiumInfo;
 }
 
 
@@ -124,6 +126,7 @@ const InsuranceCalculator = () => {
   const [packagesData, setPackagesData] = useState<Package[]>([]);
   const [formData, setFormData] = useState<CalculatorData>({
     gender: '',
+    dateOfBirth: '',
     currentAge: '',
     coverageAge: '',
     paymentFrequency: 'annual',
@@ -157,13 +160,18 @@ const InsuranceCalculator = () => {
 
   const { toast } = useToast();
 
+  // cart ผูกกับผู้ใช้จาก token (backend ไม่รับ userId จาก query/body)
+  const authHeaders = (): Record<string, string> => {
+    const token = localStorage.getItem("authToken");
+    return token ? { Authorization: `Bearer ${token}` } : {};
+  };
+
   // ✅ ย้าย fetchCart ออกมาเป็นฟังก์ชันแยกเพื่อให้สามารถเรียกใช้ได้จากที่อื่น
 const fetchCart = async () => {
   try {
     const userId = user?._id || user?.userId || "";
     if (!userId) return;
-    const cartURL = `${config.Cart}?userId=${userId}`
-    const res = await fetch(cartURL);
+    const res = await fetch(config.Cart, { headers: authHeaders() });
     if (!res.ok) {
       console.error("Fetch cart failed with status", res.status);
       return;
@@ -252,13 +260,18 @@ const fetchCart = async () => {
 
     const res = await fetch(config.Cart, {
       method: "POST",
-      headers: { "Content-Type": "application/json" },
+      headers: { "Content-Type": "application/json", ...authHeaders() },
       body: JSON.stringify(newItemWithUser),
     });
 
     if (!res.ok) {
-      const errorText = await res.text();
-      console.error("Backend error:", errorText);
+      const body = await res.json().catch(() => ({}));
+      console.error("Backend error:", body);
+      toast({
+        title: "เพิ่มลงตะกร้าไม่สำเร็จ",
+        description: body.error || "ไม่สามารถเพิ่มรายการลงตะกร้าได้",
+        variant: "destructive",
+      });
       return;
     }
 
@@ -286,10 +299,10 @@ const handleRemoveFromCart = async (itemId: string) => {
     const userId = user?._id || user?.userId || "";
     if (!userId) return;
     
-    const REMOVE_ITEM_URL = `${config.Cart}/${itemId}?userId=${userId}`
+    const REMOVE_ITEM_URL = `${config.Cart}/${itemId}`
     const res = await fetch(
       REMOVE_ITEM_URL,
-      { method: "DELETE" }
+      { method: "DELETE", headers: authHeaders() }
     );
 
     if (!res.ok) {
@@ -478,9 +491,15 @@ const handleRemoveFromCart = async (itemId: string) => {
               gender={gender}
               saved={!!stepData.savedData}
               onSave={() => {
-                const tiers = getPricingTiersFromPackage(pkg, gender);
-                const premium = calculateTieredPremium(currentAge, coverageAge, tiers);
-                handleAddToCart({ packageName: pkg.name, startAge: currentAge, endAge: coverageAge, premium });
+                if (!formData.dateOfBirth) {
+                  toast({
+                    title: "ข้อมูลไม่ครบ",
+                    description: "กรุณากรอกวันเกิดก่อนเพิ่มลงตะกร้า",
+                    variant: "destructive",
+                  });
+                  return;
+                }
+                handleAddToCart({ packageName: pkg.name, dateOfBirth: formData.dateOfBirth, gender, endAge: coverageAge });
               }}
               goBack={goBackStep}
             />
@@ -571,6 +590,17 @@ const discountedTotal = baseTotal - discountAmount;
                     </Select>
                   </div>
 
+                  <div className="space-y-2">
+                    <Label htmlFor="dateOfBirth" className="text-sm">วันเกิด (ใช้คำนวณเบี้ยเมื่อเพิ่มลงตะกร้า)</Label>
+                    <Input
+                      id="dateOfBirth"
+                      type="date"
+                      value={formData.dateOfBirth}
+                      onChange={e => setFormData({...formData, dateOfBirth: e.target.value})}
+                      className="h-12"
+                    />
+                  </div>
+
                   <div className="grid grid-cols-2 gap-3">
                     <div className="space-y-2">
                       <Label htmlFor="currentAge" className="text-sm">อายุปัจจุบัน (ปี)</Label>
@@ -36,7 +36,10 @@ export const UploadWithConflictDialog: React.FC = () => {
     try {
       const ConflictURL = `${config.apiBase}/upload`
       const response = await axios.post(ConflictURL, formData, {
-        headers: { "Content-Type": "multipart/form-data" },
+        headers: {
+          "Content-Type": "multipart/form-data",
+          Authorization: `Bearer ${localStorage.getItem("authToken")}`,
+        },
       });
 
       if (response.data.conflicts?.length > 0) {
@@ -59,7 +62,10 @@ export const UploadWithConflictDialog: React.FC = () => {
   try {
     const uploadURL = `${config.apiBase}/upload?force=true`
     const response = await axios.post(uploadURL, formData, {
-      headers: { "Content-Type": "multipart/form-data" },
+      headers: {
+          "Content-Type": "multipart/form-data",
+          Authorization: `Bearer ${localStorage.getItem("authToken")}`,
+        },
     });
 
     toast({
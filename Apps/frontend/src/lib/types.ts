@@ -42,6 +42,7 @@ export interface PremiumInfo {
 
 export interface CalculatorData {
   gender: string;
+  dateOfBirth: string;
   currentAge: string;
   coverageAge: string;
   paymentFrequency: string;
@@ -701,7 +701,10 @@ const handleDeleteAllPackages = async () => {
     try {
       const uploadURL = `${config.apiBase}/upload`
       const response = await axios.post(uploadURL, formData, {
-        headers: { "Content-Type": "multipart/form-data" },
+        headers: {
+          "Content-Type": "multipart/form-data",
+          Authorization: `Bearer ${localStorage.getItem("authToken")}`,
+        },
       });
 
       // ถ้ามี field `conflicts` กลับมา
@@ -61,6 +61,7 @@ export const createFormStepHandlers = ({
     resetForm: () => {
       setFormData({
         gender: '',
+        dateOfBirth: '',
         currentAge: '',
         coverageAge: '',
         paymentFrequency: 'annual',